@@ -25,8 +25,20 @@ func NewAsset(tokenName string) *Asset {
 	return a
 }
 
-func (a *Asset) QueryBalance(ctx *Context, env *ChainEnv, _ Hash) (interface{}, error) {
+func (a *Asset) QueryBalance(ctx *Context, env *ChainEnv, blockHash Hash) (interface{}, error) {
 	account := ctx.GetAddress("account")
+	if ctx.NeedProof {
+		balanceByt, proof, err := env.KVDB.GetWithProof(a, account.Bytes(), blockHash)
+		if err != nil {
+			return nil, err
+		}
+		ctx.AttachProof(a.Name(), account.Bytes(), balanceByt, proof)
+		if balanceByt == nil {
+			// the proof shows the account does not exist, so its balance is zero.
+			return Amount(0), nil
+		}
+		return DecodeToAmount(balanceByt)
+	}
 	amount := a.getBalance(env, account)
 	return amount, nil
 }
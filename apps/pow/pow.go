@@ -58,7 +58,13 @@ func (*Pow) CheckTxn(*txn.SignedTxn) error {
 	return nil
 }
 
+// VerifyBlock checks the proof of work of block, and its weight must be
+// the difficulty proven, otherwise it could win the fork choice by a fake weight.
 func (p *Pow) VerifyBlock(block IBlock, _ *ChainEnv) bool {
+	if block.GetWeight() != spow.Weight(p.targetBits) {
+		logrus.Errorf("weight(%d) of block(%s) mismatches the difficulty", block.GetWeight(), block.GetHash().String())
+		return false
+	}
 	return spow.Validate(block, p.target, p.targetBits)
 }
 
@@ -86,10 +92,11 @@ func (p *Pow) StartBlock(block IBlock, env *ChainEnv, _ *Land) (needBroadcast bo
 	logrus.Infof("prev-block hash is (%s), height is (%d)", block.GetPrevHash().String(), block.GetHeight()-1)
 
 	block.(*Block).SetChainLength(prevBlock.(*Block).ChainLength + 1)
+	block.SetWeight(spow.Weight(p.targetBits))
 
 	pbMap, err := chain.TakeP2pBlocksBefore(block.GetHeight())
 	if err != nil {
-		logrus.Errorf("get p2p-blocks before error: %s", err.Error())
+		return
 	}
 
 	for _, pbs := range pbMap {
@@ -103,7 +110,7 @@ func (p *Pow) StartBlock(block IBlock, env *ChainEnv, _ *Land) (needBroadcast bo
 
 	pbsht, err := chain.TakeP2pBlocks(block.GetHeight())
 	if err != nil {
-		logrus.Errorf("get p2p-blocks error: %s", err.Error())
+		return
 	}
 	if len(pbsht) > 0 {
 		block.CopyFrom(pbsht[0])
@@ -2,9 +2,12 @@ package blockchain
 
 import (
 	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/keypair"
+	. "github.com/Lawliet-Chan/yu/result"
 	"github.com/Lawliet-Chan/yu/trie"
 	"github.com/Lawliet-Chan/yu/txn"
 	. "github.com/Lawliet-Chan/yu/utils/codec"
+	. "github.com/Lawliet-Chan/yu/yerror"
 	"github.com/libp2p/go-libp2p-core/peer"
 )
 
@@ -13,6 +16,8 @@ type Block struct {
 	TxnsHashes []Hash
 
 	ChainLength uint64
+	// the sum of weights from genesis block to this block.
+	TotalWeight uint64
 }
 
 func (b *Block) GetHeight() BlockNum {
@@ -35,6 +40,10 @@ func (b *Block) GetStateRoot() Hash {
 	return b.Header.GetStateRoot()
 }
 
+func (b *Block) GetReceiptRoot() Hash {
+	return b.Header.GetReceiptRoot()
+}
+
 func (b *Block) GetTimestamp() uint64 {
 	return b.Header.GetTimestamp()
 }
@@ -75,6 +84,10 @@ func (b *Block) SetStateRoot(hash Hash) {
 	b.Header.StateRoot = hash
 }
 
+func (b *Block) SetReceiptRoot(hash Hash) {
+	b.Header.ReceiptRoot = hash
+}
+
 func (b *Block) SetTimestamp(ts uint64) {
 	b.Header.Timestamp = ts
 }
@@ -103,22 +116,74 @@ func (b *Block) UseLei(e uint64) {
 	b.Header.LeiUsed += e
 }
 
-//
-//func (b *Block) SetSign(sign []byte) {
-//	b.Header.Signature = sign
-//}
-//
-//func (b *Block) GetSign() []byte {
-//	return b.Header.GetSign()
-//}
-//
-//func (b *Block) SetPubkey(key PubKey) {
-//	b.Header.Pubkey = key.BytesWithType()
-//}
-//
-//func (b *Block) GetPubkey() PubKey {
-//	return b.Header.GetPubkey()
-//}
+func (b *Block) SetSign(sign []byte) {
+	b.Header.Signature = sign
+}
+
+func (b *Block) GetSign() []byte {
+	return b.Header.GetSign()
+}
+
+func (b *Block) SetPubkey(key PubKey) {
+	b.Header.Pubkey = key.BytesWithType()
+}
+
+func (b *Block) GetPubkey() (PubKey, error) {
+	return b.Header.GetPubkey()
+}
+
+// Sign signs the whole header by the block producer, so it MUST be called
+// after the block is executed and all the roots are set.
+func (b *Block) Sign(privkey PrivKey) error {
+	hash, err := b.Header.SignHash()
+	if err != nil {
+		return err
+	}
+	sign, err := privkey.SignData(hash.Bytes())
+	if err != nil {
+		return err
+	}
+	b.SetPubkey(privkey.PubKey())
+	b.SetSign(sign)
+	return nil
+}
+
+// VerifySignature checks the whole header is signed by the pubkey in header,
+// and the pubkey MUST be one of the trusted producers.
+func (b *Block) VerifySignature(producers []PubKey) error {
+	pubkey, err := b.GetPubkey()
+	if err != nil || pubkey == nil {
+		return BlockSignatureIllegal(b.GetHash())
+	}
+	if !isProducer(pubkey, producers) {
+		return ProducerIllegal(b.GetHash(), pubkey.StringWithType())
+	}
+	hash, err := b.Header.SignHash()
+	if err != nil {
+		return err
+	}
+	if !pubkey.VerifySignature(hash.Bytes(), b.GetSign()) {
+		return BlockSignatureIllegal(b.GetHash())
+	}
+	return nil
+}
+
+func isProducer(pubkey PubKey, producers []PubKey) bool {
+	for _, producer := range producers {
+		if producer.Equals(pubkey) {
+			return true
+		}
+	}
+	return false
+}
+
+func (b *Block) GetWeight() uint64 {
+	return b.Header.Weight
+}
+
+func (b *Block) SetWeight(weight uint64) {
+	b.Header.Weight = weight
+}
 
 func (b *Block) SetNonce(nonce uint64) {
 	b.Header.Nonce = nonce
@@ -157,19 +222,26 @@ func MakeTxnRoot(txns []*txn.SignedTxn) (Hash, error) {
 	return mTree.RootNode.Data, nil
 }
 
-//func getPubkeyStrOrNil(b IBlock) (pubkeyStr string) {
-//	pubkey := b.GetPubkey()
-//	if pubkey == nil {
-//		return
-//	}
-//	return pubkey.StringWithType()
-//}
-
-//
-//func (b *Block) getSignStr() (signStr string) {
-//	sign := b.GetSign()
-//	if sign == nil {
-//		return
-//	}
-//	return ToHex(sign)
-//}
+// MakeTxnProof returns the proof that txnHash is in the TxnRoot of block.
+func MakeTxnProof(block IBlock, txnHash Hash) (*trie.MerkleProof, error) {
+	hashes := block.GetTxnsHashes()
+	for i, hash := range hashes {
+		if hash == txnHash {
+			return trie.NewMerkleTree(hashes).Proof(i)
+		}
+	}
+	return nil, TxnNotFound(txnHash)
+}
+
+func MakeReceiptRoot(receipts []*Receipt) (Hash, error) {
+	hashes := make([]Hash, 0)
+	for _, receipt := range receipts {
+		hash, err := receipt.Hash()
+		if err != nil {
+			return NullHash, err
+		}
+		hashes = append(hashes, hash)
+	}
+	mTree := trie.NewMerkleTree(hashes)
+	return mTree.RootNode.Data, nil
+}
@@ -0,0 +1,74 @@
+package blockchain
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/keypair"
+	"github.com/Lawliet-Chan/yu/trie"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"strconv"
+	"testing"
+)
+
+func TestTxnProof(t *testing.T) {
+	block := newTestBlock(1, NullHash, 1, "txns")
+	var hashes []Hash
+	for i := 0; i < 5; i++ {
+		hashes = append(hashes, Keccak256Hash([]byte("txn"+strconv.Itoa(i))))
+	}
+	block.SetTxnsHashes(hashes)
+	block.SetTxnRoot(trie.NewMerkleTree(hashes).RootNode.Data)
+
+	proof, err := MakeTxnProof(block, hashes[3])
+	if err != nil {
+		t.Fatalf("make txn proof error: %s", err.Error())
+	}
+	if !trie.VerifyProof(block.GetTxnRoot(), hashes[3], proof) {
+		t.Fatal("verify txn proof failed")
+	}
+
+	_, err = MakeTxnProof(block, Keccak256Hash([]byte("other")))
+	if _, ok := err.(ErrTxnNotFound); !ok {
+		t.Fatalf("make proof of txn not in block, error: %v", err)
+	}
+}
+
+func TestBlockSignature(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	_, privkey, err := GenKeyPair(Sr25519)
+	if err != nil {
+		t.Fatalf("generate key error: %s", err.Error())
+	}
+	block := newTestBlock(1, NullHash, 1, "signed")
+	block.SetReceiptRoot(Keccak256Hash([]byte("receipts")))
+	err = block.Sign(privkey)
+	if err != nil {
+		t.Fatalf("sign block error: %s", err.Error())
+	}
+	producers := []PubKey{privkey.PubKey()}
+	err = block.VerifySignature(producers)
+	if err != nil {
+		t.Fatalf("verify block signature error: %s", err.Error())
+	}
+
+	// the roots set after hashing are signed too.
+	block.SetStateRoot(Keccak256Hash([]byte("other state")))
+	err = block.VerifySignature(producers)
+	if _, ok := err.(ErrBlockSignatureIllegal); !ok {
+		t.Fatalf("verify tampered block, error: %v", err)
+	}
+
+	// re-signed by an unknown producer.
+	_, forger, err := GenKeyPair(Sr25519)
+	if err != nil {
+		t.Fatalf("generate key error: %s", err.Error())
+	}
+	err = block.Sign(forger)
+	if err != nil {
+		t.Fatalf("sign block error: %s", err.Error())
+	}
+	err = block.VerifySignature(producers)
+	if _, ok := err.(ErrProducerIllegal); !ok {
+		t.Fatalf("verify block of unknown producer, error: %v", err)
+	}
+}
@@ -1,11 +1,16 @@
 package blockchain
 
 import (
+	"errors"
 	. "github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/config"
 	. "github.com/Lawliet-Chan/yu/result"
 	ysql "github.com/Lawliet-Chan/yu/storage/sql"
 	. "github.com/Lawliet-Chan/yu/txn"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
 )
 
 type BlockBase struct {
@@ -18,17 +23,7 @@ func NewBlockBase(cfg *config.BlockBaseConf) (*BlockBase, error) {
 		return nil, err
 	}
 
-	err = db.CreateIfNotExist(&TxnScheme{})
-	if err != nil {
-		return nil, err
-	}
-
-	err = db.CreateIfNotExist(&EventScheme{})
-	if err != nil {
-		return nil, err
-	}
-
-	err = db.CreateIfNotExist(&ErrorScheme{})
+	err = db.Db().AutoMigrate(&TxnScheme{}, &EventScheme{}, &ErrorScheme{}, &ReceiptScheme{})
 	if err != nil {
 		return nil, err
 	}
@@ -40,22 +35,35 @@ func NewBlockBase(cfg *config.BlockBaseConf) (*BlockBase, error) {
 
 func (bb *BlockBase) GetTxn(txnHash Hash) (*SignedTxn, error) {
 	var ts TxnScheme
-	bb.db.Db().Where(&TxnScheme{TxnHash: txnHash.String()}).First(&ts)
+	err := bb.db.Db().Where(&TxnScheme{TxnHash: txnHash.String()}).First(&ts).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, TxnNotFound(txnHash)
+	}
+	if err != nil {
+		return nil, StorageIO("get txn", err)
+	}
 	return ts.toTxn()
 }
 
+// SetTxn overwrites the txn if it exists.
 func (bb *BlockBase) SetTxn(stxn *SignedTxn) error {
 	txnSm, err := toTxnScheme(stxn)
 	if err != nil {
 		return err
 	}
-	bb.db.Db().Create(&txnSm)
+	err = bb.db.Db().Clauses(clause.OnConflict{UpdateAll: true}).Create(&txnSm).Error
+	if err != nil {
+		return StorageIO("set txn", err)
+	}
 	return nil
 }
 
 func (bb *BlockBase) GetTxns(blockHash Hash) ([]*SignedTxn, error) {
 	var tss []TxnScheme
-	bb.db.Db().Where(&TxnScheme{BlockHash: blockHash.String()}).Find(&tss)
+	err := bb.db.Db().Where(&TxnScheme{BlockHash: blockHash.String()}).Find(&tss).Error
+	if err != nil {
+		return nil, StorageIO("get txns", err)
+	}
 	itxns := make([]*SignedTxn, 0)
 	for _, ts := range tss {
 		stxn, err := ts.toTxn()
@@ -67,6 +75,7 @@ func (bb *BlockBase) GetTxns(blockHash Hash) ([]*SignedTxn, error) {
 	return itxns, nil
 }
 
+// SetTxns overwrites the txns which exist.
 func (bb *BlockBase) SetTxns(blockHash Hash, txns []*SignedTxn) error {
 	txnSms := make([]TxnScheme, 0)
 	for _, stxn := range txns {
@@ -77,14 +86,20 @@ func (bb *BlockBase) SetTxns(blockHash Hash, txns []*SignedTxn) error {
 		txnSms = append(txnSms, txnSm)
 	}
 	if len(txnSms) > 0 {
-		bb.db.Db().Create(&txnSms)
+		err := bb.db.Db().Clauses(clause.OnConflict{UpdateAll: true}).Create(&txnSms).Error
+		if err != nil {
+			return StorageIO("set txns", err)
+		}
 	}
 	return nil
 }
 
 func (bb *BlockBase) GetEvents(blockHash Hash) ([]*Event, error) {
 	var ess []EventScheme
-	bb.db.Db().Where(&EventScheme{BlockHash: blockHash.String()}).Find(&ess)
+	err := bb.db.Db().Where(&EventScheme{BlockHash: blockHash.String()}).Find(&ess).Error
+	if err != nil {
+		return nil, StorageIO("get events", err)
+	}
 	events := make([]*Event, 0)
 	for _, es := range ess {
 		e, err := es.toEvent()
@@ -106,14 +121,20 @@ func (bb *BlockBase) SetEvents(events []*Event) error {
 		eventSms = append(eventSms, eventSm)
 	}
 	if len(eventSms) > 0 {
-		bb.db.Db().Create(&eventSms)
+		err := bb.db.Db().Create(&eventSms).Error
+		if err != nil {
+			return StorageIO("set events", err)
+		}
 	}
 	return nil
 }
 
 func (bb *BlockBase) GetErrors(blockHash Hash) ([]*Error, error) {
 	var ess []ErrorScheme
-	bb.db.Db().Where(&ErrorScheme{BlockHash: blockHash.String()}).Find(&ess)
+	err := bb.db.Db().Where(&ErrorScheme{BlockHash: blockHash.String()}).Find(&ess).Error
+	if err != nil {
+		return nil, StorageIO("get errors", err)
+	}
 	errs := make([]*Error, 0)
 	for _, es := range ess {
 		errs = append(errs, es.toError())
@@ -126,6 +147,138 @@ func (bb *BlockBase) SetError(err *Error) error {
 		return nil
 	}
 	errscm := toErrorScheme(err)
-	bb.db.Db().Create(&errscm)
+	dbErr := bb.db.Db().Create(&errscm).Error
+	if dbErr != nil {
+		return StorageIO("set error", dbErr)
+	}
+	return nil
+}
+
+func (bb *BlockBase) QueryEvents(filter *Filter) ([]*Event, error) {
+	var ess []EventScheme
+	err := filterResults(bb.db.Db().Model(&EventScheme{}), filter).Find(&ess).Error
+	if err != nil {
+		return nil, StorageIO("query events", err)
+	}
+	events := make([]*Event, 0)
+	for _, es := range ess {
+		e, err := es.toEvent()
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, e)
+	}
+	return events, nil
+}
+
+func (bb *BlockBase) QueryErrors(filter *Filter) ([]*Error, error) {
+	var ess []ErrorScheme
+	err := filterResults(bb.db.Db().Model(&ErrorScheme{}), filter).Find(&ess).Error
+	if err != nil {
+		return nil, StorageIO("query errors", err)
+	}
+	errs := make([]*Error, 0)
+	for _, es := range ess {
+		errs = append(errs, es.toError())
+	}
+	return errs, nil
+}
+
+// filterResults makes the conditions of filter on the indexed columns of events or errors.
+func filterResults(db *gorm.DB, filter *Filter) *gorm.DB {
+	if filter.TripodName != "" {
+		db = db.Where("tripod_name = ?", filter.TripodName)
+	}
+	if filter.ExecName != "" {
+		db = db.Where("exec_name = ?", filter.ExecName)
+	}
+	if filter.Caller != NullAddress {
+		db = db.Where("caller = ?", filter.Caller.String())
+	}
+	if filter.StartHeight > 0 {
+		db = db.Where("height >= ?", filter.StartHeight)
+	}
+	if filter.EndHeight > 0 {
+		db = db.Where("height <= ?", filter.EndHeight)
+	}
+	db = db.Order("height").Order("id")
+	if filter.Offset > 0 {
+		db = db.Offset(filter.Offset)
+	}
+	switch {
+	case filter.Limit > 0:
+		db = db.Limit(filter.Limit)
+	case filter.Offset > 0:
+		// some SQL databases, such as sqlite, do not accept OFFSET without LIMIT.
+		db = db.Limit(math.MaxInt32)
+	}
+	return db
+}
+
+func (bb *BlockBase) GetReceipt(txnHash Hash) (*Receipt, error) {
+	var rs ReceiptScheme
+	err := bb.db.Db().Where(&ReceiptScheme{TxnHash: txnHash.String()}).First(&rs).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, ReceiptNotFound(txnHash)
+	}
+	if err != nil {
+		return nil, StorageIO("get receipt", err)
+	}
+	return rs.toReceipt()
+}
+
+func (bb *BlockBase) GetReceipts(blockHash Hash) ([]*Receipt, error) {
+	var rss []ReceiptScheme
+	err := bb.db.Db().Where(&ReceiptScheme{BlockHash: blockHash.String()}).Order("idx").Find(&rss).Error
+	if err != nil {
+		return nil, StorageIO("get receipts", err)
+	}
+	receipts := make([]*Receipt, 0)
+	for _, rs := range rss {
+		receipt, err := rs.toReceipt()
+		if err != nil {
+			return nil, err
+		}
+		receipts = append(receipts, receipt)
+	}
+	return receipts, nil
+}
+
+// SetReceipts overwrites the receipts of the txns, such as the txns re-executed in another block.
+func (bb *BlockBase) SetReceipts(blockHash Hash, receipts []*Receipt) error {
+	rss := make([]ReceiptScheme, 0)
+	for i, receipt := range receipts {
+		rs, err := toReceiptScheme(blockHash, i, receipt)
+		if err != nil {
+			return err
+		}
+		rss = append(rss, rs)
+	}
+	if len(rss) > 0 {
+		err := bb.db.Db().Clauses(clause.OnConflict{UpdateAll: true}).Create(&rss).Error
+		if err != nil {
+			return StorageIO("set receipts", err)
+		}
+	}
+	return nil
+}
+
+func (bb *BlockBase) DeleteResults(blockHash Hash) error {
+	hash := blockHash.String()
+	err := bb.db.Db().Transaction(func(tx *gorm.DB) error {
+		err := tx.Unscoped().Where(&EventScheme{BlockHash: hash}).Delete(&EventScheme{}).Error
+		if err != nil {
+			return err
+		}
+		err = tx.Unscoped().Where(&ErrorScheme{BlockHash: hash}).Delete(&ErrorScheme{}).Error
+		if err != nil {
+			return err
+		}
+		// the receipts of the txns re-executed in other blocks have been overwritten.
+		return tx.Where(&ReceiptScheme{BlockHash: hash}).Delete(&ReceiptScheme{}).Error
+	})
+	if err != nil {
+		return StorageIO("delete results", err)
+	}
 	return nil
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/Lawliet-Chan/yu/keypair"
 	. "github.com/Lawliet-Chan/yu/result"
 	. "github.com/Lawliet-Chan/yu/txn"
+	. "github.com/Lawliet-Chan/yu/yerror"
 	"gorm.io/gorm"
 )
 
@@ -48,11 +49,11 @@ func (t TxnScheme) toTxn() (*SignedTxn, error) {
 	ut := &UnsignedTxn{}
 	rawTxn, err := ut.Decode(FromHex(t.RawTxn))
 	if err != nil {
-		return nil, err
+		return nil, StorageIO("decode txn", err)
 	}
 	pubkey, err := keypair.PubkeyFromStr(t.Pubkey)
 	if err != nil {
-		return nil, err
+		return nil, StorageIO("decode txn", err)
 	}
 	return &SignedTxn{
 		Raw:       rawTxn,
@@ -64,12 +65,13 @@ func (t TxnScheme) toTxn() (*SignedTxn, error) {
 
 type EventScheme struct {
 	gorm.Model
-	Caller     string
+	Caller     string `gorm:"index"`
 	BlockStage string
-	BlockHash  string
-	Height     BlockNum
-	TripodName string
-	ExecName   string
+	BlockHash  string `gorm:"index"`
+	TxnHash    string
+	Height     BlockNum `gorm:"index"`
+	TripodName string   `gorm:"index"`
+	ExecName   string   `gorm:"index"`
 	Value      string
 }
 
@@ -82,6 +84,7 @@ func toEventScheme(event *Event) (EventScheme, error) {
 		Caller:     event.Caller.String(),
 		BlockStage: event.BlockStage,
 		BlockHash:  event.BlockHash.String(),
+		TxnHash:    event.TxnHash.String(),
 		Height:     event.Height,
 		TripodName: event.TripodName,
 		ExecName:   event.ExecName,
@@ -94,6 +97,7 @@ func (e EventScheme) toEvent() (*Event, error) {
 		Caller:     HexToAddress(e.Caller),
 		BlockStage: e.BlockStage,
 		BlockHash:  HexToHash(e.BlockHash),
+		TxnHash:    HexToHash(e.TxnHash),
 		Height:     e.Height,
 		TripodName: e.TripodName,
 		ExecName:   e.ExecName,
@@ -104,12 +108,13 @@ func (e EventScheme) toEvent() (*Event, error) {
 
 type ErrorScheme struct {
 	gorm.Model
-	Caller     string
+	Caller     string `gorm:"index"`
 	BlockStage string
-	BlockHash  string
-	Height     BlockNum
-	TripodName string
-	ExecName   string
+	BlockHash  string `gorm:"index"`
+	TxnHash    string
+	Height     BlockNum `gorm:"index"`
+	TripodName string   `gorm:"index"`
+	ExecName   string   `gorm:"index"`
 	Error      string
 }
 
@@ -122,6 +127,7 @@ func toErrorScheme(err *Error) ErrorScheme {
 		Caller:     err.Caller.String(),
 		BlockStage: err.BlockStage,
 		BlockHash:  err.BlockHash.String(),
+		TxnHash:    err.TxnHash.String(),
 		Height:     err.Height,
 		TripodName: err.TripodName,
 		ExecName:   err.ExecName,
@@ -134,9 +140,44 @@ func (e ErrorScheme) toError() *Error {
 		Caller:     HexToAddress(e.Caller),
 		BlockStage: e.BlockStage,
 		BlockHash:  HexToHash(e.BlockHash),
+		TxnHash:    HexToHash(e.TxnHash),
 		Height:     e.Height,
 		TripodName: e.TripodName,
 		ExecName:   e.ExecName,
 		Err:        e.Error,
 	}
 }
+
+type ReceiptScheme struct {
+	TxnHash   string `gorm:"primaryKey"`
+	BlockHash string `gorm:"index"`
+	// index of the txn in block
+	Idx     int
+	Receipt string
+}
+
+func (ReceiptScheme) TableName() string {
+	return "receipts"
+}
+
+func toReceiptScheme(blockHash Hash, idx int, receipt *Receipt) (ReceiptScheme, error) {
+	byt, err := receipt.Encode()
+	if err != nil {
+		return ReceiptScheme{}, err
+	}
+	return ReceiptScheme{
+		TxnHash:   receipt.TxnHash.String(),
+		BlockHash: blockHash.String(),
+		Idx:       idx,
+		Receipt:   string(byt),
+	}, nil
+}
+
+func (r ReceiptScheme) toReceipt() (*Receipt, error) {
+	receipt := &Receipt{}
+	err := receipt.Decode([]byte(r.Receipt))
+	if err != nil {
+		return nil, StorageIO("decode receipt", err)
+	}
+	return receipt, nil
+}
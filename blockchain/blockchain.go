@@ -1,18 +1,27 @@
 package blockchain
 
 import (
+	"errors"
 	. "github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/config"
 	ysql "github.com/Lawliet-Chan/yu/storage/sql"
 	. "github.com/Lawliet-Chan/yu/utils/codec"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"github.com/sirupsen/logrus"
+	"gorm.io/gorm"
 )
 
 type BlockChain struct {
 	chain         ysql.SqlDB
 	blocksFromP2p ysql.SqlDB
+	forkChoice    ForkChoice
 }
 
 func NewBlockChain(cfg *config.BlockchainConf) (*BlockChain, error) {
+	forkChoice, err := NewForkChoice(cfg.ConvergeType)
+	if err != nil {
+		return nil, err
+	}
 	chain, err := ysql.NewSqlDB(&cfg.ChainDB)
 	if err != nil {
 		return nil, err
@@ -22,7 +31,8 @@ func NewBlockChain(cfg *config.BlockchainConf) (*BlockChain, error) {
 		return nil, err
 	}
 
-	err = chain.CreateIfNotExist(&BlocksScheme{})
+	// migrate the chains created before the columns of fork choice are added.
+	err = chain.Db().AutoMigrate(&BlocksScheme{})
 	if err != nil {
 		return nil, err
 	}
@@ -35,11 +45,12 @@ func NewBlockChain(cfg *config.BlockchainConf) (*BlockChain, error) {
 	return &BlockChain{
 		chain:         chain,
 		blocksFromP2p: blocksFromP2pDB,
+		forkChoice:    forkChoice,
 	}, nil
 }
 
 func (bc *BlockChain) ConvergeType() ConvergeType {
-	return Longest
+	return bc.forkChoice.ConvergeType()
 }
 
 func (bc *BlockChain) NewEmptyBlock() IBlock {
@@ -47,35 +58,28 @@ func (bc *BlockChain) NewEmptyBlock() IBlock {
 }
 
 func (bc *BlockChain) EncodeBlocks(blocks []IBlock) ([]byte, error) {
-	var bs []*Block
-	for _, b := range blocks {
-		bs = append(bs, b.(*Block))
-	}
-	return GlobalCodec.EncodeToBytes(bs)
+	return encodeBlocks(blocks)
 }
 
 func (bc *BlockChain) DecodeBlocks(data []byte) ([]IBlock, error) {
-	var bs []*Block
-	err := GlobalCodec.DecodeBytes(data, &bs)
-	if err != nil {
-		return nil, err
-	}
-	var blocks []IBlock
-	for _, b := range bs {
-		blocks = append(blocks, b)
-	}
-	return blocks, nil
+	return decodeBlocks(data)
 }
 
 func (bc *BlockChain) GetGenesis() (IBlock, error) {
-	var block BlocksScheme
-	bc.chain.Db().Where("height = ?", 0).First(&block)
-	return block.toBlock()
+	var bs BlocksScheme
+	err := bc.chain.Db().Where("height = ?", 0).First(&bs).Error
+	if err != nil {
+		return nil, blockErr("get genesis", NullHash, err)
+	}
+	return bs.toBlock()
 }
 
 func (bc *BlockChain) SetGenesis(b IBlock) error {
 	var blocks []BlocksScheme
-	bc.chain.Db().Where("height = ?", 0).Find(&blocks)
+	err := bc.chain.Db().Where("height = ?", 0).Find(&blocks).Error
+	if err != nil {
+		return StorageIO("set genesis", err)
+	}
 
 	if len(blocks) == 0 {
 		return bc.AppendBlock(b)
@@ -85,69 +89,123 @@ func (bc *BlockChain) SetGenesis(b IBlock) error {
 
 // pending a block from other BlockChain-node for validating
 func (bc *BlockChain) InsertBlockFromP2P(b IBlock) error {
-	if bc.ExistsBlock(b.GetHash()) {
-		return nil
+	exist, err := bc.existsBlock(b.GetHash())
+	if err != nil || exist {
+		return err
 	}
+	var bsp []BlocksFromP2pScheme
+	err = bc.blocksFromP2p.Db().Where(&BlocksFromP2pScheme{
+		BlockHash: b.GetHash().String(),
+	}).Find(&bsp).Error
+	if err != nil {
+		return StorageIO("insert block from p2p", err)
+	}
+	if len(bsp) > 0 {
+		return DuplicateBlock(b.GetHash())
+	}
+
 	bs, err := toBlocksFromP2pScheme(b)
 	if err != nil {
 		return err
 	}
-	bc.blocksFromP2p.Db().Create(&bs)
+	err = bc.blocksFromP2p.Db().Create(&bs).Error
+	if err != nil {
+		return StorageIO("insert block from p2p", err)
+	}
 	return nil
 }
 
 func (bc *BlockChain) TakeP2pBlocksBefore(height BlockNum) (map[BlockNum][]IBlock, error) {
 	var bsp []BlocksFromP2pScheme
-	bc.blocksFromP2p.Db().Where("height < ?", height).Order("height").Find(&bsp)
-	blocks := bspToBlocks(bsp)
+	err := bc.blocksFromP2p.Db().Where("height < ?", height).Order("height").Find(&bsp).Error
+	if err != nil {
+		return nil, StorageIO("take p2p blocks", err)
+	}
+	blocks, err := bspToBlocks(bsp)
+	if err != nil {
+		return nil, err
+	}
 	hBlocks := make(map[BlockNum][]IBlock, 0)
 	for _, block := range blocks {
 		height := block.GetHeight()
 		hBlocks[height] = append(hBlocks[height], block)
 	}
-
-	for _, b := range blocks {
-		bc.blocksFromP2p.Db().Delete(&BlocksFromP2pScheme{BlockHash: b.GetHash().String()})
-	}
-	return hBlocks, nil
+	return hBlocks, bc.deleteP2pBlocks(bsp)
 }
 
 func (bc *BlockChain) TakeP2pBlocks(height BlockNum) ([]IBlock, error) {
 	var bsp []BlocksFromP2pScheme
-	bc.blocksFromP2p.Db().Where("height = ?", height).Find(&bsp)
+	err := bc.blocksFromP2p.Db().Where("height = ?", height).Find(&bsp).Error
+	if err != nil {
+		return nil, StorageIO("take p2p blocks", err)
+	}
+	blocks, err := bspToBlocks(bsp)
+	if err != nil {
+		return nil, err
+	}
+	return blocks, bc.deleteP2pBlocks(bsp)
+}
 
+func (bc *BlockChain) deleteP2pBlocks(bsp []BlocksFromP2pScheme) error {
 	for _, bs := range bsp {
-		bc.blocksFromP2p.Db().Delete(&BlocksFromP2pScheme{BlockHash: bs.BlockHash})
+		err := bc.blocksFromP2p.Db().Delete(&BlocksFromP2pScheme{BlockHash: bs.BlockHash}).Error
+		if err != nil {
+			return StorageIO("delete p2p block", err)
+		}
 	}
-	return bspToBlocks(bsp), nil
+	return nil
 }
 
 func (bc *BlockChain) AppendBlock(b IBlock) error {
-	if bc.ExistsBlock(b.GetHash()) {
-		return nil
+	exist, err := bc.existsBlock(b.GetHash())
+	if err != nil || exist {
+		return err
+	}
+	err = fillTotalWeight(bc, b)
+	if err != nil {
+		return err
 	}
 	bs, err := toBlocksScheme(b)
 	if err != nil {
 		return err
 	}
 
-	return bc.chain.Db().Create(bs).Error
+	err = bc.chain.Db().Create(&bs).Error
+	if err != nil {
+		return StorageIO("append block", err)
+	}
+	return nil
 }
 
+// ExistsBlock returns false if the storage fails,
+// the callers who care about it should use GetBlock.
 func (bc *BlockChain) ExistsBlock(blockHash Hash) bool {
-	var bss []BlocksScheme
-	bc.chain.Db().Where(&BlocksScheme{
-		Hash: blockHash.String(),
-	}).Find(&bss)
+	exist, err := bc.existsBlock(blockHash)
+	if err != nil {
+		logrus.Errorf("check existence of block(%s) error: %s", blockHash.String(), err.Error())
+	}
+	return exist
+}
 
-	return len(bss) > 0
+func (bc *BlockChain) existsBlock(blockHash Hash) (bool, error) {
+	var count int64
+	err := bc.chain.Db().Model(&BlocksScheme{}).Where(&BlocksScheme{
+		Hash: blockHash.String(),
+	}).Count(&count).Error
+	if err != nil {
+		return false, StorageIO("check block", err)
+	}
+	return count > 0, nil
 }
 
 func (bc *BlockChain) GetBlock(blockHash Hash) (IBlock, error) {
 	var bs BlocksScheme
-	bc.chain.Db().Where(&BlocksScheme{
+	err := bc.chain.Db().Where(&BlocksScheme{
 		Hash: blockHash.String(),
-	}).First(&bs)
+	}).First(&bs).Error
+	if err != nil {
+		return nil, blockErr("get block", blockHash, err)
+	}
 	return bs.toBlock()
 }
 
@@ -157,85 +215,88 @@ func (bc *BlockChain) UpdateBlock(b IBlock) error {
 		return err
 	}
 
-	bc.chain.Db().Where(&BlocksScheme{
+	result := bc.chain.Db().Model(&BlocksScheme{}).Where(&BlocksScheme{
 		Hash: b.GetHash().String(),
 	}).Updates(bs)
+	if result.Error != nil {
+		return StorageIO("update block", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return BlockNotFound(b.GetHash())
+	}
 	return nil
 }
 
 func (bc *BlockChain) Children(prevBlockHash Hash) ([]IBlock, error) {
-	rows, err := bc.chain.Db().Where(&BlocksScheme{
+	var bss []BlocksScheme
+	err := bc.chain.Db().Where(&BlocksScheme{
 		PrevHash: prevBlockHash.String(),
-	}).Rows()
+	}).Find(&bss).Error
 	if err != nil {
-		return nil, err
+		return nil, StorageIO("get children", err)
 	}
-	defer rows.Close()
+	return bssToBlocks(bss)
+}
 
-	var blocks []IBlock
-	for rows.Next() {
-		var bs BlocksScheme
-		err = bc.chain.Db().ScanRows(rows, &bs)
-		if err != nil {
-			return nil, err
-		}
-		block, err := bs.toBlock()
-		if err != nil {
-			return nil, err
-		}
-		blocks = append(blocks, block)
+func (bc *BlockChain) Leaves() ([]IBlock, error) {
+	var bss []BlocksScheme
+	err := bc.chain.Db().Where(
+		"NOT EXISTS (SELECT 1 FROM blockchain AS child WHERE child.prev_hash = blockchain.hash)",
+	).Find(&bss).Error
+	if err != nil {
+		return nil, StorageIO("get leaves", err)
 	}
-	return blocks, nil
+	return bssToBlocks(bss)
 }
 
 func (bc *BlockChain) Finalize(blockHash Hash) error {
-	bc.chain.Db().Where(&BlocksScheme{
+	result := bc.chain.Db().Model(&BlocksScheme{}).Where(&BlocksScheme{
 		Hash: blockHash.String(),
 	}).Update("finalize", true)
+	if result.Error != nil {
+		return StorageIO("finalize block", result.Error)
+	}
+	if result.RowsAffected == 0 {
+		return BlockNotFound(blockHash)
+	}
 	return nil
 }
 
 func (bc *BlockChain) LastFinalized() (IBlock, error) {
 	var bs BlocksScheme
-	bc.chain.Db().Where(&BlocksScheme{
+	err := bc.chain.Db().Where(&BlocksScheme{
 		Finalize: true,
-	}).Order("height").Last(&bs)
+	}).Order("height desc").First(&bs).Error
+	if err != nil {
+		return nil, blockErr("get last finalized block", NullHash, err)
+	}
 	return bs.toBlock()
 }
 
 func (bc *BlockChain) GetEndBlock() (IBlock, error) {
-	var bs BlocksScheme
-	bc.chain.Db().Raw("select * from blockchain where length = (select max(length) from blockchain)").First(&bs)
-	return bs.toBlock()
-}
-
-func (bc *BlockChain) GetAllBlocks() ([]IBlock, error) {
-	rows, err := bc.chain.Db().Model(&BlocksScheme{}).Rows()
+	leaves, err := bc.Leaves()
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
+	return bc.forkChoice.ChooseHead(bc, leaves)
+}
 
-	var blocks []IBlock
-	for rows.Next() {
-		var bs BlocksScheme
-		err = bc.chain.Db().ScanRows(rows, &bs)
-		if err != nil {
-			return nil, err
-		}
-		block, err := bs.toBlock()
-		if err != nil {
-			return nil, err
-		}
-		blocks = append(blocks, block)
+func (bc *BlockChain) GetAllBlocks() ([]IBlock, error) {
+	var bss []BlocksScheme
+	err := bc.chain.Db().Find(&bss).Error
+	if err != nil {
+		return nil, StorageIO("get all blocks", err)
 	}
-	return blocks, nil
+	return bssToBlocks(bss)
 }
 
 func (bc *BlockChain) GetRangeBlocks(startHeight, endHeight BlockNum) ([]IBlock, error) {
 	var bss []BlocksScheme
-	bc.chain.Db().Where("height BETWEEN ? AND ?", startHeight, endHeight).Find(&bss)
-	return bssToBlocks(bss), nil
+	err := bc.chain.Db().Where("height BETWEEN ? AND ?", startHeight, endHeight).Find(&bss).Error
+	if err != nil {
+		return nil, StorageIO("get range blocks", err)
+	}
+	return bssToBlocks(bss)
 }
 
 func (bc *BlockChain) Chain() (IChainStruct, error) {
@@ -243,14 +304,65 @@ func (bc *BlockChain) Chain() (IChainStruct, error) {
 }
 
 func (bc *BlockChain) LongestChain() (IChainStruct, error) {
+	return longestChain(bc)
+}
+
+func (bc *BlockChain) HeaviestChains() ([]IChainStruct, error) {
+	blocks, err := bc.GetAllBlocks()
+	if err != nil {
+		return nil, err
+	}
+	return MakeHeaviestChain(blocks), nil
+}
+
+func (bc *BlockChain) FinalizedChain() (IChainStruct, error) {
+	var bss []BlocksScheme
+	err := bc.chain.Db().Where(&BlocksScheme{
+		Finalize: true,
+	}).Order("height").Find(&bss).Error
+	if err != nil {
+		return nil, StorageIO("get finalized chain", err)
+	}
+	if len(bss) == 0 {
+		return nil, BlockNotFound(NullHash)
+	}
+	blocks, err := bssToBlocks(bss)
+	if err != nil {
+		return nil, err
+	}
+	return MakeFinalizedChain(blocks), nil
+}
+
+func encodeBlocks(blocks []IBlock) ([]byte, error) {
+	var bs []*Block
+	for _, b := range blocks {
+		bs = append(bs, b.(*Block))
+	}
+	return GlobalCodec.EncodeToBytes(bs)
+}
+
+func decodeBlocks(data []byte) ([]IBlock, error) {
+	var bs []*Block
+	err := GlobalCodec.DecodeBytes(data, &bs)
+	if err != nil {
+		return nil, err
+	}
+	var blocks []IBlock
+	for _, b := range bs {
+		blocks = append(blocks, b)
+	}
+	return blocks, nil
+}
+
+// longestChain walks back from the end block to the genesis block.
+func longestChain(bc IBlockChain) (IChainStruct, error) {
 	block, err := bc.GetEndBlock()
 	if err != nil {
 		return nil, err
 	}
-	prevHash := block.GetPrevHash()
 	chain := NewEmptyChain(block)
 	for block.GetHeight() > 0 {
-		prevBlock, err := bc.GetBlock(prevHash)
+		prevBlock, err := bc.GetBlock(block.GetPrevHash())
 		if err != nil {
 			return nil, err
 		}
@@ -260,19 +372,10 @@ func (bc *BlockChain) LongestChain() (IChainStruct, error) {
 	return chain, nil
 }
 
-func (bc *BlockChain) HeaviestChains() ([]IChainStruct, error) {
-	blocks, err := bc.GetAllBlocks()
-	if err != nil {
-		return nil, err
+// blockErr turns the error of gorm into BlockNotFound or StorageIO.
+func blockErr(op string, blockHash Hash, err error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return BlockNotFound(blockHash)
 	}
-	return MakeHeaviestChain(blocks), nil
-}
-
-func (bc *BlockChain) FinalizedChain() (IChainStruct, error) {
-	var bss []BlocksScheme
-	bc.chain.Db().Where(&BlocksScheme{
-		Finalize: true,
-	}).Order("height").Find(&bss)
-	blocks := bssToBlocks(bss)
-	return MakeFinalizedChain(blocks), nil
+	return StorageIO(op, err)
 }
@@ -2,23 +2,30 @@ package blockchain
 
 import (
 	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/yerror"
 	"github.com/libp2p/go-libp2p-core/peer"
 )
 
 type BlocksScheme struct {
-	Hash       string `gorm:"primaryKey"`
-	PrevHash   string
-	Height     BlockNum
-	TxnRoot    string
-	StateRoot  string
-	Nonce      uint64
-	Timestamp  uint64
-	TxnsHashes string
-	PeerID     string
+	Hash        string `gorm:"primaryKey"`
+	PrevHash    string `gorm:"index"`
+	Height      BlockNum
+	TxnRoot     string
+	StateRoot   string
+	ReceiptRoot string
+	Nonce       uint64
+	Timestamp   uint64
+	TxnsHashes  string
+	PeerID      string
+	Pubkey      string
+	Signature   string
 
 	LeiLimit uint64
 	LeiUsed  uint64
 
+	Weight      uint64
+	TotalWeight uint64
+
 	Length   uint64
 	Finalize bool
 }
@@ -29,19 +36,25 @@ func (BlocksScheme) TableName() string {
 
 func toBlocksScheme(b IBlock) (BlocksScheme, error) {
 	bs := BlocksScheme{
-		Hash:       b.GetHash().String(),
-		PrevHash:   b.GetPrevHash().String(),
-		Height:     b.GetHeight(),
-		TxnRoot:    b.GetTxnRoot().String(),
-		StateRoot:  b.GetStateRoot().String(),
-		Nonce:      b.GetHeader().(*Header).Nonce,
-		Timestamp:  b.GetTimestamp(),
-		TxnsHashes: HashesToHex(b.GetTxnsHashes()),
-		PeerID:     b.GetPeerID().String(),
+		Hash:        b.GetHash().String(),
+		PrevHash:    b.GetPrevHash().String(),
+		Height:      b.GetHeight(),
+		TxnRoot:     b.GetTxnRoot().String(),
+		StateRoot:   b.GetStateRoot().String(),
+		ReceiptRoot: b.GetReceiptRoot().String(),
+		Nonce:       b.GetHeader().(*Header).Nonce,
+		Timestamp:   b.GetTimestamp(),
+		TxnsHashes:  HashesToHex(b.GetTxnsHashes()),
+		PeerID:      b.GetPeerID().String(),
+		Pubkey:      ToHex(b.GetHeader().(*Header).Pubkey),
+		Signature:   ToHex(b.GetSign()),
 
 		LeiLimit: b.GetLeiLimit(),
 		LeiUsed:  b.GetLeiUsed(),
 
+		Weight:      b.GetWeight(),
+		TotalWeight: b.(*Block).TotalWeight,
+
 		Length:   b.(*Block).ChainLength,
 		Finalize: false,
 	}
@@ -58,26 +71,31 @@ func (b *BlocksScheme) toBlock() (IBlock, error) {
 	} else {
 		PeerID, err = peer.Decode(b.PeerID)
 		if err != nil {
-			return nil, err
+			return nil, StorageIO("decode block", err)
 		}
 	}
 
 	header := &Header{
-		PrevHash:  HexToHash(b.PrevHash),
-		Hash:      HexToHash(b.Hash),
-		Height:    b.Height,
-		TxnRoot:   HexToHash(b.TxnRoot),
-		StateRoot: HexToHash(b.StateRoot),
-		Nonce:     b.Nonce,
-		Timestamp: b.Timestamp,
-		PeerID:    PeerID,
-		LeiLimit:  b.LeiLimit,
-		LeiUsed:   b.LeiUsed,
+		PrevHash:    HexToHash(b.PrevHash),
+		Hash:        HexToHash(b.Hash),
+		Height:      b.Height,
+		TxnRoot:     HexToHash(b.TxnRoot),
+		StateRoot:   HexToHash(b.StateRoot),
+		ReceiptRoot: HexToHash(b.ReceiptRoot),
+		Nonce:       b.Nonce,
+		Timestamp:   b.Timestamp,
+		PeerID:      PeerID,
+		Pubkey:      FromHex(b.Pubkey),
+		Signature:   FromHex(b.Signature),
+		LeiLimit:    b.LeiLimit,
+		LeiUsed:     b.LeiUsed,
+		Weight:      b.Weight,
 	}
 	block := &Block{
 		Header:      header,
 		TxnsHashes:  HexToHashes(b.TxnsHashes),
 		ChainLength: b.Length,
+		TotalWeight: b.TotalWeight,
 	}
 
 	return block, nil
@@ -109,29 +127,33 @@ func toBlocksFromP2pScheme(b IBlock) (BlocksFromP2pScheme, error) {
 func (bs BlocksFromP2pScheme) toBlock() (IBlock, error) {
 	byt := FromHex(bs.BlockContent)
 	b := &Block{}
-	return b.Decode(byt)
+	block, err := b.Decode(byt)
+	if err != nil {
+		return nil, StorageIO("decode block", err)
+	}
+	return block, nil
 }
 
-func bssToBlocks(bss []BlocksScheme) []IBlock {
+func bssToBlocks(bss []BlocksScheme) ([]IBlock, error) {
 	blocks := make([]IBlock, 0)
 	for _, bs := range bss {
 		b, err := bs.toBlock()
 		if err != nil {
-			return nil
+			return nil, err
 		}
 		blocks = append(blocks, b)
 	}
-	return blocks
+	return blocks, nil
 }
 
-func bspToBlocks(bsp []BlocksFromP2pScheme) []IBlock {
+func bspToBlocks(bsp []BlocksFromP2pScheme) ([]IBlock, error) {
 	blocks := make([]IBlock, 0)
 	for _, bs := range bsp {
 		b, err := bs.toBlock()
 		if err != nil {
-			return nil
+			return nil, err
 		}
 		blocks = append(blocks, b)
 	}
-	return blocks
+	return blocks, nil
 }
@@ -0,0 +1,177 @@
+package blockchain
+
+import (
+	"bytes"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/yerror"
+)
+
+// ForkChoice chooses the head of canonical chain in the block tree.
+type ForkChoice interface {
+	ConvergeType() ConvergeType
+	// ChooseHead returns the best one of the leaves of block tree.
+	ChooseHead(chain IBlockChain, leaves []IBlock) (IBlock, error)
+}
+
+func NewForkChoice(convergeType string) (ForkChoice, error) {
+	switch convergeType {
+	case config.LongestConverge, "":
+		return LongestChoice{}, nil
+	case config.HeaviestConverge:
+		return HeaviestChoice{}, nil
+	case config.FinalizeConverge:
+		return FinalizeChoice{}, nil
+	default:
+		return nil, NoConvergeType
+	}
+}
+
+// LongestChoice chooses the block with the max chain length.
+type LongestChoice struct{}
+
+func (LongestChoice) ConvergeType() ConvergeType {
+	return Longest
+}
+
+func (LongestChoice) ChooseHead(_ IBlockChain, leaves []IBlock) (IBlock, error) {
+	return bestBlock(leaves, func(a, b *Block) int {
+		return compareUint64(a.ChainLength, b.ChainLength)
+	})
+}
+
+// HeaviestChoice chooses the block with the max total weight, such as the cumulative difficulty of PoW.
+type HeaviestChoice struct{}
+
+func (HeaviestChoice) ConvergeType() ConvergeType {
+	return Heaviest
+}
+
+func (HeaviestChoice) ChooseHead(_ IBlockChain, leaves []IBlock) (IBlock, error) {
+	return bestBlock(leaves, func(a, b *Block) int {
+		if cmp := compareUint64(a.TotalWeight, b.TotalWeight); cmp != 0 {
+			return cmp
+		}
+		return compareUint64(a.ChainLength, b.ChainLength)
+	})
+}
+
+// FinalizeChoice chooses the longest chain on the latest finalized block,
+// the forks which do not contain it are never chosen.
+type FinalizeChoice struct{}
+
+func (FinalizeChoice) ConvergeType() ConvergeType {
+	return Finalize
+}
+
+func (FinalizeChoice) ChooseHead(chain IBlockChain, leaves []IBlock) (IBlock, error) {
+	finalized, err := chain.LastFinalized()
+	if _, ok := err.(ErrBlockNotFound); ok {
+		return LongestChoice{}.ChooseHead(chain, leaves)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []IBlock
+	for _, leaf := range leaves {
+		ok, err := isDescendant(chain, leaf, finalized)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			candidates = append(candidates, leaf)
+		}
+	}
+	if len(candidates) == 0 {
+		return finalized, nil
+	}
+	return LongestChoice{}.ChooseHead(chain, candidates)
+}
+
+// bestBlock returns the max block by cmp, and the one with smaller hash if they are equal,
+// so all the nodes choose the same head.
+func bestBlock(blocks []IBlock, cmp func(a, b *Block) int) (IBlock, error) {
+	if len(blocks) == 0 {
+		return nil, BlockNotFound(NullHash)
+	}
+	best := blocks[0].(*Block)
+	for _, b := range blocks[1:] {
+		block := b.(*Block)
+		c := cmp(block, best)
+		if c > 0 || (c == 0 && bytes.Compare(block.GetHash().Bytes(), best.GetHash().Bytes()) < 0) {
+			best = block
+		}
+	}
+	return best, nil
+}
+
+// isDescendant reports whether ancestor is on the chain ending at block.
+func isDescendant(chain IBlockChain, block, ancestor IBlock) (bool, error) {
+	for block.GetHeight() > ancestor.GetHeight() {
+		prev, err := chain.GetBlock(block.GetPrevHash())
+		if _, ok := err.(ErrBlockNotFound); ok {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		block = prev
+	}
+	return block.GetHash() == ancestor.GetHash(), nil
+}
+
+// CommonAncestor returns the latest common ancestor of blocks a and b, and the blocks
+// from the ancestor(exclusive) to a and to b, both in ascending order of height.
+func CommonAncestor(chain IBlockChain, a, b IBlock) (ancestor IBlock, aBranch, bBranch []IBlock, err error) {
+	for a.GetHash() != b.GetHash() {
+		if a.GetHeight() >= b.GetHeight() {
+			aBranch = append(aBranch, a)
+			a, err = chain.GetBlock(a.GetPrevHash())
+		} else {
+			bBranch = append(bBranch, b)
+			b, err = chain.GetBlock(b.GetPrevHash())
+		}
+		if err != nil {
+			return nil, nil, nil, err
+		}
+	}
+	return a, reverseBlocks(aBranch), reverseBlocks(bBranch), nil
+}
+
+func reverseBlocks(blocks []IBlock) []IBlock {
+	for i, j := 0, len(blocks)-1; i < j; i, j = i+1, j-1 {
+		blocks[i], blocks[j] = blocks[j], blocks[i]
+	}
+	return blocks
+}
+
+// fillTotalWeight sums the weights of block and its parent.
+func fillTotalWeight(chain IBlockChain, b IBlock) error {
+	block := b.(*Block)
+	block.TotalWeight = block.GetWeight()
+	if block.GetHeight() == 0 {
+		return nil
+	}
+	parent, err := chain.GetBlock(block.GetPrevHash())
+	if _, ok := err.(ErrBlockNotFound); ok {
+		// the history before is unknown, such as the chain starting from a state snapshot.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	block.TotalWeight += parent.(*Block).TotalWeight
+	return nil
+}
+
+func compareUint64(a, b uint64) int {
+	switch {
+	case a > b:
+		return 1
+	case a < b:
+		return -1
+	default:
+		return 0
+	}
+}
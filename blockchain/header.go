@@ -1,7 +1,10 @@
 package blockchain
 
 import (
+	"crypto/sha256"
 	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/keypair"
+	. "github.com/Lawliet-Chan/yu/utils/codec"
 	"github.com/libp2p/go-libp2p-core/peer"
 )
 
@@ -11,15 +14,20 @@ type Header struct {
 	Height    BlockNum
 	TxnRoot   Hash
 	StateRoot Hash
-	Nonce     uint64
-	Timestamp uint64
-	PeerID    peer.ID
+	// root of the receipts of txns in block.
+	ReceiptRoot Hash
+	Nonce       uint64
+	Timestamp   uint64
+	PeerID      peer.ID
 
 	Pubkey    []byte
 	Signature []byte
 
 	LeiLimit uint64
 	LeiUsed  uint64
+
+	// the weight in fork choice, such as the difficulty of PoW.
+	Weight uint64
 }
 
 func (h *Header) GetHeight() BlockNum {
@@ -42,6 +50,10 @@ func (h *Header) GetStateRoot() Hash {
 	return h.StateRoot
 }
 
+func (h *Header) GetReceiptRoot() Hash {
+	return h.ReceiptRoot
+}
+
 func (h *Header) GetTimestamp() uint64 {
 	return h.Timestamp
 }
@@ -58,18 +70,31 @@ func (h *Header) GetLeiUsed() uint64 {
 	return h.LeiUsed
 }
 
-//
-//func (h *Header) GetSign() []byte {
-//	return h.Signature
-//}
-//
-//func (h *Header) GetPubkey() PubKey {
-//	if h.Pubkey == nil {
-//		return nil
-//	}
-//	pubkey, err := PubKeyFromBytes(h.Pubkey)
-//	if err != nil {
-//		logrus.Panic("get pubkey from block-header error: ", err.Error())
-//	}
-//	return pubkey
-//}
+func (h *Header) GetWeight() uint64 {
+	return h.Weight
+}
+
+func (h *Header) GetSign() []byte {
+	return h.Signature
+}
+
+// GetPubkey returns the public key of the block producer, nil if the header is not signed.
+func (h *Header) GetPubkey() (PubKey, error) {
+	if len(h.Pubkey) == 0 {
+		return nil, nil
+	}
+	return PubKeyFromBytes(h.Pubkey)
+}
+
+// SignHash returns the hash of the whole header except Pubkey and Signature,
+// which is the digest signed by the block producer.
+func (h *Header) SignHash() (Hash, error) {
+	unsigned := *h
+	unsigned.Pubkey = nil
+	unsigned.Signature = nil
+	byt, err := GlobalCodec.EncodeToBytes(&unsigned)
+	if err != nil {
+		return NullHash, err
+	}
+	return sha256.Sum256(byt), nil
+}
@@ -2,6 +2,7 @@ package blockchain
 
 import (
 	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/keypair"
 	. "github.com/Lawliet-Chan/yu/result"
 	. "github.com/Lawliet-Chan/yu/txn"
 	"github.com/libp2p/go-libp2p-core/peer"
@@ -19,6 +20,7 @@ type IBlock interface {
 	SetPreHash(hash Hash)
 	SetTxnRoot(hash Hash)
 	SetStateRoot(hash Hash)
+	SetReceiptRoot(hash Hash)
 	SetHeight(BlockNum)
 	SetTimestamp(ts uint64)
 	SetPeerID(peer.ID)
@@ -26,6 +28,13 @@ type IBlock interface {
 	SetLeiLimit(e uint64)
 	UseLei(e uint64)
 
+	SetWeight(weight uint64)
+
+	// Sign signs the block as its producer.
+	Sign(privkey PrivKey) error
+	// VerifySignature checks the block is signed by one of the producers.
+	VerifySignature(producers []PubKey) error
+
 	Encode() ([]byte, error)
 	Decode(data []byte) (IBlock, error)
 
@@ -38,10 +47,14 @@ type IHeader interface {
 	GetPrevHash() Hash
 	GetTxnRoot() Hash
 	GetStateRoot() Hash
+	GetReceiptRoot() Hash
 	GetTimestamp() uint64
 	GetPeerID() peer.ID
 	GetLeiLimit() uint64
 	GetLeiUsed() uint64
+	GetWeight() uint64
+	GetSign() []byte
+	GetPubkey() (PubKey, error)
 }
 
 // --------------- blockchain interface ----------------
@@ -78,8 +91,11 @@ type IBlockChain interface {
 	UpdateBlock(b IBlock) error
 
 	Children(prevBlockHash Hash) ([]IBlock, error)
+	// the blocks without children in the block tree
+	Leaves() ([]IBlock, error)
 	Finalize(blockHash Hash) error
 	LastFinalized() (IBlock, error)
+	// the head of canonical chain chosen by the fork choice rule
 	GetEndBlock() (IBlock, error)
 	GetAllBlocks() ([]IBlock, error)
 
@@ -108,4 +124,16 @@ type IBlockBase interface {
 
 	GetErrors(blockHash Hash) ([]*Error, error)
 	SetError(err *Error) error
+
+	QueryEvents(filter *Filter) ([]*Event, error)
+	QueryErrors(filter *Filter) ([]*Error, error)
+
+	GetReceipt(txnHash Hash) (*Receipt, error)
+	// GetReceipts returns the receipts of block in the order of its txns.
+	GetReceipts(blockHash Hash) ([]*Receipt, error)
+	SetReceipts(blockHash Hash, receipts []*Receipt) error
+
+	// DeleteResults drops the events, errors and receipts of block,
+	// when the block is orphaned by a reorg.
+	DeleteResults(blockHash Hash) error
 }
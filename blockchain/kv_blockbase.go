@@ -0,0 +1,608 @@
+package blockchain
+
+import (
+	"encoding/binary"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/result"
+	"github.com/Lawliet-Chan/yu/storage/kv"
+	. "github.com/Lawliet-Chan/yu/txn"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"sync"
+)
+
+// Keys of KvBlockBase:
+// txn-{txnHash}                           => encoded txn
+// block-txn-{blockHash}{index}            => txnHash
+// event-{blockHash}{seq}                  => encoded event
+// error-{blockHash}{seq}                  => encoded error
+// result-seq                              => the last seq of events and errors
+// height-event-{height}{seq}              => key of event
+// tripod-event-{tripod}{height}{seq}      => key of event
+// exec-event-{tripod}{exec}{height}{seq}  => key of event
+// caller-event-{caller}{height}{seq}      => key of event
+// height-error-, tripod-error-, exec-error- and caller-error- index the errors in the same way.
+// receipt-{txnHash}                       => encoded receipt
+// block-receipt-{blockHash}{index}        => txnHash
+var (
+	txnPrefix          = []byte("txn-")
+	blockTxnPrefix     = []byte("block-txn-")
+	eventPrefix        = []byte("event-")
+	errorPrefix        = []byte("error-")
+	heightEventPrefix  = []byte("height-event-")
+	tripodEventPrefix  = []byte("tripod-event-")
+	execEventPrefix    = []byte("exec-event-")
+	callerEventPrefix  = []byte("caller-event-")
+	heightErrorPrefix  = []byte("height-error-")
+	tripodErrorPrefix  = []byte("tripod-error-")
+	execErrorPrefix    = []byte("exec-error-")
+	callerErrorPrefix  = []byte("caller-error-")
+	receiptPrefix      = []byte("receipt-")
+	blockReceiptPrefix = []byte("block-receipt-")
+
+	resultSeqKey = []byte("result-seq")
+
+	eventIndexes = &resultIndexes{
+		height: heightEventPrefix,
+		tripod: tripodEventPrefix,
+		exec:   execEventPrefix,
+		caller: callerEventPrefix,
+	}
+	errorIndexes = &resultIndexes{
+		height: heightErrorPrefix,
+		tripod: tripodErrorPrefix,
+		exec:   execErrorPrefix,
+		caller: callerErrorPrefix,
+	}
+)
+
+// KvBlockBase is the IBlockBase on kv.KV, for embedded deployments without a SQL database.
+type KvBlockBase struct {
+	// guards result-seq
+	lock sync.Mutex
+	db   kv.KV
+}
+
+func NewKvBlockBase(cfg *config.KVconf) (*KvBlockBase, error) {
+	db, err := kv.NewKV(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &KvBlockBase{db: db}, nil
+}
+
+func (bb *KvBlockBase) GetTxn(txnHash Hash) (*SignedTxn, error) {
+	byt, err := bb.db.Get(txnKey(txnHash))
+	if err != nil {
+		return nil, StorageIO("get txn", err)
+	}
+	if byt == nil {
+		return nil, TxnNotFound(txnHash)
+	}
+	stxns, err := DecodeSignedTxns(byt)
+	if err != nil {
+		return nil, StorageIO("decode txn", err)
+	}
+	return stxns[0], nil
+}
+
+func (bb *KvBlockBase) SetTxn(stxn *SignedTxn) error {
+	byt, err := FromArray(stxn).Encode()
+	if err != nil {
+		return err
+	}
+	err = bb.db.Set(txnKey(stxn.GetTxnHash()), byt)
+	if err != nil {
+		return StorageIO("set txn", err)
+	}
+	return nil
+}
+
+func (bb *KvBlockBase) GetTxns(blockHash Hash) ([]*SignedTxn, error) {
+	iter, err := bb.db.Iter(blockScopedPrefix(blockTxnPrefix, blockHash))
+	if err != nil {
+		return nil, StorageIO("get txns", err)
+	}
+	defer iter.Close()
+
+	stxns := make([]*SignedTxn, 0)
+	for iter.Valid() {
+		_, txnHash, err := iter.Entry()
+		if err != nil {
+			return nil, StorageIO("get txns", err)
+		}
+		stxn, err := bb.GetTxn(BytesToHash(txnHash))
+		if err != nil {
+			return nil, err
+		}
+		stxns = append(stxns, stxn)
+		err = iter.Next()
+		if err != nil {
+			return nil, StorageIO("get txns", err)
+		}
+	}
+	return stxns, nil
+}
+
+func (bb *KvBlockBase) SetTxns(blockHash Hash, txns []*SignedTxn) error {
+	batch := bb.db.NewBatch()
+	for i, stxn := range txns {
+		byt, err := FromArray(stxn).Encode()
+		if err != nil {
+			return err
+		}
+		txnHash := stxn.GetTxnHash()
+		err = batch.Set(txnKey(txnHash), byt)
+		if err != nil {
+			return StorageIO("set txns", err)
+		}
+		// the index keeps the order of txns in block.
+		err = batch.Set(blockScopedKey(blockTxnPrefix, blockHash, uint64(i)), txnHash.Bytes())
+		if err != nil {
+			return StorageIO("set txns", err)
+		}
+	}
+	err := batch.Write()
+	if err != nil {
+		return StorageIO("set txns", err)
+	}
+	return nil
+}
+
+func (bb *KvBlockBase) GetEvents(blockHash Hash) ([]*Event, error) {
+	events := make([]*Event, 0)
+	err := bb.rangeResults(eventPrefix, blockHash, func(byt []byte) error {
+		event := &Event{}
+		err := event.Decode(byt)
+		if err != nil {
+			return StorageIO("decode event", err)
+		}
+		events = append(events, event)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (bb *KvBlockBase) SetEvents(events []*Event) error {
+	bb.lock.Lock()
+	defer bb.lock.Unlock()
+	seq, err := bb.getResultSeq()
+	if err != nil {
+		return err
+	}
+	batch := bb.db.NewBatch()
+	for _, event := range events {
+		byt, err := event.Encode()
+		if err != nil {
+			return err
+		}
+		seq++
+		key := blockScopedKey(eventPrefix, event.BlockHash, seq)
+		err = batch.Set(key, byt)
+		if err != nil {
+			return StorageIO("set events", err)
+		}
+		for _, indexKey := range eventIndexes.keys(event.TripodName, event.ExecName, event.Caller, event.Height, seq) {
+			err = batch.Set(indexKey, key)
+			if err != nil {
+				return StorageIO("set events", err)
+			}
+		}
+	}
+	err = batch.Set(resultSeqKey, uint64Bytes(seq))
+	if err != nil {
+		return StorageIO("set events", err)
+	}
+	err = batch.Write()
+	if err != nil {
+		return StorageIO("set events", err)
+	}
+	return nil
+}
+
+func (bb *KvBlockBase) GetErrors(blockHash Hash) ([]*Error, error) {
+	errs := make([]*Error, 0)
+	err := bb.rangeResults(errorPrefix, blockHash, func(byt []byte) error {
+		e := &Error{}
+		err := e.Decode(byt)
+		if err != nil {
+			return StorageIO("decode error", err)
+		}
+		errs = append(errs, e)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return errs, nil
+}
+
+func (bb *KvBlockBase) SetError(e *Error) error {
+	if e == nil {
+		return nil
+	}
+	byt, err := e.Encode()
+	if err != nil {
+		return err
+	}
+
+	bb.lock.Lock()
+	defer bb.lock.Unlock()
+	seq, err := bb.getResultSeq()
+	if err != nil {
+		return err
+	}
+	seq++
+	batch := bb.db.NewBatch()
+	key := blockScopedKey(errorPrefix, e.BlockHash, seq)
+	err = batch.Set(key, byt)
+	if err != nil {
+		return StorageIO("set error", err)
+	}
+	for _, indexKey := range errorIndexes.keys(e.TripodName, e.ExecName, e.Caller, e.Height, seq) {
+		err = batch.Set(indexKey, key)
+		if err != nil {
+			return StorageIO("set error", err)
+		}
+	}
+	err = batch.Set(resultSeqKey, uint64Bytes(seq))
+	if err != nil {
+		return StorageIO("set error", err)
+	}
+	err = batch.Write()
+	if err != nil {
+		return StorageIO("set error", err)
+	}
+	return nil
+}
+
+func (bb *KvBlockBase) QueryEvents(filter *Filter) ([]*Event, error) {
+	results, err := bb.queryResults(eventIndexes, filter, func(byt []byte) (interface{}, bool, error) {
+		event := &Event{}
+		err := event.Decode(byt)
+		if err != nil {
+			return nil, false, StorageIO("decode event", err)
+		}
+		return event, filter.MatchEvent(event), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	events := make([]*Event, 0, len(results))
+	for _, result := range results {
+		events = append(events, result.(*Event))
+	}
+	return events, nil
+}
+
+func (bb *KvBlockBase) QueryErrors(filter *Filter) ([]*Error, error) {
+	results, err := bb.queryResults(errorIndexes, filter, func(byt []byte) (interface{}, bool, error) {
+		e := &Error{}
+		err := e.Decode(byt)
+		if err != nil {
+			return nil, false, StorageIO("decode error", err)
+		}
+		return e, filter.MatchError(e), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	errs := make([]*Error, 0, len(results))
+	for _, result := range results {
+		errs = append(errs, result.(*Error))
+	}
+	return errs, nil
+}
+
+// queryResults walks the most selective index of filter from its start height,
+// decodes the results and keeps the matched ones in the page of filter.
+func (bb *KvBlockBase) queryResults(
+	indexes *resultIndexes,
+	filter *Filter,
+	decode func([]byte) (result interface{}, matched bool, err error),
+) ([]interface{}, error) {
+	prefix := indexes.scope(filter)
+	iter, err := bb.db.IterFrom(prefix, heightScopedPrefix(prefix, filter.StartHeight))
+	if err != nil {
+		return nil, StorageIO("query results", err)
+	}
+	defer iter.Close()
+
+	var (
+		results []interface{}
+		skipped int
+	)
+	for iter.Valid() {
+		if filter.Limit > 0 && len(results) >= filter.Limit {
+			break
+		}
+		indexKey, key, err := iter.Entry()
+		if err != nil {
+			return nil, StorageIO("query results", err)
+		}
+		height := BlockNum(binary.BigEndian.Uint64(indexKey[len(prefix):]))
+		if filter.EndHeight > 0 && height > filter.EndHeight {
+			break
+		}
+		byt, err := bb.db.Get(key)
+		if err != nil {
+			return nil, StorageIO("query results", err)
+		}
+		result, matched, err := decode(byt)
+		if err != nil {
+			return nil, err
+		}
+		if matched {
+			if skipped < filter.Offset {
+				skipped++
+			} else {
+				results = append(results, result)
+			}
+		}
+		err = iter.Next()
+		if err != nil {
+			return nil, StorageIO("query results", err)
+		}
+	}
+	return results, nil
+}
+
+func (bb *KvBlockBase) GetReceipt(txnHash Hash) (*Receipt, error) {
+	byt, err := bb.db.Get(receiptKey(txnHash))
+	if err != nil {
+		return nil, StorageIO("get receipt", err)
+	}
+	if byt == nil {
+		return nil, ReceiptNotFound(txnHash)
+	}
+	receipt := &Receipt{}
+	err = receipt.Decode(byt)
+	if err != nil {
+		return nil, StorageIO("decode receipt", err)
+	}
+	return receipt, nil
+}
+
+func (bb *KvBlockBase) GetReceipts(blockHash Hash) ([]*Receipt, error) {
+	receipts := make([]*Receipt, 0)
+	err := bb.rangeResults(blockReceiptPrefix, blockHash, func(txnHash []byte) error {
+		receipt, err := bb.GetReceipt(BytesToHash(txnHash))
+		if err != nil {
+			return err
+		}
+		receipts = append(receipts, receipt)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return receipts, nil
+}
+
+func (bb *KvBlockBase) SetReceipts(blockHash Hash, receipts []*Receipt) error {
+	batch := bb.db.NewBatch()
+	for i, receipt := range receipts {
+		byt, err := receipt.Encode()
+		if err != nil {
+			return err
+		}
+		err = batch.Set(receiptKey(receipt.TxnHash), byt)
+		if err != nil {
+			return StorageIO("set receipts", err)
+		}
+		err = batch.Set(blockScopedKey(blockReceiptPrefix, blockHash, uint64(i)), receipt.TxnHash.Bytes())
+		if err != nil {
+			return StorageIO("set receipts", err)
+		}
+	}
+	err := batch.Write()
+	if err != nil {
+		return StorageIO("set receipts", err)
+	}
+	return nil
+}
+
+func (bb *KvBlockBase) DeleteResults(blockHash Hash) error {
+	bb.lock.Lock()
+	defer bb.lock.Unlock()
+	batch := bb.db.NewBatch()
+
+	err := bb.rangeEntries(blockScopedPrefix(eventPrefix, blockHash), func(key, byt []byte) error {
+		event := &Event{}
+		err := event.Decode(byt)
+		if err != nil {
+			return StorageIO("decode event", err)
+		}
+		return deleteResult(batch, eventIndexes.keys(event.TripodName, event.ExecName, event.Caller, event.Height, resultSeq(key)), key)
+	})
+	if err != nil {
+		return err
+	}
+	err = bb.rangeEntries(blockScopedPrefix(errorPrefix, blockHash), func(key, byt []byte) error {
+		e := &Error{}
+		err := e.Decode(byt)
+		if err != nil {
+			return StorageIO("decode error", err)
+		}
+		return deleteResult(batch, errorIndexes.keys(e.TripodName, e.ExecName, e.Caller, e.Height, resultSeq(key)), key)
+	})
+	if err != nil {
+		return err
+	}
+	err = bb.rangeEntries(blockScopedPrefix(blockReceiptPrefix, blockHash), func(key, txnHash []byte) error {
+		receipt, err := bb.GetReceipt(BytesToHash(txnHash))
+		if err != nil {
+			return err
+		}
+		// the receipts of the txns re-executed in other blocks have been overwritten.
+		if receipt.BlockHash == blockHash {
+			err = batch.Delete(receiptKey(receipt.TxnHash))
+			if err != nil {
+				return StorageIO("delete results", err)
+			}
+		}
+		return batch.Delete(CopyBytes(key))
+	})
+	if err != nil {
+		return err
+	}
+
+	err = batch.Write()
+	if err != nil {
+		return StorageIO("delete results", err)
+	}
+	return nil
+}
+
+// deleteResult deletes the event or error of key and its index keys.
+func deleteResult(batch kv.Batch, indexKeys [][]byte, key []byte) error {
+	for _, indexKey := range indexKeys {
+		err := batch.Delete(indexKey)
+		if err != nil {
+			return StorageIO("delete results", err)
+		}
+	}
+	// the key is only valid during the iteration on some KVs.
+	err := batch.Delete(CopyBytes(key))
+	if err != nil {
+		return StorageIO("delete results", err)
+	}
+	return nil
+}
+
+func (bb *KvBlockBase) getResultSeq() (uint64, error) {
+	byt, err := bb.db.Get(resultSeqKey)
+	if err != nil {
+		return 0, StorageIO("get result seq", err)
+	}
+	if byt == nil {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(byt), nil
+}
+
+// rangeResults calls fn with the values of block under prefix in the order they are set.
+func (bb *KvBlockBase) rangeResults(prefix []byte, blockHash Hash, fn func([]byte) error) error {
+	return bb.rangeEntries(blockScopedPrefix(prefix, blockHash), func(_, value []byte) error {
+		return fn(value)
+	})
+}
+
+// rangeEntries calls fn with the keys and values under prefix in the order of keys.
+func (bb *KvBlockBase) rangeEntries(prefix []byte, fn func(key, value []byte) error) error {
+	iter, err := bb.db.Iter(prefix)
+	if err != nil {
+		return StorageIO("iterate results", err)
+	}
+	defer iter.Close()
+
+	for iter.Valid() {
+		key, value, err := iter.Entry()
+		if err != nil {
+			return StorageIO("iterate results", err)
+		}
+		err = fn(key, value)
+		if err != nil {
+			return err
+		}
+		err = iter.Next()
+		if err != nil {
+			return StorageIO("iterate results", err)
+		}
+	}
+	return nil
+}
+
+func txnKey(txnHash Hash) []byte {
+	return append(append([]byte{}, txnPrefix...), txnHash.Bytes()...)
+}
+
+func receiptKey(txnHash Hash) []byte {
+	return append(append([]byte{}, receiptPrefix...), txnHash.Bytes()...)
+}
+
+// resultIndexes are the prefixes of the indexes of events or errors.
+// Every index key is scope | uint64BE(height) | uint64BE(seq),
+// so the results in a scope are sorted by height and then seq.
+type resultIndexes struct {
+	height []byte
+	tripod []byte
+	exec   []byte
+	caller []byte
+}
+
+// keys returns the keys of a result in all the indexes.
+func (ri *resultIndexes) keys(tripodName, execName string, caller Address, height BlockNum, seq uint64) [][]byte {
+	return [][]byte{
+		heightScopedKey(ri.height, height, seq),
+		heightScopedKey(ri.tripodScope(tripodName), height, seq),
+		heightScopedKey(ri.execScope(tripodName, execName), height, seq),
+		heightScopedKey(ri.callerScope(caller), height, seq),
+	}
+}
+
+// scope returns the scope of the index with the fewest results matching filter.
+func (ri *resultIndexes) scope(filter *Filter) []byte {
+	switch {
+	case filter.Caller != NullAddress:
+		return ri.callerScope(filter.Caller)
+	case filter.TripodName != "" && filter.ExecName != "":
+		return ri.execScope(filter.TripodName, filter.ExecName)
+	case filter.TripodName != "":
+		return ri.tripodScope(filter.TripodName)
+	default:
+		return ri.height
+	}
+}
+
+func (ri *resultIndexes) tripodScope(tripodName string) []byte {
+	return append(append([]byte{}, ri.tripod...), nameBytes(tripodName)...)
+}
+
+func (ri *resultIndexes) execScope(tripodName, execName string) []byte {
+	scope := append(append([]byte{}, ri.exec...), nameBytes(tripodName)...)
+	return append(scope, nameBytes(execName)...)
+}
+
+func (ri *resultIndexes) callerScope(caller Address) []byte {
+	return append(append([]byte{}, ri.caller...), caller.Bytes()...)
+}
+
+// nameBytes is uint16BE(len(name)) | name, so a name is never the prefix of another one in keys.
+func nameBytes(name string) []byte {
+	byt := make([]byte, 2, 2+len(name))
+	binary.BigEndian.PutUint16(byt, uint16(len(name)))
+	return append(byt, name...)
+}
+
+// heightScopedKey is prefix | uint64BE(height) | uint64BE(seq), so the keys are sorted by height and then seq.
+func heightScopedKey(prefix []byte, height BlockNum, seq uint64) []byte {
+	return append(heightScopedPrefix(prefix, height), uint64Bytes(seq)...)
+}
+
+func heightScopedPrefix(prefix []byte, height BlockNum) []byte {
+	return append(append([]byte{}, prefix...), uint64Bytes(uint64(height))...)
+}
+
+// resultSeq returns the seq at the end of the key of an event or error.
+func resultSeq(key []byte) uint64 {
+	return binary.BigEndian.Uint64(key[len(key)-8:])
+}
+
+func blockScopedPrefix(prefix []byte, blockHash Hash) []byte {
+	return append(append([]byte{}, prefix...), blockHash.Bytes()...)
+}
+
+// blockScopedKey is prefix | blockHash | uint64BE(seq), so the keys of a block are sorted by seq.
+func blockScopedKey(prefix []byte, blockHash Hash, seq uint64) []byte {
+	return append(blockScopedPrefix(prefix, blockHash), uint64Bytes(seq)...)
+}
+
+func uint64Bytes(u uint64) []byte {
+	byt := make([]byte, 8)
+	binary.BigEndian.PutUint64(byt, u)
+	return byt
+}
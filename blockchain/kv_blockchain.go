@@ -0,0 +1,528 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	"github.com/Lawliet-Chan/yu/storage/kv"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"sync"
+)
+
+// Keys of KvBlockChain:
+// block-{hash}                  => encoded block
+// height-{height}{hash}         => nil
+// parent-{prevHash}{hash}       => nil
+// finalized-{height}{hash}      => nil
+// leaf-{hash}                   => nil, the blocks without children
+// p2p-{height}{hash}            => encoded block from P2P
+// last-finalized                => hash of the finalized block with max height
+var (
+	blockPrefix     = []byte("block-")
+	heightPrefix    = []byte("height-")
+	parentPrefix    = []byte("parent-")
+	finalizedPrefix = []byte("finalized-")
+	leafPrefix      = []byte("leaf-")
+	p2pBlockPrefix  = []byte("p2p-")
+
+	lastFinalizedKey = []byte("last-finalized")
+)
+
+// KvBlockChain is the IBlockChain on kv.KV, for embedded deployments without a SQL database.
+type KvBlockChain struct {
+	// guards the read-modify-write of leaves and last-finalized
+	lock       sync.Mutex
+	db         kv.KV
+	forkChoice ForkChoice
+}
+
+func NewKvBlockChain(cfg *config.BlockchainConf) (*KvBlockChain, error) {
+	forkChoice, err := NewForkChoice(cfg.ConvergeType)
+	if err != nil {
+		return nil, err
+	}
+	db, err := kv.NewKV(&cfg.ChainKV)
+	if err != nil {
+		return nil, err
+	}
+	return &KvBlockChain{
+		db:         db,
+		forkChoice: forkChoice,
+	}, nil
+}
+
+func (bc *KvBlockChain) ConvergeType() ConvergeType {
+	return bc.forkChoice.ConvergeType()
+}
+
+func (bc *KvBlockChain) NewEmptyBlock() IBlock {
+	return &Block{Header: &Header{}}
+}
+
+func (bc *KvBlockChain) EncodeBlocks(blocks []IBlock) ([]byte, error) {
+	return encodeBlocks(blocks)
+}
+
+func (bc *KvBlockChain) DecodeBlocks(data []byte) ([]IBlock, error) {
+	return decodeBlocks(data)
+}
+
+func (bc *KvBlockChain) GetGenesis() (IBlock, error) {
+	hashes, err := bc.hashesByPrefix(heightKey(heightPrefix, 0, nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(hashes) == 0 {
+		return nil, BlockNotFound(NullHash)
+	}
+	return bc.GetBlock(hashes[0])
+}
+
+func (bc *KvBlockChain) SetGenesis(b IBlock) error {
+	hashes, err := bc.hashesByPrefix(heightKey(heightPrefix, 0, nil))
+	if err != nil {
+		return err
+	}
+	if len(hashes) == 0 {
+		return bc.AppendBlock(b)
+	}
+	return nil
+}
+
+// pending a block from other BlockChain-node for validating
+func (bc *KvBlockChain) InsertBlockFromP2P(b IBlock) error {
+	if bc.ExistsBlock(b.GetHash()) {
+		return nil
+	}
+	key := heightKey(p2pBlockPrefix, b.GetHeight(), b.GetHash().Bytes())
+	if bc.db.Exist(key) {
+		return DuplicateBlock(b.GetHash())
+	}
+	byt, err := b.Encode()
+	if err != nil {
+		return err
+	}
+	err = bc.db.Set(key, byt)
+	if err != nil {
+		return StorageIO("insert block from p2p", err)
+	}
+	return nil
+}
+
+func (bc *KvBlockChain) TakeP2pBlocksBefore(height BlockNum) (map[BlockNum][]IBlock, error) {
+	blocks, keys, err := bc.p2pBlocks(p2pBlockPrefix, func(h BlockNum) bool {
+		return h < height
+	})
+	if err != nil {
+		return nil, err
+	}
+	hBlocks := make(map[BlockNum][]IBlock, 0)
+	for _, block := range blocks {
+		h := block.GetHeight()
+		hBlocks[h] = append(hBlocks[h], block)
+	}
+	return hBlocks, bc.deleteKeys(keys)
+}
+
+func (bc *KvBlockChain) TakeP2pBlocks(height BlockNum) ([]IBlock, error) {
+	blocks, keys, err := bc.p2pBlocks(heightKey(p2pBlockPrefix, height, nil), func(BlockNum) bool {
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return blocks, bc.deleteKeys(keys)
+}
+
+func (bc *KvBlockChain) AppendBlock(b IBlock) error {
+	if bc.ExistsBlock(b.GetHash()) {
+		return nil
+	}
+	err := fillTotalWeight(bc, b)
+	if err != nil {
+		return err
+	}
+	return bc.writeBlock(nil, b)
+}
+
+func (bc *KvBlockChain) ExistsBlock(blockHash Hash) bool {
+	return bc.db.Exist(blockKey(blockHash))
+}
+
+func (bc *KvBlockChain) GetBlock(blockHash Hash) (IBlock, error) {
+	byt, err := bc.db.Get(blockKey(blockHash))
+	if err != nil {
+		return nil, StorageIO("get block", err)
+	}
+	if byt == nil {
+		return nil, BlockNotFound(blockHash)
+	}
+	return decodeBlock(byt)
+}
+
+func (bc *KvBlockChain) UpdateBlock(b IBlock) error {
+	old, err := bc.GetBlock(b.GetHash())
+	if err != nil {
+		return err
+	}
+	return bc.writeBlock(old, b)
+}
+
+func (bc *KvBlockChain) Children(prevBlockHash Hash) ([]IBlock, error) {
+	hashes, err := bc.hashesByPrefix(parentKey(prevBlockHash, nil))
+	if err != nil {
+		return nil, err
+	}
+	return bc.getBlocks(hashes)
+}
+
+func (bc *KvBlockChain) Leaves() ([]IBlock, error) {
+	hashes, err := bc.hashesByPrefix(leafPrefix)
+	if err != nil {
+		return nil, err
+	}
+	return bc.getBlocks(hashes)
+}
+
+func (bc *KvBlockChain) Finalize(blockHash Hash) error {
+	block, err := bc.GetBlock(blockHash)
+	if err != nil {
+		return err
+	}
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	batch := bc.db.NewBatch()
+	err = batch.Set(heightKey(finalizedPrefix, block.GetHeight(), blockHash.Bytes()), nil)
+	if err != nil {
+		return StorageIO("finalize block", err)
+	}
+	last, err := bc.getByHashKey(lastFinalizedKey)
+	if err != nil {
+		return err
+	}
+	if last == nil || block.GetHeight() >= last.GetHeight() {
+		err = batch.Set(lastFinalizedKey, blockHash.Bytes())
+		if err != nil {
+			return StorageIO("finalize block", err)
+		}
+	}
+	err = batch.Write()
+	if err != nil {
+		return StorageIO("finalize block", err)
+	}
+	return nil
+}
+
+func (bc *KvBlockChain) LastFinalized() (IBlock, error) {
+	block, err := bc.getByHashKey(lastFinalizedKey)
+	if err != nil {
+		return nil, err
+	}
+	if block == nil {
+		return nil, BlockNotFound(NullHash)
+	}
+	return block, nil
+}
+
+func (bc *KvBlockChain) GetEndBlock() (IBlock, error) {
+	leaves, err := bc.Leaves()
+	if err != nil {
+		return nil, err
+	}
+	return bc.forkChoice.ChooseHead(bc, leaves)
+}
+
+func (bc *KvBlockChain) GetAllBlocks() ([]IBlock, error) {
+	iter, err := bc.db.Iter(blockPrefix)
+	if err != nil {
+		return nil, StorageIO("get all blocks", err)
+	}
+	defer iter.Close()
+
+	var blocks []IBlock
+	for iter.Valid() {
+		_, value, err := iter.Entry()
+		if err != nil {
+			return nil, StorageIO("get all blocks", err)
+		}
+		block, err := decodeBlock(value)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+		err = iter.Next()
+		if err != nil {
+			return nil, StorageIO("get all blocks", err)
+		}
+	}
+	return blocks, nil
+}
+
+func (bc *KvBlockChain) GetRangeBlocks(startHeight, endHeight BlockNum) ([]IBlock, error) {
+	iter, err := bc.db.Iter(heightPrefix)
+	if err != nil {
+		return nil, StorageIO("get range blocks", err)
+	}
+	defer iter.Close()
+
+	var hashes []Hash
+	for iter.Valid() {
+		key, _, err := iter.Entry()
+		if err != nil {
+			return nil, StorageIO("get range blocks", err)
+		}
+		height, hash := splitHeightKey(heightPrefix, key)
+		if height > endHeight {
+			break
+		}
+		if height >= startHeight {
+			hashes = append(hashes, hash)
+		}
+		err = iter.Next()
+		if err != nil {
+			return nil, StorageIO("get range blocks", err)
+		}
+	}
+	return bc.getBlocks(hashes)
+}
+
+func (bc *KvBlockChain) Chain() (IChainStruct, error) {
+	return bc.LongestChain()
+}
+
+func (bc *KvBlockChain) LongestChain() (IChainStruct, error) {
+	return longestChain(bc)
+}
+
+func (bc *KvBlockChain) HeaviestChains() ([]IChainStruct, error) {
+	blocks, err := bc.GetAllBlocks()
+	if err != nil {
+		return nil, err
+	}
+	return MakeHeaviestChain(blocks), nil
+}
+
+func (bc *KvBlockChain) FinalizedChain() (IChainStruct, error) {
+	hashes, err := bc.hashesByPrefix(finalizedPrefix)
+	if err != nil {
+		return nil, err
+	}
+	if len(hashes) == 0 {
+		return nil, BlockNotFound(NullHash)
+	}
+	blocks, err := bc.getBlocks(hashes)
+	if err != nil {
+		return nil, err
+	}
+	return MakeFinalizedChain(blocks), nil
+}
+
+// writeBlock writes the block and its indexes atomically,
+// the indexes of old are removed if old is not nil.
+func (bc *KvBlockChain) writeBlock(old, b IBlock) error {
+	byt, err := b.Encode()
+	if err != nil {
+		return err
+	}
+
+	bc.lock.Lock()
+	defer bc.lock.Unlock()
+	// the blocks are only written under the lock, so the children read
+	// before the txn do not change until it commits.
+	isLeaf := false
+	if old == nil {
+		children, err := bc.hashesByPrefix(parentKey(b.GetHash(), nil))
+		if err != nil {
+			return err
+		}
+		isLeaf = len(children) == 0
+	}
+	txn, err := bc.db.NewKvTxn()
+	if err != nil {
+		return StorageIO("write block", err)
+	}
+	err = bc.indexBlock(txn, old, b, byt, isLeaf)
+	if err != nil {
+		txn.Rollback()
+		return err
+	}
+	err = txn.Commit()
+	if err != nil {
+		return StorageIO("write block", err)
+	}
+	return nil
+}
+
+func (bc *KvBlockChain) indexBlock(txn kv.KvTxn, old, b IBlock, byt []byte, isLeaf bool) error {
+	hash := b.GetHash()
+	if old != nil {
+		err := txn.Delete(heightKey(heightPrefix, old.GetHeight(), hash.Bytes()))
+		if err != nil {
+			return StorageIO("write block", err)
+		}
+		err = txn.Delete(parentKey(old.GetPrevHash(), hash.Bytes()))
+		if err != nil {
+			return StorageIO("write block", err)
+		}
+	}
+	err := txn.Set(blockKey(hash), byt)
+	if err != nil {
+		return StorageIO("write block", err)
+	}
+	err = txn.Set(heightKey(heightPrefix, b.GetHeight(), hash.Bytes()), nil)
+	if err != nil {
+		return StorageIO("write block", err)
+	}
+	err = txn.Set(parentKey(b.GetPrevHash(), hash.Bytes()), nil)
+	if err != nil {
+		return StorageIO("write block", err)
+	}
+
+	if old != nil {
+		return nil
+	}
+	// a new block is a leaf unless its children come before it.
+	if isLeaf {
+		err = txn.Set(leafKey(hash), nil)
+		if err != nil {
+			return StorageIO("write block", err)
+		}
+	}
+	err = txn.Delete(leafKey(b.GetPrevHash()))
+	if err != nil {
+		return StorageIO("write block", err)
+	}
+	return nil
+}
+
+// getByHashKey returns the block whose hash is the value of key, or nil if key not exists.
+func (bc *KvBlockChain) getByHashKey(key []byte) (IBlock, error) {
+	hash, err := bc.db.Get(key)
+	if err != nil {
+		return nil, StorageIO("get block", err)
+	}
+	if hash == nil {
+		return nil, nil
+	}
+	return bc.GetBlock(BytesToHash(hash))
+}
+
+func (bc *KvBlockChain) getBlocks(hashes []Hash) ([]IBlock, error) {
+	var blocks []IBlock
+	for _, hash := range hashes {
+		block, err := bc.GetBlock(hash)
+		if err != nil {
+			return nil, err
+		}
+		blocks = append(blocks, block)
+	}
+	return blocks, nil
+}
+
+// hashesByPrefix returns the block hashes at the end of the keys beginning with prefix.
+func (bc *KvBlockChain) hashesByPrefix(prefix []byte) ([]Hash, error) {
+	iter, err := bc.db.Iter(prefix)
+	if err != nil {
+		return nil, StorageIO("iterate blocks", err)
+	}
+	defer iter.Close()
+
+	var hashes []Hash
+	for iter.Valid() {
+		key, _, err := iter.Entry()
+		if err != nil {
+			return nil, StorageIO("iterate blocks", err)
+		}
+		hashes = append(hashes, BytesToHash(key[len(key)-HashLen:]))
+		err = iter.Next()
+		if err != nil {
+			return nil, StorageIO("iterate blocks", err)
+		}
+	}
+	return hashes, nil
+}
+
+func (bc *KvBlockChain) p2pBlocks(prefix []byte, want func(BlockNum) bool) ([]IBlock, [][]byte, error) {
+	iter, err := bc.db.Iter(prefix)
+	if err != nil {
+		return nil, nil, StorageIO("iterate p2p blocks", err)
+	}
+	defer iter.Close()
+
+	var (
+		blocks []IBlock
+		keys   [][]byte
+	)
+	for iter.Valid() {
+		key, value, err := iter.Entry()
+		if err != nil {
+			return nil, nil, StorageIO("iterate p2p blocks", err)
+		}
+		height, _ := splitHeightKey(p2pBlockPrefix, key)
+		if !want(height) {
+			break
+		}
+		block, err := decodeBlock(value)
+		if err != nil {
+			return nil, nil, err
+		}
+		blocks = append(blocks, block)
+		keys = append(keys, key)
+		err = iter.Next()
+		if err != nil {
+			return nil, nil, StorageIO("iterate p2p blocks", err)
+		}
+	}
+	return blocks, keys, nil
+}
+
+func (bc *KvBlockChain) deleteKeys(keys [][]byte) error {
+	batch := bc.db.NewBatch()
+	for _, key := range keys {
+		err := batch.Delete(key)
+		if err != nil {
+			return StorageIO("delete p2p blocks", err)
+		}
+	}
+	err := batch.Write()
+	if err != nil {
+		return StorageIO("delete p2p blocks", err)
+	}
+	return nil
+}
+
+func decodeBlock(byt []byte) (IBlock, error) {
+	block, err := (&Block{}).Decode(byt)
+	if err != nil {
+		return nil, StorageIO("decode block", err)
+	}
+	return block, nil
+}
+
+func blockKey(hash Hash) []byte {
+	return append(append([]byte{}, blockPrefix...), hash.Bytes()...)
+}
+
+func leafKey(hash Hash) []byte {
+	return append(append([]byte{}, leafPrefix...), hash.Bytes()...)
+}
+
+func parentKey(prevHash Hash, hash []byte) []byte {
+	key := append(append([]byte{}, parentPrefix...), prevHash.Bytes()...)
+	return append(key, hash...)
+}
+
+// heightKey is prefix | uint64BE(height) | hash, so the keys are sorted by height.
+func heightKey(prefix []byte, height BlockNum, hash []byte) []byte {
+	key := make([]byte, len(prefix)+8, len(prefix)+8+len(hash))
+	copy(key, prefix)
+	binary.BigEndian.PutUint64(key[len(prefix):], uint64(height))
+	return append(key, hash...)
+}
+
+func splitHeightKey(prefix, key []byte) (BlockNum, Hash) {
+	key = bytes.TrimPrefix(key, prefix)
+	return BlockNum(binary.BigEndian.Uint64(key[:8])), BytesToHash(key[8:])
+}
@@ -0,0 +1,30 @@
+package blockchain
+
+import (
+	"github.com/Lawliet-Chan/yu/config"
+	"github.com/Lawliet-Chan/yu/yerror"
+)
+
+// LoadBlockChain opens the IBlockChain on the backend of cfg.StoreType.
+func LoadBlockChain(cfg *config.BlockchainConf) (IBlockChain, error) {
+	switch cfg.StoreType {
+	case config.SqlStore, "":
+		return NewBlockChain(cfg)
+	case config.KvStore:
+		return NewKvBlockChain(cfg)
+	default:
+		return nil, yerror.NoBlockStoreType
+	}
+}
+
+// LoadBlockBase opens the IBlockBase on the backend of cfg.StoreType.
+func LoadBlockBase(cfg *config.BlockBaseConf) (IBlockBase, error) {
+	switch cfg.StoreType {
+	case config.SqlStore, "":
+		return NewBlockBase(cfg)
+	case config.KvStore:
+		return NewKvBlockBase(&cfg.BaseKV)
+	default:
+		return nil, yerror.NoBlockStoreType
+	}
+}
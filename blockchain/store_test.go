@@ -0,0 +1,807 @@
+package blockchain
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/keypair"
+	. "github.com/Lawliet-Chan/yu/result"
+	. "github.com/Lawliet-Chan/yu/txn"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// both backends must pass the same interface suite.
+var chainStores = map[string]func(name, convergeType string) (IBlockChain, func(), error){
+	config.SqlStore: func(name, convergeType string) (IBlockChain, func(), error) {
+		chainPath, p2pPath := "./test_chain_"+name+".db", "./test_p2p_"+name+".db"
+		chain, err := LoadBlockChain(&config.BlockchainConf{
+			StoreType:       config.SqlStore,
+			ConvergeType:    convergeType,
+			ChainDB:         config.SqlDbConf{SqlDbType: "sqlite", Dsn: chainPath},
+			BlocksFromP2pDB: config.SqlDbConf{SqlDbType: "sqlite", Dsn: p2pPath},
+		})
+		return chain, func() {
+			os.RemoveAll(chainPath)
+			os.RemoveAll(p2pPath)
+		}, err
+	},
+	config.KvStore: func(_, convergeType string) (IBlockChain, func(), error) {
+		chain, err := LoadBlockChain(&config.BlockchainConf{
+			StoreType:    config.KvStore,
+			ConvergeType: convergeType,
+			ChainKV:      config.KVconf{KvType: "memory"},
+		})
+		return chain, func() {}, err
+	},
+}
+
+var baseStores = map[string]func(name string) (IBlockBase, func(), error){
+	config.SqlStore: func(name string) (IBlockBase, func(), error) {
+		path := "./test_base_" + name + ".db"
+		base, err := LoadBlockBase(&config.BlockBaseConf{
+			StoreType: config.SqlStore,
+			BaseDB:    config.SqlDbConf{SqlDbType: "sqlite", Dsn: path},
+		})
+		return base, func() { os.RemoveAll(path) }, err
+	},
+	config.KvStore: func(string) (IBlockBase, func(), error) {
+		base, err := LoadBlockBase(&config.BlockBaseConf{
+			StoreType: config.KvStore,
+			BaseKV:    config.KVconf{KvType: "memory"},
+		})
+		return base, func() {}, err
+	},
+}
+
+func TestBlockChainStores(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	suite := map[string]func(*testing.T, IBlockChain){
+		"Blocks":    testBlocks,
+		"P2pBlocks": testP2pBlocks,
+		"NotFound":  testBlockNotFound,
+		"Ancestor":  testCommonAncestor,
+		"Signature": testBlockSignature,
+	}
+	for storeType, open := range chainStores {
+		for name, fn := range suite {
+			open, fn := open, fn
+			t.Run(storeType+"/"+name, func(t *testing.T) {
+				chain, clean, err := open(name, config.LongestConverge)
+				defer clean()
+				if err != nil {
+					t.Fatalf("load blockchain error: %s", err.Error())
+				}
+				fn(t, chain)
+			})
+		}
+	}
+}
+
+func TestBlockBaseStores(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	for storeType, open := range baseStores {
+		open := open
+		t.Run(storeType, func(t *testing.T) {
+			base, clean, err := open("txns_results")
+			defer clean()
+			if err != nil {
+				t.Fatalf("load blockbase error: %s", err.Error())
+			}
+			testTxnsAndResults(t, base)
+			testReceipts(t, base)
+			testDeleteResults(t, base)
+
+			_, err = base.GetTxn(HexToHash("0x1234"))
+			if _, ok := err.(ErrTxnNotFound); !ok {
+				t.Fatalf("get unknown txn error: %v", err)
+			}
+		})
+	}
+}
+
+func TestQueryResults(t *testing.T) {
+	for storeType, open := range baseStores {
+		open := open
+		t.Run(storeType, func(t *testing.T) {
+			base, clean, err := open("query_results")
+			defer clean()
+			if err != nil {
+				t.Fatalf("load blockbase error: %s", err.Error())
+			}
+			testQueryResults(t, base)
+		})
+	}
+}
+
+func testBlocks(t *testing.T, chain IBlockChain) {
+	genesis := newTestBlock(0, NullHash, 1, "genesis")
+	b1 := newTestBlock(1, genesis.GetHash(), 2, "b1")
+	b2 := newTestBlock(2, b1.GetHash(), 3, "b2")
+	fork := newTestBlock(2, b1.GetHash(), 2, "fork")
+
+	for _, b := range []IBlock{genesis, b1, b2, fork} {
+		err := chain.SetGenesis(b)
+		if err != nil {
+			t.Fatalf("set genesis error: %s", err.Error())
+		}
+		err = chain.AppendBlock(b)
+		if err != nil {
+			t.Fatalf("append block error: %s", err.Error())
+		}
+	}
+	// appending an existing block changes nothing.
+	err := chain.AppendBlock(b1)
+	if err != nil {
+		t.Fatalf("append existing block error: %s", err.Error())
+	}
+
+	got, err := chain.GetGenesis()
+	if err != nil {
+		t.Fatalf("get genesis error: %s", err.Error())
+	}
+	assertBlock(t, got, genesis)
+
+	got, err = chain.GetBlock(b2.GetHash())
+	if err != nil {
+		t.Fatalf("get block error: %s", err.Error())
+	}
+	assertBlock(t, got, b2)
+	if !chain.ExistsBlock(fork.GetHash()) {
+		t.Fatal("fork block not exists")
+	}
+	if chain.ExistsBlock(HexToHash("0x1234")) {
+		t.Fatal("unknown block exists")
+	}
+
+	got, err = chain.GetEndBlock()
+	if err != nil {
+		t.Fatalf("get end block error: %s", err.Error())
+	}
+	assertBlock(t, got, b2)
+
+	children, err := chain.Children(b1.GetHash())
+	if err != nil {
+		t.Fatalf("get children error: %s", err.Error())
+	}
+	assertHashes(t, children, b2, fork)
+
+	blocks, err := chain.GetRangeBlocks(1, 2)
+	if err != nil {
+		t.Fatalf("get range blocks error: %s", err.Error())
+	}
+	assertHashes(t, blocks, b1, b2, fork)
+
+	blocks, err = chain.GetAllBlocks()
+	if err != nil {
+		t.Fatalf("get all blocks error: %s", err.Error())
+	}
+	assertHashes(t, blocks, genesis, b1, b2, fork)
+
+	cs, err := chain.Chain()
+	if err != nil {
+		t.Fatalf("get chain error: %s", err.Error())
+	}
+	var onChain []IBlock
+	cs.Range(func(block IBlock) error {
+		onChain = append(onChain, block)
+		return nil
+	})
+	if len(onChain) != 3 || onChain[0].GetHash() != genesis.GetHash() || onChain[2].GetHash() != b2.GetHash() {
+		t.Fatalf("chain has %d blocks", len(onChain))
+	}
+
+	err = chain.Finalize(b1.GetHash())
+	if err != nil {
+		t.Fatalf("finalize error: %s", err.Error())
+	}
+	got, err = chain.LastFinalized()
+	if err != nil {
+		t.Fatalf("get last finalized error: %s", err.Error())
+	}
+	assertBlock(t, got, b1)
+
+	b2.SetStateRoot(HexToHash("0xabcd"))
+	err = chain.UpdateBlock(b2)
+	if err != nil {
+		t.Fatalf("update block error: %s", err.Error())
+	}
+	got, err = chain.GetBlock(b2.GetHash())
+	if err != nil {
+		t.Fatalf("get block error: %s", err.Error())
+	}
+	assertBlock(t, got, b2)
+}
+
+func testP2pBlocks(t *testing.T, chain IBlockChain) {
+	b5 := newTestBlock(5, NullHash, 5, "p2p-5")
+	b6 := newTestBlock(6, b5.GetHash(), 6, "p2p-6")
+	b7 := newTestBlock(7, b6.GetHash(), 7, "p2p-7")
+	for _, b := range []IBlock{b5, b6, b7} {
+		err := chain.InsertBlockFromP2P(b)
+		if err != nil {
+			t.Fatalf("insert block from p2p error: %s", err.Error())
+		}
+	}
+
+	blocks, err := chain.TakeP2pBlocks(6)
+	if err != nil {
+		t.Fatalf("take p2p blocks error: %s", err.Error())
+	}
+	assertHashes(t, blocks, b6)
+
+	hBlocks, err := chain.TakeP2pBlocksBefore(7)
+	if err != nil {
+		t.Fatalf("take p2p blocks before error: %s", err.Error())
+	}
+	if len(hBlocks) != 1 {
+		t.Fatalf("take p2p blocks of %d heights", len(hBlocks))
+	}
+	assertHashes(t, hBlocks[5], b5)
+
+	// taken blocks are removed.
+	blocks, err = chain.TakeP2pBlocks(5)
+	if err != nil {
+		t.Fatalf("take p2p blocks error: %s", err.Error())
+	}
+	assertHashes(t, blocks)
+}
+
+func testBlockNotFound(t *testing.T, chain IBlockChain) {
+	_, err := chain.GetEndBlock()
+	if _, ok := err.(ErrBlockNotFound); !ok {
+		t.Fatalf("get end block of empty chain error: %v", err)
+	}
+
+	unknown := newTestBlock(1, NullHash, 1, "unknown")
+	_, err = chain.GetBlock(unknown.GetHash())
+	if _, ok := err.(ErrBlockNotFound); !ok {
+		t.Fatalf("get unknown block error: %v", err)
+	}
+	err = chain.UpdateBlock(unknown)
+	if _, ok := err.(ErrBlockNotFound); !ok {
+		t.Fatalf("update unknown block error: %v", err)
+	}
+	err = chain.Finalize(unknown.GetHash())
+	if _, ok := err.(ErrBlockNotFound); !ok {
+		t.Fatalf("finalize unknown block error: %v", err)
+	}
+
+	err = chain.InsertBlockFromP2P(unknown)
+	if err != nil {
+		t.Fatalf("insert block from p2p error: %s", err.Error())
+	}
+	err = chain.InsertBlockFromP2P(unknown)
+	if _, ok := err.(ErrDuplicateBlock); !ok {
+		t.Fatalf("insert duplicate block from p2p error: %v", err)
+	}
+}
+
+func TestSqlStorageIO(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	chain, clean, err := chainStores[config.SqlStore]("storage_io", config.LongestConverge)
+	defer clean()
+	if err != nil {
+		t.Fatalf("load blockchain error: %s", err.Error())
+	}
+	// a broken DB must not look like an unknown block.
+	err = chain.(*BlockChain).chain.Db().Migrator().DropTable(&BlocksScheme{})
+	if err != nil {
+		t.Fatalf("drop table error: %s", err.Error())
+	}
+	_, err = chain.GetBlock(HexToHash("0x1234"))
+	if _, ok := err.(ErrStorageIO); !ok {
+		t.Fatalf("get block from broken DB error: %v", err)
+	}
+	err = chain.AppendBlock(newTestBlock(0, NullHash, 1, "genesis"))
+	if _, ok := err.(ErrStorageIO); !ok {
+		t.Fatalf("append block into broken DB error: %v", err)
+	}
+}
+
+func TestForkChoice(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	suite := map[string]func(*testing.T, IBlockChain){
+		config.LongestConverge:  testLongestChoice,
+		config.HeaviestConverge: testHeaviestChoice,
+		config.FinalizeConverge: testFinalizeChoice,
+	}
+	for storeType, open := range chainStores {
+		for convergeType, fn := range suite {
+			open, convergeType, fn := open, convergeType, fn
+			t.Run(storeType+"/"+convergeType, func(t *testing.T) {
+				chain, clean, err := open("fork_"+convergeType, convergeType)
+				defer clean()
+				if err != nil {
+					t.Fatalf("load blockchain error: %s", err.Error())
+				}
+				fn(t, chain)
+			})
+		}
+	}
+}
+
+// forkTree appends the light and long fork genesis-a1-a2-a3,
+// and the heavy and short fork genesis-b1.
+func forkTree(t *testing.T, chain IBlockChain) (genesis, a1, a2, a3, b1 *Block) {
+	genesis = newWeightedBlock(0, NullHash, 1, 1, "genesis")
+	a1 = newWeightedBlock(1, genesis.GetHash(), 2, 1, "a1")
+	a2 = newWeightedBlock(2, a1.GetHash(), 3, 1, "a2")
+	a3 = newWeightedBlock(3, a2.GetHash(), 4, 1, "a3")
+	b1 = newWeightedBlock(1, genesis.GetHash(), 2, 10, "b1")
+	for _, b := range []*Block{genesis, b1, a1, a2, a3} {
+		appendBlock(t, chain, b)
+	}
+	return
+}
+
+func testCommonAncestor(t *testing.T, chain IBlockChain) {
+	genesis, a1, a2, a3, b1 := forkTree(t, chain)
+	ancestor, aBranch, bBranch, err := CommonAncestor(chain, a3, b1)
+	if err != nil {
+		t.Fatalf("find common ancestor error: %s", err.Error())
+	}
+	assertBlock(t, ancestor, genesis)
+	assertBranch(t, aBranch, a1, a2, a3)
+	assertBranch(t, bBranch, b1)
+
+	ancestor, aBranch, bBranch, err = CommonAncestor(chain, a1, a3)
+	if err != nil {
+		t.Fatalf("find common ancestor error: %s", err.Error())
+	}
+	assertBlock(t, ancestor, a1)
+	assertBranch(t, aBranch)
+	assertBranch(t, bBranch, a2, a3)
+
+	orphan := newTestBlock(2, HexToHash("0x01"), 3, "orphan")
+	appendBlock(t, chain, orphan)
+	_, _, _, err = CommonAncestor(chain, orphan, a3)
+	if _, ok := err.(ErrBlockNotFound); !ok {
+		t.Fatalf("find common ancestor of orphan block, error: %v", err)
+	}
+}
+
+func testBlockSignature(t *testing.T, chain IBlockChain) {
+	_, privkey, err := GenKeyPair(Ed25519)
+	if err != nil {
+		t.Fatalf("generate key error: %s", err.Error())
+	}
+	producers := []PubKey{privkey.PubKey()}
+	genesis := newTestBlock(0, NullHash, 1, "genesis")
+	err = genesis.VerifySignature(producers)
+	if _, ok := err.(ErrBlockSignatureIllegal); !ok {
+		t.Fatalf("verify unsigned block, error: %v", err)
+	}
+
+	err = genesis.Sign(privkey)
+	if err != nil {
+		t.Fatalf("sign block error: %s", err.Error())
+	}
+	appendBlock(t, chain, genesis)
+	got, err := chain.GetBlock(genesis.GetHash())
+	if err != nil {
+		t.Fatalf("get block error: %s", err.Error())
+	}
+	err = got.VerifySignature(producers)
+	if err != nil {
+		t.Fatalf("verify stored block error: %s", err.Error())
+	}
+
+	// the signature does not match a forged hash.
+	got.SetHash(Keccak256Hash([]byte("forged")))
+	err = got.VerifySignature(producers)
+	if _, ok := err.(ErrBlockSignatureIllegal); !ok {
+		t.Fatalf("verify forged block, error: %v", err)
+	}
+}
+
+// assertBranch checks blocks are the wants in order.
+func assertBranch(t *testing.T, blocks []IBlock, wants ...IBlock) {
+	if len(blocks) != len(wants) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(wants))
+	}
+	for i, want := range wants {
+		assertBlock(t, blocks[i], want)
+	}
+}
+
+func testLongestChoice(t *testing.T, chain IBlockChain) {
+	if chain.ConvergeType() != Longest {
+		t.Fatalf("converge type is %d", chain.ConvergeType())
+	}
+	genesis := newWeightedBlock(0, NullHash, 1, 1, "genesis")
+	b1 := newWeightedBlock(1, genesis.GetHash(), 2, 10, "b1")
+	appendBlock(t, chain, genesis)
+	appendBlock(t, chain, b1)
+	assertEndBlock(t, chain, b1)
+
+	// the end block switches to the longer fork.
+	a1 := newWeightedBlock(1, genesis.GetHash(), 2, 1, "a1")
+	a2 := newWeightedBlock(2, a1.GetHash(), 3, 1, "a2")
+	appendBlock(t, chain, a1)
+	appendBlock(t, chain, a2)
+	assertEndBlock(t, chain, a2)
+
+	leaves, err := chain.Leaves()
+	if err != nil {
+		t.Fatalf("get leaves error: %s", err.Error())
+	}
+	assertHashes(t, leaves, b1, a2)
+}
+
+func testHeaviestChoice(t *testing.T, chain IBlockChain) {
+	if chain.ConvergeType() != Heaviest {
+		t.Fatalf("converge type is %d", chain.ConvergeType())
+	}
+	_, _, _, a3, b1 := forkTree(t, chain)
+	assertEndBlock(t, chain, b1)
+
+	got, err := chain.GetBlock(a3.GetHash())
+	if err != nil {
+		t.Fatalf("get block error: %s", err.Error())
+	}
+	if got.(*Block).TotalWeight != 4 {
+		t.Fatalf("total weight of a3 is %d", got.(*Block).TotalWeight)
+	}
+
+	// a4 makes the fork of a heavier.
+	a4 := newWeightedBlock(4, a3.GetHash(), 5, 8, "a4")
+	appendBlock(t, chain, a4)
+	assertEndBlock(t, chain, a4)
+}
+
+func testFinalizeChoice(t *testing.T, chain IBlockChain) {
+	if chain.ConvergeType() != Finalize {
+		t.Fatalf("converge type is %d", chain.ConvergeType())
+	}
+	_, _, _, a3, b1 := forkTree(t, chain)
+	// the longest one is chosen before any finalized block.
+	assertEndBlock(t, chain, a3)
+
+	err := chain.Finalize(b1.GetHash())
+	if err != nil {
+		t.Fatalf("finalize error: %s", err.Error())
+	}
+	assertEndBlock(t, chain, b1)
+
+	b2 := newWeightedBlock(2, b1.GetHash(), 3, 1, "b2")
+	appendBlock(t, chain, b2)
+	assertEndBlock(t, chain, b2)
+}
+
+func appendBlock(t *testing.T, chain IBlockChain, b IBlock) {
+	err := chain.AppendBlock(b)
+	if err != nil {
+		t.Fatalf("append block(%s) error: %s", b.GetHash().String(), err.Error())
+	}
+}
+
+func assertEndBlock(t *testing.T, chain IBlockChain, want IBlock) {
+	got, err := chain.GetEndBlock()
+	if err != nil {
+		t.Fatalf("get end block error: %s", err.Error())
+	}
+	assertBlock(t, got, want)
+}
+
+func newWeightedBlock(height BlockNum, prevHash Hash, length, weight uint64, salt string) *Block {
+	block := newTestBlock(height, prevHash, length, salt)
+	block.SetWeight(weight)
+	return block
+}
+
+func testTxnsAndResults(t *testing.T, base IBlockBase) {
+	pubkey, privkey, err := GenKeyPair(Sr25519)
+	if err != nil {
+		t.Fatalf("generate key error: %s", err.Error())
+	}
+	var txns []*SignedTxn
+	for i := 0; i < 3; i++ {
+		istr := strconv.Itoa(i)
+		ecall := &Ecall{
+			TripodName: istr,
+			ExecName:   istr,
+			Params:     JsonString(istr),
+		}
+		raw, err := NewUnsignedTxn(pubkey.Address(), ecall, uint64(i), 0, 0, uint64(i))
+		if err != nil {
+			t.Fatalf("new UnsignedTxn error: %s", err.Error())
+		}
+		data, err := raw.SignBytes(0)
+		if err != nil {
+			t.Fatalf("get sign bytes error: %s", err.Error())
+		}
+		sig, err := privkey.SignData(data)
+		if err != nil {
+			t.Fatalf("sign data error: %s", err.Error())
+		}
+		stxn, err := NewSignedTxn(raw, pubkey, sig)
+		if err != nil {
+			t.Fatalf("new SignedTxn error: %s", err.Error())
+		}
+		txns = append(txns, stxn)
+	}
+
+	blockHash := HexToHash("0x01")
+	err = base.SetTxns(blockHash, txns[:2])
+	if err != nil {
+		t.Fatalf("set txns error: %s", err.Error())
+	}
+	err = base.SetTxn(txns[2])
+	if err != nil {
+		t.Fatalf("set txn error: %s", err.Error())
+	}
+
+	stxn, err := base.GetTxn(txns[2].GetTxnHash())
+	if err != nil {
+		t.Fatalf("get txn error: %s", err.Error())
+	}
+	if stxn.GetTxnHash() != txns[2].GetTxnHash() || !stxn.GetPubkey().Equals(pubkey) {
+		t.Fatalf("get txn(%s)", stxn.GetTxnHash().String())
+	}
+	stxns, err := base.GetTxns(blockHash)
+	if err != nil {
+		t.Fatalf("get txns error: %s", err.Error())
+	}
+	if len(stxns) != 2 || stxns[0].GetTxnHash() != txns[0].GetTxnHash() || stxns[1].GetTxnHash() != txns[1].GetTxnHash() {
+		t.Fatalf("get %d txns of block", len(stxns))
+	}
+
+	events := []*Event{
+		{BlockHash: blockHash, Height: 1, TripodName: "asset", ExecName: "Transfer", Value: "first"},
+		{BlockHash: blockHash, Height: 1, TripodName: "asset", ExecName: "Transfer", Value: "second"},
+		{BlockHash: HexToHash("0x02"), Height: 2, TripodName: "asset", ExecName: "Transfer", Value: "other"},
+	}
+	err = base.SetEvents(events)
+	if err != nil {
+		t.Fatalf("set events error: %s", err.Error())
+	}
+	gotEvents, err := base.GetEvents(blockHash)
+	if err != nil {
+		t.Fatalf("get events error: %s", err.Error())
+	}
+	if len(gotEvents) != 2 || gotEvents[0].Value != "first" || gotEvents[1].Value != "second" {
+		t.Fatalf("get %d events of block", len(gotEvents))
+	}
+
+	err = base.SetError(&Error{BlockHash: blockHash, Height: 1, TripodName: "asset", Err: "out of balance"})
+	if err != nil {
+		t.Fatalf("set error error: %s", err.Error())
+	}
+	errs, err := base.GetErrors(blockHash)
+	if err != nil {
+		t.Fatalf("get errors error: %s", err.Error())
+	}
+	if len(errs) != 1 || errs[0].Err != "out of balance" {
+		t.Fatalf("get %d errors of block", len(errs))
+	}
+}
+
+func testReceipts(t *testing.T, base IBlockBase) {
+	blockHash := HexToHash("0x0a")
+	txn1, txn2 := HexToHash("0x0b"), HexToHash("0x0c")
+	receipts := []*Receipt{
+		{
+			TxnHash:   txn2,
+			BlockHash: blockHash,
+			Height:    1,
+			Status:    ReceiptSuccess,
+			LeiUsed:   10,
+			Events:    []*Event{{BlockHash: blockHash, TxnHash: txn2, Value: "transferred"}},
+		},
+		{
+			TxnHash:   txn1,
+			BlockHash: blockHash,
+			Height:    1,
+			Status:    ReceiptFailed,
+			Error:     &Error{BlockHash: blockHash, TxnHash: txn1, Err: "out of balance"},
+		},
+	}
+	err := base.SetReceipts(blockHash, receipts)
+	if err != nil {
+		t.Fatalf("set receipts error: %s", err.Error())
+	}
+
+	receipt, err := base.GetReceipt(txn1)
+	if err != nil {
+		t.Fatalf("get receipt error: %s", err.Error())
+	}
+	if receipt.Succeeded() || receipt.Error == nil || receipt.Error.Err != "out of balance" {
+		t.Fatalf("receipt of txn1 is %+v", receipt)
+	}
+
+	// receipts keep the order of txns in block.
+	got, err := base.GetReceipts(blockHash)
+	if err != nil {
+		t.Fatalf("get receipts error: %s", err.Error())
+	}
+	if len(got) != 2 || got[0].TxnHash != txn2 || got[1].TxnHash != txn1 {
+		t.Fatalf("get %d receipts of block", len(got))
+	}
+	if !got[0].Succeeded() || got[0].LeiUsed != 10 || len(got[0].Events) != 1 || got[0].Events[0].TxnHash != txn2 {
+		t.Fatalf("receipt of txn2 is %+v", got[0])
+	}
+
+	root, err := MakeReceiptRoot(got)
+	if err != nil {
+		t.Fatalf("make receipt root error: %s", err.Error())
+	}
+	want, err := MakeReceiptRoot(receipts)
+	if err != nil {
+		t.Fatalf("make receipt root error: %s", err.Error())
+	}
+	if root != want {
+		t.Fatalf("receipt root of stored receipts is %s, want %s", root.String(), want.String())
+	}
+
+	_, err = base.GetReceipt(HexToHash("0x1234"))
+	if _, ok := err.(ErrReceiptNotFound); !ok {
+		t.Fatalf("get unknown receipt error: %v", err)
+	}
+}
+
+func testDeleteResults(t *testing.T, base IBlockBase) {
+	orphan, canonical := HexToHash("0x1a"), HexToHash("0x1b")
+	shared, dropped := HexToHash("0x1c"), HexToHash("0x1d")
+	for _, blockHash := range []Hash{orphan, canonical} {
+		err := base.SetEvents([]*Event{{BlockHash: blockHash, Height: 7, Value: blockHash.String()}})
+		if err != nil {
+			t.Fatalf("set events error: %s", err.Error())
+		}
+		err = base.SetError(&Error{BlockHash: blockHash, Height: 7, Err: blockHash.String()})
+		if err != nil {
+			t.Fatalf("set error error: %s", err.Error())
+		}
+	}
+	err := base.SetReceipts(orphan, []*Receipt{
+		{TxnHash: shared, BlockHash: orphan, Height: 7},
+		{TxnHash: dropped, BlockHash: orphan, Height: 7},
+	})
+	if err != nil {
+		t.Fatalf("set receipts error: %s", err.Error())
+	}
+	// the shared txn is executed again in the canonical block.
+	err = base.SetReceipts(canonical, []*Receipt{{TxnHash: shared, BlockHash: canonical, Height: 7}})
+	if err != nil {
+		t.Fatalf("set receipts error: %s", err.Error())
+	}
+
+	err = base.DeleteResults(orphan)
+	if err != nil {
+		t.Fatalf("delete results error: %s", err.Error())
+	}
+
+	events, err := base.GetEvents(orphan)
+	if err != nil || len(events) != 0 {
+		t.Fatalf("get %d events of orphan block, error: %v", len(events), err)
+	}
+	errs, err := base.GetErrors(orphan)
+	if err != nil || len(errs) != 0 {
+		t.Fatalf("get %d errors of orphan block, error: %v", len(errs), err)
+	}
+	assertEvents(t, base, &Filter{StartHeight: 7, EndHeight: 7}, canonical.String())
+	errs, err = base.QueryErrors(&Filter{StartHeight: 7, EndHeight: 7})
+	if err != nil || len(errs) != 1 || errs[0].BlockHash != canonical {
+		t.Fatalf("query %d errors at height 7, error: %v", len(errs), err)
+	}
+
+	receipt, err := base.GetReceipt(shared)
+	if err != nil || receipt.BlockHash != canonical {
+		t.Fatalf("get receipt of the shared txn: %+v, error: %v", receipt, err)
+	}
+	_, err = base.GetReceipt(dropped)
+	if _, ok := err.(ErrReceiptNotFound); !ok {
+		t.Fatalf("get receipt of the dropped txn, error: %v", err)
+	}
+	receipts, err := base.GetReceipts(orphan)
+	if err != nil || len(receipts) != 0 {
+		t.Fatalf("get %d receipts of orphan block, error: %v", len(receipts), err)
+	}
+}
+
+func testQueryResults(t *testing.T, base IBlockBase) {
+	alice, bob := HexToAddress("0xa1"), HexToAddress("0xb0")
+	// stored out of the order of height.
+	events := []*Event{
+		{Caller: alice, Height: 3, TripodName: "asset", ExecName: "Transfer", Value: "3"},
+		{Caller: alice, Height: 1, TripodName: "asset", ExecName: "Transfer", Value: "1"},
+		{Caller: bob, Height: 2, TripodName: "asset", ExecName: "Transfer", Value: "2"},
+		{Caller: alice, Height: 2, TripodName: "asset", ExecName: "CreateAccount", Value: "2-create"},
+		{Caller: alice, Height: 2, TripodName: "poa", ExecName: "Transfer", Value: "2-poa"},
+		{Caller: alice, Height: 4, TripodName: "asset", ExecName: "Transfer", Value: "4"},
+	}
+	for _, event := range events {
+		err := base.SetEvents([]*Event{event})
+		if err != nil {
+			t.Fatalf("set events error: %s", err.Error())
+		}
+	}
+
+	transfers := &Filter{TripodName: "asset", ExecName: "Transfer", Caller: alice}
+	assertEvents(t, base, transfers, "1", "3", "4")
+
+	transfers.StartHeight, transfers.EndHeight = 2, 3
+	assertEvents(t, base, transfers, "3")
+
+	assertEvents(t, base, &Filter{StartHeight: 2, EndHeight: 2}, "2", "2-create", "2-poa")
+	assertEvents(t, base, &Filter{TripodName: "asset", ExecName: "Transfer"}, "1", "2", "3", "4")
+	assertEvents(t, base, &Filter{TripodName: "asset", StartHeight: 3}, "3", "4")
+	assertEvents(t, base, &Filter{TripodName: "poa"}, "2-poa")
+	assertEvents(t, base, &Filter{Caller: bob, EndHeight: 1})
+	assertEvents(t, base, &Filter{Offset: 1, Limit: 2}, "2", "2-create")
+	assertEvents(t, base, &Filter{Offset: 10})
+
+	for _, e := range []*Error{
+		{Caller: bob, Height: 5, TripodName: "asset", ExecName: "Transfer", Err: "out of balance"},
+		{Caller: alice, Height: 5, TripodName: "asset", ExecName: "Transfer", Err: "no account"},
+	} {
+		err := base.SetError(e)
+		if err != nil {
+			t.Fatalf("set error error: %s", err.Error())
+		}
+	}
+	errs, err := base.QueryErrors(&Filter{Caller: bob})
+	if err != nil {
+		t.Fatalf("query errors error: %s", err.Error())
+	}
+	if len(errs) != 1 || errs[0].Err != "out of balance" {
+		t.Fatalf("query %d errors of bob", len(errs))
+	}
+}
+
+func assertEvents(t *testing.T, base IBlockBase, filter *Filter, wantValues ...string) {
+	events, err := base.QueryEvents(filter)
+	if err != nil {
+		t.Fatalf("query events error: %s", err.Error())
+	}
+	values := make([]string, 0)
+	for _, event := range events {
+		values = append(values, event.Value)
+	}
+	if strings.Join(values, ",") != strings.Join(wantValues, ",") {
+		t.Fatalf("query events %v by %+v, want %v", values, filter, wantValues)
+	}
+}
+
+func newTestBlock(height BlockNum, prevHash Hash, length uint64, salt string) *Block {
+	return &Block{
+		Header: &Header{
+			PrevHash:  prevHash,
+			Hash:      Keccak256Hash([]byte(salt)),
+			Height:    height,
+			StateRoot: Keccak256Hash([]byte("state-" + salt)),
+			Timestamp: uint64(height),
+		},
+		ChainLength: length,
+	}
+}
+
+func assertBlock(t *testing.T, got, want IBlock) {
+	if got.GetHash() != want.GetHash() ||
+		got.GetPrevHash() != want.GetPrevHash() ||
+		got.GetHeight() != want.GetHeight() ||
+		got.GetStateRoot() != want.GetStateRoot() ||
+		got.(*Block).ChainLength != want.(*Block).ChainLength {
+		t.Fatalf("got block(%s) on height %d, want block(%s) on height %d",
+			got.GetHash().String(), got.GetHeight(), want.GetHash().String(), want.GetHeight())
+	}
+}
+
+// assertHashes checks blocks are the wants, ignoring the order.
+func assertHashes(t *testing.T, blocks []IBlock, wants ...IBlock) {
+	if len(blocks) != len(wants) {
+		t.Fatalf("got %d blocks, want %d", len(blocks), len(wants))
+	}
+	hashes := make(map[Hash]bool)
+	for _, b := range blocks {
+		hashes[b.GetHash()] = true
+	}
+	for _, want := range wants {
+		if !hashes[want.GetHash()] {
+			t.Fatalf("block(%s) is missing", want.GetHash().String())
+		}
+	}
+}
@@ -20,6 +20,8 @@ const (
 	ExecuteTxnsStage   = "Execute Txns"
 	EndBlockStage      = "End Block"
 	FinalizeBlockStage = "Finalize Block"
+	// txns are evicted from txpool before being packed
+	TxpoolStage = "Txpool"
 )
 
 type (
@@ -20,6 +20,9 @@ type MasterConf struct {
 
 	LeiLimit uint64 `toml:"lei_limit"`
 
+	// The txns are signed with it, and the peers with another one are rejected.
+	ChainID uint64 `toml:"chain_id"`
+
 	NkDB KVconf `toml:"nk_db"`
 	// when beyond 'Timeout', it means this nodekeeper is down.
 	// Unit is Second.
@@ -36,6 +39,11 @@ type MasterConf struct {
 	P2pListenAddrs []string `toml:"p2p_listen_addrs"`
 	// To connect other hosts as a p2p network.
 	Bootnodes []string `toml:"bootnodes"`
+	// How to sync history from the p2p network:
+	// "full": execute all the history blocks, default.
+	// "state": fetch the history blocks without executing them,
+	// and download the state of the latest block from peers.
+	SyncMode string `toml:"sync_mode"`
 
 	ProtocolID string `toml:"protocol_id"`
 	// 0: RSA
@@ -52,8 +60,20 @@ type MasterConf struct {
 	NodeKeyBits int `toml:"node_key_bits"`
 	// When use param 'NodeKey', 'NodeKeyFile' will not work.
 	NodeKeyFile string `toml:"node_key_file"`
+
+	// The private key to sign the blocks produced by this node,
+	// hex string with the key type. A random sr25519 key is used if it is empty.
+	ProducerKey string `toml:"producer_key"`
+	// The pubkeys(hex string with the key type) of the producers whose blocks are accepted
+	// from the p2p network. The pubkey of 'ProducerKey' is always trusted.
+	TrustedProducers []string `toml:"trusted_producers"`
 }
 
+const (
+	FullSync  = "full"
+	StateSync = "state"
+)
+
 //type WorkerConf struct {
 //	Name           string `toml:"name"`
 //	DB             KVconf `toml:"db"`
@@ -90,19 +110,56 @@ type MasterConf struct {
 //	HeartbeatGap int    `toml:"heartbeat_gap"`
 //}
 
+// the backends of BlockChain and BlockBase.
+const (
+	SqlStore = "sql"
+	KvStore  = "kv"
+)
+
+// the fork choice rules of BlockChain.
+const (
+	LongestConverge  = "longest"
+	HeaviestConverge = "heaviest"
+	FinalizeConverge = "finalize"
+)
+
 type BlockchainConf struct {
+	// "sql" or "kv", default is "sql"
+	StoreType string `toml:"store_type"`
+	// "longest", "heaviest" or "finalize", default is "longest"
+	ConvergeType string `toml:"converge_type"`
+
 	ChainDB         SqlDbConf `toml:"chain_db"`
 	BlocksFromP2pDB SqlDbConf `toml:"blocks_from_p2p_db"`
+	// used when store_type is "kv"
+	ChainKV KVconf `toml:"chain_kv"`
 }
 
 type BlockBaseConf struct {
+	// "sql" or "kv", default is "sql"
+	StoreType string `toml:"store_type"`
+
 	BaseDB SqlDbConf `toml:"base_db"`
+	// used when store_type is "kv"
+	BaseKV KVconf `toml:"base_kv"`
 }
 
+// the orderings of txpool.
+const (
+	FifoPool     = "fifo"
+	PriorityPool = "priority"
+)
+
 type TxpoolConf struct {
+	// "fifo" or "priority", default is "fifo"
+	PoolType   string `toml:"pool_type"`
 	PoolSize   uint64 `toml:"pool_size"`
 	TxnMaxSize int    `toml:"txn_max_size"`
-	Timeout    int    `toml:"timeout"`
+	// the unpacked txns staying longer are evicted, 0 means never.
+	// Unit is Second.
+	Timeout int `toml:"timeout"`
+	// keeps the txns in pool across restarts, disabled if kv_type is empty.
+	Journal KVconf `toml:"journal"`
 	// In local-node mode, this will be null.
 	WorkerIP string `toml:"worker_ip"`
 }
@@ -7,4 +7,27 @@ type StateConf struct {
 type StateKvConf struct {
 	IndexDB  KVconf `toml:"index_db"`
 	NodeBase KVconf `toml:"node_base"`
+	// the number of decoded trie nodes cached in memory, 0 disables the cache.
+	NodeCacheSize int `toml:"node_cache_size"`
+
+	Prune PruneConf `toml:"prune"`
 }
+
+const (
+	// keep the states of all blocks.
+	ArchiveMode = "archive"
+	// only keep the states of the latest 'KeepBlocks' blocks.
+	PruneMode = "prune"
+)
+
+type PruneConf struct {
+	// "archive" or "prune", default is "archive".
+	Mode string `toml:"mode"`
+	// the number of latest blocks whose states are kept in 'prune' mode, at least 1.
+	KeepBlocks uint64 `toml:"keep_blocks"`
+	// sweep the trie nodes of the pruned states every 'GcInterval' blocks.
+	// A sweep walks all the trie nodes, so 0 means DefaultGcInterval rather than every block.
+	GcInterval uint64 `toml:"gc_interval"`
+}
+
+const DefaultGcInterval uint64 = 1000
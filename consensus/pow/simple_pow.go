@@ -51,6 +51,12 @@ func Validate(block IBlock, target *big.Int, targetBits int64) bool {
 	return hashInt.Cmp(target) == -1
 }
 
+// Weight is the weight of the block proven with targetBits,
+// the heaviest chain has the most cumulative difficulty.
+func Weight(targetBits int64) uint64 {
+	return uint64(targetBits)
+}
+
 func prepareData(block IBlock, nonce, targetBits int64) ([]byte, error) {
 	num := block.GetTimestamp()
 	hex1, err := intToHex(int64(num))
@@ -15,6 +15,19 @@ type Context struct {
 	paramsStr JsonString
 	Events    []*Event
 	Error     *Error
+
+	// Only used by Query. If NeedProof is true, Query should
+	// attach the proofs of the states it reads into Proofs.
+	NeedProof bool
+	Proofs    []*StateProof
+}
+
+// StateProof proves the Value of Key in Tripod against the StateRoot of a block.
+type StateProof struct {
+	TripodName string   `json:"tripod_name"`
+	Key        []byte   `json:"key"`
+	Value      []byte   `json:"value"`
+	Nodes      [][]byte `json:"nodes"`
 }
 
 func NewContext(caller Address, paramsStr JsonString) (*Context, error) {
@@ -46,6 +59,15 @@ func (c *Context) EmitEvent(value interface{}) error {
 	return nil
 }
 
+func (c *Context) AttachProof(tripodName string, key, value []byte, nodes [][]byte) {
+	c.Proofs = append(c.Proofs, &StateProof{
+		TripodName: tripodName,
+		Key:        key,
+		Value:      value,
+		Nodes:      nodes,
+	})
+}
+
 func (c *Context) EmitError(e error) {
 	c.Error = &Error{
 		Err: e.Error(),
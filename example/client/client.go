@@ -8,13 +8,18 @@ import (
 	. "github.com/Lawliet-Chan/yu/keypair"
 	. "github.com/Lawliet-Chan/yu/node"
 	. "github.com/Lawliet-Chan/yu/result"
+	. "github.com/Lawliet-Chan/yu/txn"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	ytime "github.com/Lawliet-Chan/yu/utils/time"
 	"github.com/gorilla/websocket"
 	"github.com/sirupsen/logrus"
 	"net/url"
+	"strconv"
 	"time"
 )
 
 func main() {
+	codec.GlobalCodec = &codec.RlpCodec{}
 
 	pubkey, privkey, err := GenKeyPair(Sr25519)
 	if err != nil {
@@ -132,8 +137,22 @@ func callChainByQry(addr Address, qcall *Qcall) {
 	logrus.Infof("get account(%s) balance(%d)", addr.String(), amount)
 }
 
+// nonce of the only account sending txns, it starts from 0 on a new chain.
+var nonce uint64
+
+// chainID is the chain_id in the config of master.
+const chainID = 0
+
 func callChainByExec(privkey PrivKey, pubkey PubKey, ecall *Ecall) {
-	signByt, err := privkey.SignData(ecall.Bytes())
+	raw, err := NewUnsignedTxn(pubkey.Address(), ecall, nonce, 0, 0, ytime.NowNanoTsU64())
+	if err != nil {
+		panic("new unsigned txn error: " + err.Error())
+	}
+	data, err := raw.SignBytes(chainID)
+	if err != nil {
+		panic("get sign bytes error: " + err.Error())
+	}
+	signByt, err := privkey.SignData(data)
 	if err != nil {
 		panic("sign data error: " + err.Error())
 	}
@@ -145,6 +164,11 @@ func callChainByExec(privkey PrivKey, pubkey PubKey, ecall *Ecall) {
 	q.Set(AddressKey, pubkey.Address().String())
 	q.Set(SignatureKey, ToHex(signByt))
 	q.Set(PubkeyKey, pubkey.StringWithType())
+	q.Set(NonceKey, strconv.FormatUint(raw.Nonce, 10))
+	q.Set(TipKey, strconv.FormatUint(raw.Tip, 10))
+	q.Set(ValidUntilKey, strconv.FormatUint(uint64(raw.ValidUntil), 10))
+	q.Set(TimestampKey, strconv.FormatUint(raw.Timestamp, 10))
+	nonce++
 
 	u.RawQuery = q.Encode()
 
@@ -182,6 +206,8 @@ func subEvent() {
 			logrus.Info(result.(*Event).Sprint())
 		case ErrorType:
 			logrus.Error(result.(*Error).Error())
+		case ReorgType:
+			logrus.Warn(result.(*Reorg).Sprint())
 		}
 	}
 }
@@ -6,11 +6,12 @@ require (
 	github.com/BurntSushi/toml v0.3.1
 	github.com/HyperService-Consortium/go-hexutil v1.0.1
 	github.com/HyperService-Consortium/go-rlp v1.0.2
-	github.com/cockroachdb/pebble v0.0.0-20201210152317-024096017eda // indirect
+	github.com/cockroachdb/pebble v0.0.0-20201210152317-024096017eda
 	github.com/dgraph-io/badger v1.6.2
 	github.com/ethereum/go-ethereum v1.10.3
 	github.com/gin-gonic/gin v1.6.3
 	github.com/gorilla/websocket v1.4.2
+	github.com/hashicorp/golang-lru v0.5.5-0.20210104140557-80c98217689d
 	github.com/jackc/pgproto3/v2 v2.0.7 // indirect
 	github.com/jinzhu/now v1.1.2 // indirect
 	github.com/libp2p/go-libp2p v0.13.0
@@ -23,7 +24,7 @@ require (
 	github.com/pkg/errors v0.9.1
 	github.com/sirupsen/logrus v1.7.0
 	github.com/tendermint/tendermint v0.34.0
-	github.com/xuperchain/xupercore v0.0.0-20210727025644-b21e3796e679 // indirect
+	github.com/xuperchain/xupercore v0.0.0-20210727025644-b21e3796e679
 	go.etcd.io/bbolt v1.3.5
 	golang.org/x/crypto v0.0.0-20210322153248-0c34fe9e7dc2
 	golang.org/x/net v0.0.0-20210226172049-e18ecbb05110 // indirect
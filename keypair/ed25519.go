@@ -58,6 +58,14 @@ type EdPrivkey struct {
 	privkey ed25519.PrivKey
 }
 
+func EdPrivKeyFromBytes(data []byte) *EdPrivkey {
+	return &EdPrivkey{privkey: data}
+}
+
+func (epr *EdPrivkey) PubKey() PubKey {
+	return &EdPubkey{epr.privkey.PubKey().(ed25519.PubKey)}
+}
+
 func (epr *EdPrivkey) SignData(data []byte) ([]byte, error) {
 	return epr.privkey.Sign(data)
 }
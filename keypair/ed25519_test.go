@@ -26,4 +26,12 @@ func TestEdKey(t *testing.T) {
 		panic("gen pubkey error: " + err.Error())
 	}
 	t.Logf("verify signature result:  %v", genPubkey.VerifySignature(ecall.Bytes(), signByt))
+
+	genPrivkey, err := PrivKeyFromBytes(privkey.BytesWithType())
+	if err != nil {
+		panic("gen privkey error: " + err.Error())
+	}
+	if !genPrivkey.PubKey().Equals(pubkey) {
+		t.Fatalf("pubkey of privkey is %s, want %s", genPrivkey.PubKey().String(), pubkey.String())
+	}
 }
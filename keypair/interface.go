@@ -30,6 +30,9 @@ func GenKeyPair(keyType string) (PubKey, PrivKey, error) {
 
 // data: (keyTypeBytes + keyBytes)
 func PubKeyFromBytes(data []byte) (PubKey, error) {
+	if len(data) <= KeyTypeBytLen {
+		return nil, NoKeyType
+	}
 	keyTypeByt := data[:KeyTypeBytLen]
 	switch string(keyTypeByt) {
 	case Sr25519Idx:
@@ -46,6 +49,27 @@ func PubkeyFromStr(data string) (PubKey, error) {
 	return PubKeyFromBytes(byt)
 }
 
+// data: (keyTypeBytes + keyBytes)
+func PrivKeyFromBytes(data []byte) (PrivKey, error) {
+	if len(data) <= KeyTypeBytLen {
+		return nil, NoKeyType
+	}
+	keyTypeByt := data[:KeyTypeBytLen]
+	switch string(keyTypeByt) {
+	case Sr25519Idx:
+		return SrPrivKeyFromBytes(data[KeyTypeBytLen:]), nil
+	case Ed25519Idx:
+		return EdPrivKeyFromBytes(data[KeyTypeBytLen:]), nil
+	default:
+		return nil, NoKeyType
+	}
+}
+
+func PrivkeyFromStr(data string) (PrivKey, error) {
+	byt := common.FromHex(data)
+	return PrivKeyFromBytes(byt)
+}
+
 type Key interface {
 	Type() string
 	Equals(key Key) bool
@@ -64,5 +88,6 @@ type PubKey interface {
 
 type PrivKey interface {
 	Key
+	PubKey() PubKey
 	SignData([]byte) ([]byte, error)
 }
@@ -58,6 +58,14 @@ type SrPrivkey struct {
 	privkey sr25519.PrivKey
 }
 
+func SrPrivKeyFromBytes(data []byte) *SrPrivkey {
+	return &SrPrivkey{privkey: data}
+}
+
+func (spr *SrPrivkey) PubKey() PubKey {
+	return &SrPubkey{spr.privkey.PubKey().(sr25519.PubKey)}
+}
+
 func (spr *SrPrivkey) SignData(data []byte) ([]byte, error) {
 	return spr.privkey.Sign(data)
 }
@@ -5,6 +5,7 @@ import (
 	"github.com/Lawliet-Chan/yu/chain_env"
 	. "github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/context"
+	. "github.com/Lawliet-Chan/yu/result"
 	. "github.com/Lawliet-Chan/yu/subscribe"
 	. "github.com/Lawliet-Chan/yu/tripod"
 	"github.com/Lawliet-Chan/yu/txn"
@@ -12,14 +13,24 @@ import (
 	"github.com/sirupsen/logrus"
 )
 
+// ExecuteTxns executes the txns of block and sets its state root and receipt root.
+// The blocks from others are signed with their roots, so the recomputed roots MUST equal them,
+// otherwise the state and results of block are dropped and the block is illegal.
 func ExecuteTxns(block IBlock, env *chain_env.ChainEnv, land *Land) error {
 	base := env.Base
 	sub := env.Sub
 
+	signed := len(block.GetSign()) > 0
+	stateRoot, receiptRoot := block.GetStateRoot(), block.GetReceiptRoot()
+
 	stxns, err := base.GetTxns(block.GetHash())
 	if err != nil {
 		return err
 	}
+	receipts := make([]*Receipt, 0, len(stxns))
+	// once the lei of block is out, the rest txns are not executed and their nonces are kept,
+	// but every packed txn still gets a failed receipt.
+	leiOut := false
 	for _, stxn := range stxns {
 		ecall := stxn.GetRaw().GetEcall()
 		ctx, err := context.NewContext(stxn.GetPubkey().Address(), ecall.Params)
@@ -27,24 +38,67 @@ func ExecuteTxns(block IBlock, env *chain_env.ChainEnv, land *Land) error {
 			return err
 		}
 
-		exec, lei, err := land.GetExecLei(ecall)
+		if leiOut {
+			receipt, err := failTxn(yerror.OutOfEnergy, ctx, block, stxn, env)
+			if err != nil {
+				return err
+			}
+			receipts = append(receipts, receipt)
+			continue
+		}
+
+		if stxn.GetRaw().ExpiredAt(block.GetHeight()) {
+			txnErr := yerror.TxnExpired(stxn.GetTxnHash(), stxn.GetRaw().GetValidUntil(), block.GetHeight())
+			receipt, err := failTxn(txnErr, ctx, block, stxn, env)
+			if err != nil {
+				return err
+			}
+			receipts = append(receipts, receipt)
+			continue
+		}
+
+		caller := stxn.GetPubkey().Address()
+		nonce, err := env.GetNonce(caller)
 		if err != nil {
-			handleError(err, ctx, block, stxn, sub)
+			return err
+		}
+		if stxn.GetRaw().GetNonce() != nonce {
+			txnErr := yerror.NonceIllegal(caller, stxn.GetRaw().GetNonce(), nonce)
+			receipt, err := failTxn(txnErr, ctx, block, stxn, env)
+			if err != nil {
+				return err
+			}
+			receipts = append(receipts, receipt)
+			continue
+		}
+
+		exec, lei, txnErr := land.GetExecLei(ecall)
+		if txnErr != nil {
+			bumpNonce(env, caller, nonce)
+			receipt, err := failTxn(txnErr, ctx, block, stxn, env)
+			if err != nil {
+				return err
+			}
+			receipts = append(receipts, receipt)
 			continue
 		}
 
 		if IfLeiOut(lei, block) {
-			handleError(yerror.OutOfEnergy, ctx, block, stxn, sub)
-			break
+			leiOut = true
+			receipt, err := failTxn(yerror.OutOfEnergy, ctx, block, stxn, env)
+			if err != nil {
+				return err
+			}
+			receipts = append(receipts, receipt)
+			continue
 		}
 
 		err = exec(ctx, block, env)
 		if err != nil {
 			env.Discard()
 			handleError(err, ctx, block, stxn, sub)
-		} else {
-			env.NextTxn()
 		}
+		bumpNonce(env, caller, nonce)
 
 		block.UseLei(lei)
 
@@ -58,26 +112,103 @@ func ExecuteTxns(block IBlock, env *chain_env.ChainEnv, land *Land) error {
 		if err != nil {
 			return err
 		}
+		receipts = append(receipts, newReceipt(ctx, block, stxn, lei))
 	}
 
-	stateRoot, err := env.Commit()
+	execStateRoot, err := env.Commit()
+	if err != nil {
+		return err
+	}
+	execReceiptRoot, err := MakeReceiptRoot(receipts)
 	if err != nil {
 		return err
 	}
-	block.SetStateRoot(stateRoot)
+	if signed && (execStateRoot != stateRoot || execReceiptRoot != receiptRoot) {
+		logrus.Errorf(
+			"block(%s) executes to state root(%s) receipt root(%s), but header has state root(%s) receipt root(%s)",
+			block.GetHash().String(), execStateRoot.String(), execReceiptRoot.String(),
+			stateRoot.String(), receiptRoot.String(),
+		)
+		return dropBlock(block, env)
+	}
+
+	err = base.SetReceipts(block.GetHash(), receipts)
+	if err != nil {
+		return err
+	}
+	block.SetStateRoot(execStateRoot)
+	block.SetReceiptRoot(execReceiptRoot)
 
 	return nil
 }
 
+// dropBlock rewinds the state to the parent of block, drops the results of block,
+// and returns BlockIllegal.
+func dropBlock(block IBlock, env *chain_env.ChainEnv) error {
+	parentHash := block.GetPrevHash()
+	_, err := env.StateRoot(parentHash)
+	if _, ok := err.(yerror.ErrStateNotCommitted); ok && block.GetHeight() == 1 {
+		// the genesis block commits no state.
+		err = env.RevertToGenesis(parentHash)
+	} else if err == nil {
+		err = env.RevertToBlock(parentHash)
+	}
+	if err != nil {
+		return err
+	}
+	err = env.Base.DeleteResults(block.GetHash())
+	if err != nil {
+		return err
+	}
+	return yerror.BlockIllegal(block.GetHash())
+}
+
+// bumpNonce increases the nonce of caller for every txn passing the nonce check,
+// even if the txn fails, so it can not be replayed.
+func bumpNonce(env *chain_env.ChainEnv, caller Address, nonce uint64) {
+	env.SetNonce(caller, nonce+1)
+	env.NextTxn()
+}
+
+// failTxn emits err for the txn failing before executing, persists the error
+// and makes its failed receipt.
+func failTxn(err error, ctx *context.Context, block IBlock, stxn *txn.SignedTxn, env *chain_env.ChainEnv) (*Receipt, error) {
+	handleError(err, ctx, block, stxn, env.Sub)
+	err = env.Base.SetError(ctx.Error)
+	if err != nil {
+		return nil, err
+	}
+	return newReceipt(ctx, block, stxn, 0), nil
+}
+
+// newReceipt makes the receipt of stxn after it is executed,
+// the txn fails if any error is emitted.
+func newReceipt(ctx *context.Context, block IBlock, stxn *txn.SignedTxn, leiUsed uint64) *Receipt {
+	status := ReceiptSuccess
+	if ctx.Error != nil {
+		status = ReceiptFailed
+	}
+	return &Receipt{
+		TxnHash:   stxn.GetTxnHash(),
+		BlockHash: block.GetHash(),
+		Height:    block.GetHeight(),
+		Status:    status,
+		LeiUsed:   leiUsed,
+		Events:    ctx.Events,
+		Error:     ctx.Error,
+	}
+}
+
 func handleError(err error, ctx *context.Context, block IBlock, stxn *txn.SignedTxn, sub *Subscription) {
 	ctx.EmitError(err)
 	ecall := stxn.GetRaw().GetEcall()
 
-	ctx.Error.Caller = stxn.GetRaw().GetCaller()
+	ctx.Error.Caller = stxn.GetPubkey().Address()
 	ctx.Error.BlockStage = ExecuteTxnsStage
 	ctx.Error.TripodName = ecall.TripodName
 	ctx.Error.ExecName = ecall.ExecName
 	ctx.Error.BlockHash = block.GetHash()
+	ctx.Error.TxnHash = stxn.GetTxnHash()
 	ctx.Error.Height = block.GetHeight()
 
 	logrus.Error("push error: ", ctx.Error.Error())
@@ -93,10 +224,11 @@ func handleEvent(ctx *context.Context, block IBlock, stxn *txn.SignedTxn, sub *S
 
 		event.Height = block.GetHeight()
 		event.BlockHash = block.GetHash()
+		event.TxnHash = stxn.GetTxnHash()
 		event.ExecName = ecall.ExecName
 		event.TripodName = ecall.TripodName
 		event.BlockStage = ExecuteTxnsStage
-		event.Caller = stxn.GetRaw().GetCaller()
+		event.Caller = stxn.GetPubkey().Address()
 
 		if sub != nil {
 			sub.Push(event)
@@ -0,0 +1,37 @@
+package master
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/result"
+	"github.com/sirupsen/logrus"
+	"time"
+)
+
+const evictTxnsInterval = time.Second
+
+// evictExpiredTxns removes the expired txns from txpool periodically,
+// and reports them to the subscribers as errors.
+func (m *Master) evictExpiredTxns() {
+	ticker := time.NewTicker(evictTxnsInterval)
+	defer ticker.Stop()
+	for range ticker.C {
+		evicted, err := m.txPool.RemoveExpired()
+		if err != nil {
+			logrus.Errorf("remove expired txns error: %s", err.Error())
+			continue
+		}
+		for _, et := range evicted {
+			ecall := et.Txn.GetRaw().GetEcall()
+			e := &Error{
+				Caller:     et.Txn.GetPubkey().Address(),
+				BlockStage: TxpoolStage,
+				TxnHash:    et.Txn.GetTxnHash(),
+				TripodName: ecall.TripodName,
+				ExecName:   ecall.ExecName,
+				Err:        et.Err.Error(),
+			}
+			logrus.Warn(e.Error())
+			m.sub.Push(e)
+		}
+	}
+}
@@ -1,12 +1,16 @@
 package master
 
 import (
+	. "github.com/Lawliet-Chan/yu/blockchain"
 	. "github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/context"
 	. "github.com/Lawliet-Chan/yu/node"
+	"github.com/Lawliet-Chan/yu/trie"
 	. "github.com/Lawliet-Chan/yu/txn"
 	. "github.com/Lawliet-Chan/yu/utils/error_handle"
+	. "github.com/Lawliet-Chan/yu/yerror"
 	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
 	"io"
 	"io/ioutil"
 	"net/http"
@@ -55,6 +59,28 @@ func (m *Master) HandleHttp() {
 		m.handleHttpQry(c)
 	})
 
+	r.GET(StateChangesPath, func(c *gin.Context) {
+		m.handleStateChanges(c)
+	})
+	r.GET(StateSnapshotPath, func(c *gin.Context) {
+		m.handleStateSnapshot(c)
+	})
+	r.GET(ReceiptPath, func(c *gin.Context) {
+		m.handleReceipt(c)
+	})
+	r.GET(TxnProofPath, func(c *gin.Context) {
+		m.handleTxnProof(c)
+	})
+	r.GET(NoncePath, func(c *gin.Context) {
+		m.handleNonce(c)
+	})
+	r.GET(EventsPath, func(c *gin.Context) {
+		m.handleQueryEvents(c)
+	})
+	r.GET(ErrorsPath, func(c *gin.Context) {
+		m.handleQueryErrors(c)
+	})
+
 	r.Run(m.httpPort)
 }
 
@@ -148,6 +174,17 @@ func (m *Master) handleHttpQry(c *gin.Context) {
 			return
 		}
 
+		ctx.NeedProof = GetProve(c.Request)
+		if ctx.NeedProof && qcall.BlockHash == NullHash {
+			// proofs must be against a certain block, use the end block by default.
+			endBlock, err := m.chain.GetEndBlock()
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			qcall.BlockHash = endBlock.GetHash()
+		}
+
 		respObj, err := m.land.Query(qcall, ctx, m.GetEnv())
 		if err != nil {
 			c.String(
@@ -156,11 +193,154 @@ func (m *Master) handleHttpQry(c *gin.Context) {
 			)
 			return
 		}
+
+		if ctx.NeedProof {
+			block, err := m.chain.GetBlock(qcall.BlockHash)
+			if err != nil {
+				c.AbortWithError(http.StatusInternalServerError, err)
+				return
+			}
+			c.JSON(http.StatusOK, &QryRespWithProofs{
+				Result:    respObj,
+				BlockHash: qcall.BlockHash,
+				StateRoot: block.GetStateRoot(),
+				Proofs:    ctx.Proofs,
+			})
+			return
+		}
 		c.JSON(http.StatusOK, respObj)
 	}
 
 }
 
+func (m *Master) handleStateChanges(c *gin.Context) {
+	changeSet, err := m.stateStore.GetChangeSet(GetBlockHash(c.Request))
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, changeSet)
+}
+
+func (m *Master) handleStateSnapshot(c *gin.Context) {
+	blockHash := GetBlockHash(c.Request)
+	c.Header("Content-Type", "application/octet-stream")
+	c.Header("Content-Disposition", "attachment; filename="+blockHash.String()+".snapshot")
+	err := m.exportSnapshot(blockHash, c.Writer)
+	if err == nil {
+		return
+	}
+	if c.Writer.Written() {
+		logrus.Errorf("export state snapshot of block(%s) error: %s", blockHash.String(), err.Error())
+		return
+	}
+	c.Writer.Header().Del("Content-Disposition")
+	c.Header("Content-Type", "text/plain; charset=utf-8")
+	c.String(http.StatusBadRequest, err.Error())
+}
+
+func (m *Master) handleReceipt(c *gin.Context) {
+	receipt, err := m.base.GetReceipt(GetTxnHash(c.Request))
+	if _, ok := err.(ErrReceiptNotFound); ok {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, receipt)
+}
+
+// handleNonce returns the nonce that the next txn of the account must carry.
+func (m *Master) handleNonce(c *gin.Context) {
+	addr := GetAddress(c.Request)
+	nonce, err := m.stateStore.GetNonceByBlockHash(addr, m.stateStore.CanReadBlock())
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, &NonceResp{
+		Address: addr,
+		Nonce:   nonce,
+	})
+}
+
+func (m *Master) handleTxnProof(c *gin.Context) {
+	block, err := m.chain.GetBlock(GetBlockHash(c.Request))
+	if _, ok := err.(ErrBlockNotFound); ok {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	txnHash := GetTxnHash(c.Request)
+	proof, err := MakeTxnProof(block, txnHash)
+	if err != nil {
+		c.String(http.StatusNotFound, err.Error())
+		return
+	}
+	c.JSON(http.StatusOK, &TxnProofResp{
+		BlockHash: block.GetHash(),
+		TxnRoot:   block.GetTxnRoot(),
+		TxnHash:   txnHash,
+		Proof:     proof,
+	})
+}
+
+func (m *Master) handleQueryEvents(c *gin.Context) {
+	filter, err := GetResultFilter(c.Request)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	events, err := m.base.QueryEvents(filter)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, events)
+}
+
+func (m *Master) handleQueryErrors(c *gin.Context) {
+	filter, err := GetResultFilter(c.Request)
+	if err != nil {
+		c.String(http.StatusBadRequest, err.Error())
+		return
+	}
+	errs, err := m.base.QueryErrors(filter)
+	if err != nil {
+		c.AbortWithError(http.StatusInternalServerError, err)
+		return
+	}
+	c.JSON(http.StatusOK, errs)
+}
+
+// QryRespWithProofs is the response of Query when client asks for proofs.
+// Clients verify Proofs against StateRoot, which is in the header of block(BlockHash).
+type QryRespWithProofs struct {
+	Result    interface{}           `json:"result"`
+	BlockHash Hash                  `json:"block_hash"`
+	StateRoot Hash                  `json:"state_root"`
+	Proofs    []*context.StateProof `json:"proofs"`
+}
+
+// TxnProofResp proves TxnHash is in the block(BlockHash),
+// clients verify Proof against TxnRoot by trie.VerifyProof.
+type TxnProofResp struct {
+	BlockHash Hash              `json:"block_hash"`
+	TxnRoot   Hash              `json:"txn_root"`
+	TxnHash   Hash              `json:"txn_hash"`
+	Proof     *trie.MerkleProof `json:"proof"`
+}
+
+type NonceResp struct {
+	Address Address `json:"address"`
+	Nonce   uint64  `json:"nonce"`
+}
+
 func readPostBody(body io.ReadCloser) (JsonString, error) {
 	byt, err := ioutil.ReadAll(body)
 	return JsonString(byt), err
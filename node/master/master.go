@@ -2,11 +2,13 @@ package master
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	. "github.com/Lawliet-Chan/yu/blockchain"
 	. "github.com/Lawliet-Chan/yu/chain_env"
 	. "github.com/Lawliet-Chan/yu/common"
 	. "github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/keypair"
 	. "github.com/Lawliet-Chan/yu/node"
 	. "github.com/Lawliet-Chan/yu/state"
 	"github.com/Lawliet-Chan/yu/storage/kv"
@@ -42,9 +44,18 @@ type Master struct {
 	httpPort string
 	wsPort   string
 	leiLimit uint64
+	chainID  uint64
 
 	timeout time.Duration
 
+	// "full" or "state"
+	syncMode string
+
+	// signs the blocks produced by this node
+	producerKey PrivKey
+	// only the blocks signed by them are accepted
+	producers []PubKey
+
 	chain      IBlockChain
 	base       IBlockBase
 	txPool     ItxPool
@@ -81,13 +92,13 @@ func NewMaster(
 ) (*Master, error) {
 	var err error
 	if chain == nil {
-		chain, err = NewBlockChain(&cfg.BlockChain)
+		chain, err = LoadBlockChain(&cfg.BlockChain)
 		if err != nil {
 			logrus.Panicf("load blockchain error: %s", err.Error())
 		}
 	}
 	if base == nil {
-		base, err = NewBlockBase(&cfg.BlockBase)
+		base, err = LoadBlockBase(&cfg.BlockBase)
 		if err != nil {
 			logrus.Panicf("load blockbase error: %s", err.Error())
 		}
@@ -96,10 +107,33 @@ func NewMaster(
 	if err != nil {
 		logrus.Panicf("load stateKV error: %s", err.Error())
 	}
+	tripodNames := make([]string, 0)
+	land.RangeList(func(tri Tripod) error {
+		tripodNames = append(tripodNames, tri.GetTripodMeta().Name())
+		return nil
+	})
+	err = stateStore.MigrateNamespace(tripodNames)
+	if err != nil {
+		logrus.Panicf("migrate state namespace error: %s", err.Error())
+	}
 
 	if txPool == nil {
-		txPool = LocalWithDefaultChecks(&cfg.Txpool)
+		txPool, err = LoadTxPool(&cfg.Txpool)
+		if err != nil {
+			logrus.Panicf("load txpool error: %s", err.Error())
+		}
 	}
+	txPool.WithChainID(cfg.ChainID)
+	txPool.WithNonceGetter(func(addr Address) (uint64, error) {
+		return stateStore.GetNonceByBlockHash(addr, stateStore.CanReadBlock())
+	})
+	txPool.WithHeightGetter(func() (BlockNum, error) {
+		endBlock, err := chain.GetEndBlock()
+		if err != nil {
+			return 0, err
+		}
+		return endBlock.GetHeight() + 1, nil
+	})
 
 	nkDB, err := kv.NewKV(&cfg.NkDB)
 	if err != nil {
@@ -117,6 +151,15 @@ func NewMaster(
 		return nil, err
 	}
 
+	producerKey, err := loadProducerKey(cfg)
+	if err != nil {
+		return nil, err
+	}
+	producers, err := loadProducers(cfg, producerKey)
+	if err != nil {
+		return nil, err
+	}
+
 	timeout := time.Duration(cfg.Timeout) * time.Second
 
 	m := &Master{
@@ -125,8 +168,10 @@ func NewMaster(
 		protocolID: pid,
 		RunMode:    cfg.RunMode,
 		leiLimit:   cfg.LeiLimit,
+		chainID:    cfg.ChainID,
 		nkDB:       nkDB,
 		timeout:    timeout,
+		syncMode:   cfg.SyncMode,
 		httpPort:   MakePort(cfg.HttpPort),
 		wsPort:     MakePort(cfg.WsPort),
 		chain:      chain,
@@ -134,6 +179,9 @@ func NewMaster(
 		txPool:     txPool,
 		stateStore: stateStore,
 
+		producerKey: producerKey,
+		producers:   producers,
+
 		land: land,
 		sub:  subscribe.NewSubscription(),
 	}
@@ -143,6 +191,11 @@ func NewMaster(
 		return nil, err
 	}
 
+	err = m.txPool.Reload()
+	if err != nil {
+		return nil, err
+	}
+
 	err = m.ConnectP2PNetwork(cfg)
 	if err != nil {
 		return nil, err
@@ -168,6 +221,7 @@ func (m *Master) Startup() {
 		for {
 			err := m.AcceptBlocksFromP2P()
 			if err != nil {
+				exitIfStorageBroken(err)
 				logrus.Errorf("accept blocks error: %s", err.Error())
 			}
 		}
@@ -184,6 +238,8 @@ func (m *Master) Startup() {
 
 	}()
 
+	go m.evictExpiredTxns()
+
 	m.Run()
 }
 
@@ -212,19 +268,19 @@ func (m *Master) AcceptBlocksFromP2P() error {
 	case MasterWorker:
 		// todo: switch MasterWorker Mode
 	case LocalNode:
-		err = m.land.RangeList(func(tri Tripod) error {
-			if tri.VerifyBlock(block, m.GetEnv()) {
-				return nil
-			}
-			return BlockIllegal(block.GetHash())
-		})
+		err = m.verifyBlock(block)
 		if err != nil {
 			return err
 		}
 	}
 
 	logrus.Debugf("accept block(%s) height(%d) from p2p", block.GetHash().String(), block.GetHeight())
-	return m.chain.InsertBlockFromP2P(block)
+	err = m.chain.InsertBlockFromP2P(block)
+	if _, ok := err.(ErrDuplicateBlock); ok {
+		// the same block may be received from several peers.
+		return nil
+	}
+	return err
 }
 
 func (m *Master) AcceptUnpkgTxns() error {
@@ -378,12 +434,7 @@ func (m *Master) SyncHistoryBlocks(blocks []IBlock) error {
 				return err
 			}
 
-			err = m.land.RangeList(func(tri Tripod) error {
-				if tri.VerifyBlock(block, m.GetEnv()) {
-					return nil
-				}
-				return BlockIllegal(block.GetHash())
-			})
+			err = m.verifyBlock(block)
 			if err != nil {
 				return err
 			}
@@ -407,6 +458,20 @@ func (m *Master) SyncHistoryBlocks(blocks []IBlock) error {
 	}
 }
 
+// verifyBlock checks the signature of block producer and then the rules of tripods.
+func (m *Master) verifyBlock(block IBlock) error {
+	err := block.VerifySignature(m.producers)
+	if err != nil {
+		return err
+	}
+	return m.land.RangeList(func(tri Tripod) error {
+		if tri.VerifyBlock(block, m.GetEnv()) {
+			return nil
+		}
+		return BlockIllegal(block.GetHash())
+	})
+}
+
 func (m *Master) GetEnv() *ChainEnv {
 	return &ChainEnv{
 		StateStore: m.stateStore,
@@ -623,3 +688,39 @@ func existTxnHash(txnHash Hash, txns []*SignedTxn) (*SignedTxn, bool) {
 	}
 	return nil, false
 }
+
+// loadProducerKey loads the key to sign the produced blocks,
+// and falls back to a random key when none is configured.
+func loadProducerKey(cfg *MasterConf) (PrivKey, error) {
+	if cfg.ProducerKey != "" {
+		return PrivkeyFromStr(cfg.ProducerKey)
+	}
+	_, privkey, err := GenKeyPair(Sr25519)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Warn("no producer key is configured, sign blocks by a random key")
+	return privkey, nil
+}
+
+// loadProducers loads the pubkeys of the trusted producers, including this node itself.
+func loadProducers(cfg *MasterConf, producerKey PrivKey) ([]PubKey, error) {
+	producers := []PubKey{producerKey.PubKey()}
+	for _, keyStr := range cfg.TrustedProducers {
+		pubkey, err := PubkeyFromStr(keyStr)
+		if err != nil {
+			return nil, err
+		}
+		producers = append(producers, pubkey)
+	}
+	return producers, nil
+}
+
+// exitIfStorageBroken stops the node if the storage of chain fails,
+// going on with a broken storage may fork the chain silently.
+func exitIfStorageBroken(err error) {
+	var ioErr ErrStorageIO
+	if errors.As(err, &ioErr) {
+		logrus.Panicf("storage of chain is broken: %s", err.Error())
+	}
+}
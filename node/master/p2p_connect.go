@@ -72,7 +72,13 @@ func (m *Master) ConnectP2PNetwork(cfg *config.MasterConf) error {
 			var oldErr error
 			for {
 				err := m.handleRequest(s)
+				if err == io.EOF {
+					// the remote closes the stream.
+					s.Close()
+					return
+				}
 				if err != nil && err != oldErr {
+					exitIfStorageBroken(err)
 					logrus.Errorf("handle request from node(%s) error: %s",
 						s.Conn().RemotePeer().Pretty(), err.Error(),
 					)
@@ -149,7 +155,11 @@ func (m *Master) SyncHistory(s network.Stream) error {
 				return err
 			}
 
-			err = m.SyncHistoryBlocks(blocks)
+			if m.syncMode == config.StateSync {
+				err = m.SyncHistoryBlocksWithState(blocks, s.Conn().RemotePeer())
+			} else {
+				err = m.SyncHistoryBlocks(blocks)
+			}
 			if err != nil {
 				return err
 			}
@@ -190,6 +200,8 @@ func (m *Master) handleRequest(s network.Stream) error {
 		return m.handleHsReq(byt, s)
 	case SyncTxnsType:
 		return m.handleSyncTxnsReq(byt, s)
+	case SyncStateType:
+		return m.handleSyncStateReq(byt, s)
 	default:
 		return errors.New("no request type")
 	}
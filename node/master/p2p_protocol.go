@@ -11,6 +11,7 @@ import (
 const (
 	HandshakeType int = iota
 	SyncTxnsType
+	SyncStateType
 
 	RequestTypeBytesLen = 1
 )
@@ -18,6 +19,7 @@ const (
 var (
 	HandshakeReqByt = []byte(strconv.Itoa(HandshakeType))
 	SyncTxnsReqByt  = []byte(strconv.Itoa(SyncTxnsType))
+	SyncStateReqByt = []byte(strconv.Itoa(SyncStateType))
 )
 
 type HandShakeRequest struct {
@@ -54,6 +56,7 @@ func DecodeHsRequest(data []byte) (*HandShakeRequest, error) {
 }
 
 type HandShakeInfo struct {
+	ChainID          uint64
 	GenesisBlockHash Hash
 
 	// when chain is finlaized chain, end block is the finalized block
@@ -73,6 +76,7 @@ func (m *Master) NewHsInfo() (*HandShakeInfo, error) {
 	}
 
 	return &HandShakeInfo{
+		ChainID:          m.chainID,
 		GenesisBlockHash: gBlock.GetHash(),
 		EndHeight:        eBlock.GetHeight(),
 		EndBlockHash:     eBlock.GetHash(),
@@ -81,6 +85,9 @@ func (m *Master) NewHsInfo() (*HandShakeInfo, error) {
 
 // return a BlocksRange if other node's height is lower
 func (hs *HandShakeInfo) Compare(other *HandShakeInfo) (*BlocksRange, error) {
+	if hs.ChainID != other.ChainID {
+		return nil, yerror.ChainIDIllegal
+	}
 	if hs.GenesisBlockHash != other.GenesisBlockHash {
 		return nil, yerror.GenesisBlockIllegal
 	}
@@ -162,3 +169,37 @@ func DecodeTxnsRequest(data []byte) (tr TxnsRequest, err error) {
 	err = json.Unmarshal(data[RequestTypeBytesLen:], &tr)
 	return
 }
+
+// StateNodesRequest fetches the state trie nodes by their hashes.
+type StateNodesRequest struct {
+	Hashes []Hash
+}
+
+func (sr StateNodesRequest) Encode() ([]byte, error) {
+	byt, err := json.Marshal(sr)
+	if err != nil {
+		return nil, err
+	}
+	return append(SyncStateReqByt, byt...), nil
+}
+
+func DecodeStateNodesRequest(data []byte) (sr StateNodesRequest, err error) {
+	err = json.Unmarshal(data[RequestTypeBytesLen:], &sr)
+	return
+}
+
+// StateNodesResp returns the encoded nodes in the order of the request hashes,
+// nil for the nodes the remote does not have.
+type StateNodesResp struct {
+	Nodes [][]byte
+}
+
+func (sr *StateNodesResp) Encode() ([]byte, error) {
+	return json.Marshal(sr)
+}
+
+func DecodeStateNodesResp(data []byte) (*StateNodesResp, error) {
+	var sr StateNodesResp
+	err := json.Unmarshal(data, &sr)
+	return &sr, err
+}
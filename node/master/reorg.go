@@ -0,0 +1,212 @@
+package master
+
+import (
+	. "github.com/Lawliet-Chan/yu/blockchain"
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/node"
+	. "github.com/Lawliet-Chan/yu/result"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"github.com/sirupsen/logrus"
+)
+
+// switchHead moves the canonical head to newHead, so the new block is built on the state of it.
+// If newHead extends the old head, the blocks between them are executed if their states are not committed,
+// otherwise the chain reorganizes on the common ancestor of them.
+func (m *Master) switchHead(newHead IBlock) error {
+	oldHash := m.stateStore.CanReadBlock()
+	if oldHash == newHead.GetHash() {
+		return nil
+	}
+	oldHead, err := m.chain.GetBlock(oldHash)
+	if _, ok := err.(ErrBlockNotFound); ok {
+		// no block is executed yet, such as the chain starting from a state snapshot.
+		if _, err = m.stateStore.StateRoot(newHead.GetHash()); err == nil {
+			m.stateStore.SetCanRead(newHead.GetHash())
+		}
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ancestor, oldBranch, newBranch, err := CommonAncestor(m.chain, oldHead, newHead)
+	if err != nil {
+		return err
+	}
+	if len(oldBranch) == 0 {
+		return m.forward(newBranch)
+	}
+	return m.reorg(ancestor, oldBranch, newBranch)
+}
+
+// forward executes the blocks of branch after the last one whose state is committed.
+func (m *Master) forward(branch []IBlock) error {
+	start := len(branch)
+	for start > 0 {
+		if _, err := m.stateStore.StateRoot(branch[start-1].GetHash()); err == nil {
+			break
+		}
+		start--
+	}
+	if start > 0 {
+		m.stateStore.SetCanRead(branch[start-1].GetHash())
+	}
+	return m.executeBranch(branch[start:])
+}
+
+// reorg rewinds the state to ancestor, re-executes the blocks of newBranch,
+// returns the txns only packed in oldBranch to txpool and notifies the subscribers.
+// If newBranch fails to execute, the chain rolls back to oldBranch.
+func (m *Master) reorg(ancestor IBlock, oldBranch, newBranch []IBlock) error {
+	oldHead := oldBranch[len(oldBranch)-1]
+	newHead := newBranch[len(newBranch)-1]
+	logrus.Warnf(
+		"reorg from block(%s) to block(%s) on ancestor(%s) height(%d)",
+		oldHead.GetHash().String(), newHead.GetHash().String(), ancestor.GetHash().String(), ancestor.GetHeight(),
+	)
+
+	err := m.revertBranch(ancestor, oldBranch)
+	if err != nil {
+		return err
+	}
+	err = m.executeBranch(newBranch)
+	if err != nil {
+		logrus.Errorf("abort reorg to block(%s): %s", newHead.GetHash().String(), err.Error())
+		rbErr := m.revertBranch(ancestor, newBranch)
+		if rbErr != nil {
+			return rbErr
+		}
+		rbErr = m.executeBranch(oldBranch)
+		if rbErr != nil {
+			return rbErr
+		}
+		return err
+	}
+	err = m.returnOrphanTxns(oldBranch, newBranch)
+	if err != nil {
+		return err
+	}
+
+	if m.sub != nil {
+		m.sub.Push(&Reorg{
+			OldHead:        oldHead.GetHash(),
+			NewHead:        newHead.GetHash(),
+			Ancestor:       ancestor.GetHash(),
+			AncestorHeight: ancestor.GetHeight(),
+			Dropped:        blockHashes(oldBranch),
+			Applied:        blockHashes(newBranch),
+		})
+	}
+	return nil
+}
+
+// revertBranch rewinds the state to ancestor and drops the results of branch,
+// so the queries only return the results of the canonical chain.
+func (m *Master) revertBranch(ancestor IBlock, branch []IBlock) error {
+	err := m.revertState(ancestor)
+	if err != nil {
+		return err
+	}
+	for _, block := range branch {
+		err = m.base.DeleteResults(block.GetHash())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *Master) revertState(ancestor IBlock) error {
+	_, err := m.stateStore.StateRoot(ancestor.GetHash())
+	if _, ok := err.(ErrStateNotCommitted); ok && ancestor.GetHeight() == 0 {
+		return m.stateStore.RevertToGenesis(ancestor.GetHash())
+	}
+	if err != nil {
+		return err
+	}
+	return m.stateStore.RevertToBlock(ancestor.GetHash())
+}
+
+// executeBranch executes the blocks in order, every one on the state of the previous one.
+// If a block fails to execute or its roots mismatch the recomputed ones,
+// the executing aborts on the state of the previous block.
+func (m *Master) executeBranch(branch []IBlock) error {
+	for _, block := range branch {
+		blockHash := block.GetHash()
+		stxns, err := m.base.GetTxns(blockHash)
+		if err != nil {
+			return err
+		}
+		if len(stxns) < len(block.GetTxnsHashes()) {
+			err = m.SyncTxns(block)
+			if err != nil {
+				return err
+			}
+		}
+
+		m.stateStore.StartBlock(blockHash)
+		err = ExecuteTxns(block, m.GetEnv(), m.land)
+		if err != nil {
+			return m.abortBlock(block, err)
+		}
+		m.stateStore.SetCanRead(blockHash)
+
+		err = m.txPool.RemoveTxns(block.GetTxnsHashes())
+		if err != nil {
+			return err
+		}
+		logrus.Infof("execute block(%s) height(%d)", blockHash.String(), block.GetHeight())
+	}
+	return nil
+}
+
+// abortBlock drops the state and results of the block failing to execute, and returns err.
+func (m *Master) abortBlock(block IBlock, err error) error {
+	parent, pErr := m.chain.GetBlock(block.GetPrevHash())
+	if pErr != nil {
+		return pErr
+	}
+	pErr = m.revertState(parent)
+	if pErr != nil {
+		return pErr
+	}
+	pErr = m.base.DeleteResults(block.GetHash())
+	if pErr != nil {
+		return pErr
+	}
+	return err
+}
+
+// returnOrphanTxns inserts the txns packed in oldBranch but not in newBranch into txpool again.
+func (m *Master) returnOrphanTxns(oldBranch, newBranch []IBlock) error {
+	packed := make(map[Hash]bool)
+	for _, block := range newBranch {
+		for _, txnHash := range block.GetTxnsHashes() {
+			packed[txnHash] = true
+		}
+	}
+	for _, block := range oldBranch {
+		stxns, err := m.base.GetTxns(block.GetHash())
+		if err != nil {
+			return err
+		}
+		for _, stxn := range stxns {
+			if packed[stxn.GetTxnHash()] {
+				continue
+			}
+			err = m.txPool.Insert(stxn)
+			if err != nil {
+				logrus.Warnf("return txn(%s) to txpool error: %s", stxn.GetTxnHash().String(), err.Error())
+			}
+		}
+	}
+	return nil
+}
+
+func blockHashes(blocks []IBlock) []Hash {
+	hashes := make([]Hash, 0, len(blocks))
+	for _, block := range blocks {
+		hashes = append(hashes, block.GetHash())
+	}
+	return hashes
+}
@@ -34,7 +34,27 @@ func getExecInfoFromReq(req *http.Request, params JsonString) (tripodName, execN
 	if err != nil {
 		return
 	}
-	stxn, err = NewSignedTxn(caller, ecall, pubkey, sig)
+	nonce, err := GetNonce(req)
+	if err != nil {
+		return
+	}
+	tip, err := GetTip(req)
+	if err != nil {
+		return
+	}
+	validUntil, err := GetValidUntil(req)
+	if err != nil {
+		return
+	}
+	timestamp, err := GetTimestamp(req)
+	if err != nil {
+		return
+	}
+	raw, err := NewUnsignedTxn(caller, ecall, nonce, tip, validUntil, timestamp)
+	if err != nil {
+		return
+	}
+	stxn, err = NewSignedTxn(raw, pubkey, sig)
 	return
 }
 
@@ -17,6 +17,7 @@ func (m *Master) Run() {
 		for {
 			err := m.LocalRun()
 			if err != nil {
+				exitIfStorageBroken(err)
 				logrus.Errorf("local-run blockchain error: %s", err.Error())
 			}
 		}
@@ -60,14 +61,7 @@ func (m *Master) LocalRun() error {
 		return err
 	}
 
-	if needBcBlock {
-		go func() {
-			err := m.pubBlock(newBlock)
-			if err != nil {
-				logrus.Errorf("broadcast block(%s) and txns error: %s", newBlock.GetHash().String(), err.Error())
-			}
-		}()
-	} else {
+	if !needBcBlock {
 		err = m.SyncTxns(newBlock)
 		if err != nil {
 			return err
@@ -86,6 +80,24 @@ func (m *Master) LocalRun() error {
 		return err
 	}
 
+	if needBcBlock {
+		// sign after executing, so the state root and receipt root are signed too.
+		err = newBlock.Sign(m.producerKey)
+		if err != nil {
+			return err
+		}
+		err = m.chain.UpdateBlock(newBlock)
+		if err != nil {
+			return err
+		}
+		go func() {
+			err := m.pubBlock(newBlock)
+			if err != nil {
+				logrus.Errorf("broadcast block(%s) and txns error: %s", newBlock.GetHash().String(), err.Error())
+			}
+		}()
+	}
+
 	// finalize this block
 	return m.land.RangeList(func(tri Tripod) error {
 		return tri.FinalizeBlock(newBlock, m.GetEnv(), m.land)
@@ -100,6 +112,10 @@ func (m *Master) makeNewBasicBlock() (IBlock, error) {
 	if err != nil {
 		return nil, err
 	}
+	err = m.switchHead(prevBlock)
+	if err != nil {
+		return nil, err
+	}
 	newBlock.SetPreHash(prevBlock.GetHash())
 	newBlock.SetHeight(prevBlock.GetHeight() + 1)
 	newBlock.SetLeiLimit(m.leiLimit)
@@ -0,0 +1,71 @@
+package master
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/state"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"io"
+	"os"
+)
+
+// ExportStateSnapshot writes the full state of blockHash into the snapshot file path.
+func (m *Master) ExportStateSnapshot(blockHash Hash, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return m.exportSnapshot(blockHash, file)
+}
+
+// exportSnapshot writes the state of blockHash together with the signed block into w.
+func (m *Master) exportSnapshot(blockHash Hash, w io.Writer) error {
+	block, err := m.chain.GetBlock(blockHash)
+	if err != nil {
+		return err
+	}
+	blockByt, err := block.Encode()
+	if err != nil {
+		return err
+	}
+	return m.stateStore.ExportSnapshot(blockHash, blockByt, w)
+}
+
+// ImportStateSnapshot imports the snapshot file path, and makes its state readable.
+// The snapshot block shipped in the file is verified as the blocks from p2p,
+// and then its StateRoot is used to check the snapshot, so the chain is not required.
+func (m *Master) ImportStateSnapshot(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	header, err := ReadSnapshotHeader(file)
+	file.Close()
+	if err != nil {
+		return err
+	}
+
+	block, err := m.chain.NewEmptyBlock().Decode(header.Block)
+	if err != nil {
+		return err
+	}
+	if block.GetHash() != header.BlockHash {
+		return SnapshotIllegal("block mismatches the block hash")
+	}
+	err = m.verifyBlock(block)
+	if err != nil {
+		return err
+	}
+
+	file, err = os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = m.stateStore.ImportSnapshot(file, block.GetStateRoot())
+	if err != nil {
+		return err
+	}
+	m.stateStore.SetCanRead(header.BlockHash)
+	return nil
+}
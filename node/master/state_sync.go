@@ -0,0 +1,199 @@
+package master
+
+import (
+	"context"
+	"errors"
+	. "github.com/Lawliet-Chan/yu/blockchain"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/libp2p/go-libp2p-core/network"
+	"github.com/libp2p/go-libp2p-core/peer"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// the max number of trie nodes fetched in one request.
+	stateNodesPerRequest = 384
+	// give up when so many rounds in a row fetch nothing.
+	maxStateSyncFailures = 10
+)
+
+var NoPeerToSyncState = errors.New("no peer to sync state")
+
+// SyncHistoryBlocksWithState appends the history blocks without executing them,
+// and downloads the state of the last block from peers.
+func (m *Master) SyncHistoryBlocksWithState(blocks []IBlock, remote peer.ID) error {
+	if len(blocks) == 0 {
+		return nil
+	}
+	for _, block := range blocks {
+		logrus.Trace("sync history block without executing: ", block.GetHash().String())
+
+		err := m.SyncTxns(block)
+		if err != nil {
+			return err
+		}
+
+		err = m.verifyBlock(block)
+		if err != nil {
+			return err
+		}
+
+		err = m.chain.AppendBlock(block)
+		if err != nil {
+			return err
+		}
+	}
+
+	peers := m.ConnectedPeers
+	if !containsPeer(peers, remote) {
+		peers = append([]peer.ID{remote}, peers...)
+	}
+	return m.SyncState(blocks[len(blocks)-1], peers)
+}
+
+// SyncState downloads the state of block from peers in parallel,
+// and makes it readable.
+func (m *Master) SyncState(block IBlock, peers []peer.ID) error {
+	if len(peers) == 0 {
+		return NoPeerToSyncState
+	}
+	stateRoot := block.GetStateRoot()
+	logrus.Infof("start to sync state(%s) of block(%s)", stateRoot.String(), block.GetHash().String())
+
+	sync := m.stateStore.NewStateSync(stateRoot)
+	failures := 0
+	for sync.Pending() > 0 {
+		hashes := sync.Missing(stateNodesPerRequest * len(peers))
+		if len(hashes) == 0 {
+			return NoPeerToSyncState
+		}
+
+		results := m.fetchStateNodes(hashes, peers)
+		progress := false
+		for _, result := range results {
+			if result.err != nil {
+				logrus.Warnf("fetch state nodes from peer(%s) error: %s", result.peer.Pretty(), result.err.Error())
+				sync.Retry(result.hashes)
+				continue
+			}
+			for i, hash := range result.hashes {
+				if i >= len(result.nodes) || result.nodes[i] == nil {
+					sync.Retry([]Hash{hash})
+					continue
+				}
+				err := sync.Process(hash, result.nodes[i])
+				if err != nil {
+					logrus.Warnf("state node(%s) from peer(%s) error: %s", hash.String(), result.peer.Pretty(), err.Error())
+					sync.Retry([]Hash{hash})
+					continue
+				}
+				progress = true
+			}
+		}
+
+		if progress {
+			failures = 0
+		} else {
+			failures++
+			if failures >= maxStateSyncFailures {
+				return errors.New("cannot fetch state nodes from peers")
+			}
+		}
+	}
+	logrus.Infof("sync state(%s) done, %d trie nodes", stateRoot.String(), sync.Synced())
+
+	err := m.stateStore.CommitSyncedState(block.GetHash(), stateRoot)
+	if err != nil {
+		return err
+	}
+	m.stateStore.SetCanRead(block.GetHash())
+	return nil
+}
+
+type stateNodesResult struct {
+	peer   peer.ID
+	hashes []Hash
+	nodes  [][]byte
+	err    error
+}
+
+// fetchStateNodes splits hashes among peers and fetches them in parallel.
+func (m *Master) fetchStateNodes(hashes []Hash, peers []peer.ID) []*stateNodesResult {
+	chunk := (len(hashes) + len(peers) - 1) / len(peers)
+	resultsChan := make(chan *stateNodesResult, len(peers))
+	requests := 0
+	for i := 0; i < len(peers) && i*chunk < len(hashes); i++ {
+		end := (i + 1) * chunk
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		result := &stateNodesResult{
+			peer:   peers[i],
+			hashes: hashes[i*chunk : end],
+		}
+		requests++
+		go func() {
+			result.nodes, result.err = m.requestStateNodes(result.peer, result.hashes)
+			resultsChan <- result
+		}()
+	}
+
+	results := make([]*stateNodesResult, 0, requests)
+	for i := 0; i < requests; i++ {
+		results = append(results, <-resultsChan)
+	}
+	return results
+}
+
+func (m *Master) requestStateNodes(p peer.ID, hashes []Hash) ([][]byte, error) {
+	s, err := m.host.NewStream(context.Background(), p, m.protocolID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.Close()
+	reqByt, err := StateNodesRequest{Hashes: hashes}.Encode()
+	if err != nil {
+		return nil, err
+	}
+	err = writeToStream(reqByt, s)
+	if err != nil {
+		return nil, err
+	}
+	respByt, err := readFromStream(s)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := DecodeStateNodesResp(respByt)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Nodes, nil
+}
+
+func (m *Master) handleSyncStateReq(byt []byte, s network.Stream) error {
+	req, err := DecodeStateNodesRequest(byt)
+	if err != nil {
+		return err
+	}
+	if len(req.Hashes) > stateNodesPerRequest {
+		req.Hashes = req.Hashes[:stateNodesPerRequest]
+	}
+	nodes, err := m.stateStore.GetTrieNodes(req.Hashes)
+	if err != nil {
+		return err
+	}
+	respByt, err := (&StateNodesResp{Nodes: nodes}).Encode()
+	if err != nil {
+		return err
+	}
+	return writeToStream(respByt, s)
+}
+
+func containsPeer(peers []peer.ID, p peer.ID) bool {
+	for _, pr := range peers {
+		if pr == p {
+			return true
+		}
+	}
+	return false
+}
@@ -3,8 +3,11 @@ package node
 import (
 	. "github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/keypair"
+	. "github.com/Lawliet-Chan/yu/result"
 	"net/http"
+	"net/url"
 	"path/filepath"
+	"strconv"
 )
 
 const (
@@ -30,6 +33,23 @@ const (
 	CheckTxnsPath   = "/txns/check"
 	ExecuteTxnsPath = "/txns/execute"
 
+	// state changes of a block
+	StateChangesPath = "/state/changes"
+	// state snapshot of a block
+	StateSnapshotPath = "/state/snapshot"
+
+	// receipt of a txn
+	ReceiptPath = "/receipt"
+	// proof that a txn is in a block
+	TxnProofPath = "/txn/proof"
+
+	// nonce of an account
+	NoncePath = "/nonce"
+
+	// query the stored events and errors
+	EventsPath = "/events"
+	ErrorsPath = "/errors"
+
 	// For developers, every customized Execution and Query of tripods
 	// will base on '/api'.
 	RootApiPath = "/api"
@@ -38,8 +58,22 @@ const (
 	CallNameKey   = "call_name"
 	AddressKey    = "address"
 	BlockHashKey  = "block_hash"
+	TxnHashKey    = "txn_hash"
 	PubkeyKey     = "pubkey"
 	SignatureKey  = "signature"
+	NonceKey      = "nonce"
+	TipKey        = "tip"
+	ValidUntilKey = "valid_until"
+	TimestampKey  = "timestamp"
+	ProveKey      = "prove"
+
+	StartHeightKey = "start_height"
+	EndHeightKey   = "end_height"
+	OffsetKey      = "offset"
+	LimitKey       = "limit"
+
+	// max number of events or errors in a page
+	MaxResultsLimit = 100
 )
 
 var (
@@ -63,11 +97,92 @@ func GetBlockHash(req *http.Request) Hash {
 	return HexToHash(req.URL.Query().Get(BlockHashKey))
 }
 
+func GetTxnHash(req *http.Request) Hash {
+	return HexToHash(req.URL.Query().Get(TxnHashKey))
+}
+
 func GetPubkey(req *http.Request) (keypair.PubKey, error) {
 	pubkeyStr := req.URL.Query().Get(PubkeyKey)
 	return keypair.PubkeyFromStr(pubkeyStr)
 }
 
+// GetResultFilter returns the filter of events or errors,
+// the Limit is MaxResultsLimit if it is not set or too large.
+func GetResultFilter(req *http.Request) (*Filter, error) {
+	query := req.URL.Query()
+	startHeight, err := getUintParam(query, StartHeightKey)
+	if err != nil {
+		return nil, err
+	}
+	endHeight, err := getUintParam(query, EndHeightKey)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := getUintParam(query, OffsetKey)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := getUintParam(query, LimitKey)
+	if err != nil {
+		return nil, err
+	}
+	if limit == 0 || limit > MaxResultsLimit {
+		limit = MaxResultsLimit
+	}
+	return &Filter{
+		TripodName:  query.Get(TripodNameKey),
+		ExecName:    query.Get(CallNameKey),
+		Caller:      HexToAddress(query.Get(AddressKey)),
+		StartHeight: BlockNum(startHeight),
+		EndHeight:   BlockNum(endHeight),
+		Offset:      int(offset),
+		Limit:       int(limit),
+	}, nil
+}
+
+// getUintParam returns 0 if the param is not set.
+func getUintParam(query url.Values, key string) (uint64, error) {
+	str := query.Get(key)
+	if str == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(str, 10, 32)
+}
+
+// GetNonce returns 0 if the nonce is not set.
+func GetNonce(req *http.Request) (uint64, error) {
+	return getUint64Param(req.URL.Query(), NonceKey)
+}
+
+// GetTip returns 0 if the tip is not set.
+func GetTip(req *http.Request) (uint64, error) {
+	return getUint64Param(req.URL.Query(), TipKey)
+}
+
+// GetValidUntil returns 0 if the txn is valid on all the heights.
+func GetValidUntil(req *http.Request) (BlockNum, error) {
+	height, err := getUintParam(req.URL.Query(), ValidUntilKey)
+	return BlockNum(height), err
+}
+
+// GetTimestamp returns 0 if the timestamp is not set.
+func GetTimestamp(req *http.Request) (uint64, error) {
+	return getUint64Param(req.URL.Query(), TimestampKey)
+}
+
+func getUint64Param(query url.Values, key string) (uint64, error) {
+	str := query.Get(key)
+	if str == "" {
+		return 0, nil
+	}
+	return strconv.ParseUint(str, 10, 64)
+}
+
+// return true if client wants the state proofs of a Query
+func GetProve(req *http.Request) bool {
+	return req.URL.Query().Get(ProveKey) == "true"
+}
+
 func GetSignature(req *http.Request) []byte {
 	signStr := req.URL.Query().Get(SignatureKey)
 	return FromHex(signStr)
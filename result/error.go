@@ -10,6 +10,7 @@ type Error struct {
 	Caller     Address  `json:"caller"`
 	BlockStage string   `json:"block_stage"`
 	BlockHash  Hash     `json:"block_hash"`
+	TxnHash    Hash     `json:"txn_hash"`
 	Height     BlockNum `json:"height"`
 	TripodName string   `json:"tripod_name"`
 	ExecName   string   `json:"exec_name"`
@@ -31,6 +32,15 @@ func (e *Error) Error() (str string) {
 			e.Height,
 			e.Err,
 		)
+	} else if e.BlockStage == TxpoolStage {
+		str = fmt.Sprintf(
+			"[Error] Caller(%s) call Tripod(%s) Execution(%s) by Txn(%s) in Txpool: %s",
+			e.Caller.String(),
+			e.TripodName,
+			e.ExecName,
+			e.TxnHash.String(),
+			e.Err,
+		)
 	} else {
 		str = fmt.Sprintf(
 			"[Error] %s Block(%s) on Height(%d) in Tripod(%s): %s",
@@ -10,6 +10,7 @@ type Event struct {
 	Caller     Address  `json:"caller"`
 	BlockStage string   `json:"block_stage"`
 	BlockHash  Hash     `json:"block_hash"`
+	TxnHash    Hash     `json:"txn_hash"`
 	Height     BlockNum `json:"height"`
 	TripodName string   `json:"tripod_name"`
 	ExecName   string   `json:"exec_name"`
@@ -0,0 +1,43 @@
+package result
+
+import . "github.com/Lawliet-Chan/yu/common"
+
+// Filter selects the stored events or errors, the zero value of a field matches all.
+// The results are in ascending order of height, and then in the order they are stored.
+type Filter struct {
+	TripodName string
+	ExecName   string
+	Caller     Address
+	// the range of height is [StartHeight, EndHeight], EndHeight 0 means no upper bound.
+	StartHeight BlockNum
+	EndHeight   BlockNum
+
+	Offset int
+	// 0 means no limit
+	Limit int
+}
+
+func (f *Filter) InHeight(height BlockNum) bool {
+	return height >= f.StartHeight && (f.EndHeight == 0 || height <= f.EndHeight)
+}
+
+func (f *Filter) Match(tripodName, execName string, caller Address, height BlockNum) bool {
+	if f.TripodName != "" && f.TripodName != tripodName {
+		return false
+	}
+	if f.ExecName != "" && f.ExecName != execName {
+		return false
+	}
+	if f.Caller != NullAddress && f.Caller != caller {
+		return false
+	}
+	return f.InHeight(height)
+}
+
+func (f *Filter) MatchEvent(e *Event) bool {
+	return f.Match(e.TripodName, e.ExecName, e.Caller, e.Height)
+}
+
+func (f *Filter) MatchError(e *Error) bool {
+	return f.Match(e.TripodName, e.ExecName, e.Caller, e.Height)
+}
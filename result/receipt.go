@@ -0,0 +1,45 @@
+package result
+
+import (
+	"encoding/json"
+	. "github.com/Lawliet-Chan/yu/common"
+)
+
+type ReceiptStatus int
+
+const (
+	ReceiptFailed ReceiptStatus = iota
+	ReceiptSuccess
+)
+
+// Receipt is the result of executing a txn in a block.
+type Receipt struct {
+	TxnHash   Hash          `json:"txn_hash"`
+	BlockHash Hash          `json:"block_hash"`
+	Height    BlockNum      `json:"height"`
+	Status    ReceiptStatus `json:"status"`
+	LeiUsed   uint64        `json:"lei_used"`
+	Events    []*Event      `json:"events"`
+	Error     *Error        `json:"error"`
+}
+
+func (r *Receipt) Succeeded() bool {
+	return r.Status == ReceiptSuccess
+}
+
+func (r *Receipt) Encode() ([]byte, error) {
+	return json.Marshal(r)
+}
+
+func (r *Receipt) Decode(data []byte) error {
+	return json.Unmarshal(data, r)
+}
+
+// Hash is the leaf of the receipt root in block header.
+func (r *Receipt) Hash() (Hash, error) {
+	byt, err := r.Encode()
+	if err != nil {
+		return NullHash, err
+	}
+	return Keccak256Hash(byt), nil
+}
@@ -0,0 +1,47 @@
+package result
+
+import (
+	"encoding/json"
+	"fmt"
+	. "github.com/Lawliet-Chan/yu/common"
+)
+
+// Reorg notifies that the canonical chain switches from OldHead to NewHead.
+// The results of Dropped blocks are no longer on the canonical chain,
+// and the blocks of Applied are re-executed on the state of Ancestor.
+type Reorg struct {
+	OldHead        Hash     `json:"old_head"`
+	NewHead        Hash     `json:"new_head"`
+	Ancestor       Hash     `json:"ancestor"`
+	AncestorHeight BlockNum `json:"ancestor_height"`
+	Dropped        []Hash   `json:"dropped"`
+	Applied        []Hash   `json:"applied"`
+}
+
+func (r *Reorg) Type() ResultType {
+	return ReorgType
+}
+
+func (r *Reorg) Encode() ([]byte, error) {
+	byt, err := json.Marshal(r)
+	if err != nil {
+		return nil, err
+	}
+	return append(ReorgTypeByt, byt...), nil
+}
+
+func (r *Reorg) Decode(data []byte) error {
+	return json.Unmarshal(data[ResultTypeBytesLen:], r)
+}
+
+func (r *Reorg) Sprint() string {
+	return fmt.Sprintf(
+		"[Reorg] from Block(%s) to Block(%s) on Ancestor(%s) Height(%d): drop %d blocks, apply %d blocks",
+		r.OldHead.String(),
+		r.NewHead.String(),
+		r.Ancestor.String(),
+		r.AncestorHeight,
+		len(r.Dropped),
+		len(r.Applied),
+	)
+}
@@ -16,6 +16,7 @@ type ResultType int
 const (
 	EventType ResultType = iota
 	ErrorType
+	ReorgType
 
 	ResultTypeBytesLen = 1
 )
@@ -23,6 +24,7 @@ const (
 var (
 	EventTypeByt = []byte(strconv.Itoa(int(EventType)))
 	ErrorTypeByt = []byte(strconv.Itoa(int(ErrorType)))
+	ReorgTypeByt = []byte(strconv.Itoa(int(ReorgType)))
 )
 
 // this func use for clients
@@ -43,6 +45,10 @@ func DecodeResult(data []byte) (Result, error) {
 		er := &Error{}
 		err := er.Decode(data)
 		return er, err
+	case ReorgType:
+		reorg := &Reorg{}
+		err := reorg.Decode(data)
+		return reorg, err
 	}
 	return nil, errors.New("no result type")
 }
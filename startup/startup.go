@@ -3,6 +3,7 @@ package startup
 import (
 	"flag"
 	"github.com/Lawliet-Chan/yu/blockchain"
+	"github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/config"
 	"github.com/Lawliet-Chan/yu/node/master"
 	"github.com/Lawliet-Chan/yu/tripod"
@@ -15,6 +16,12 @@ import (
 var (
 	masterCfgPath string
 	masterCfg     config.MasterConf
+
+	// export the state snapshot of 'snapshotBlock' into 'exportSnapshot' and exit.
+	exportSnapshot string
+	snapshotBlock  string
+	// import the state snapshot 'importSnapshot' before starting up.
+	importSnapshot string
 )
 
 var (
@@ -38,6 +45,20 @@ func StartUp(tripods ...tripod.Tripod) {
 		logrus.Panicf("load master error: %s", err.Error())
 	}
 
+	if importSnapshot != "" {
+		err = m.ImportStateSnapshot(importSnapshot)
+		if err != nil {
+			logrus.Panicf("import state snapshot error: %s", err.Error())
+		}
+	}
+	if exportSnapshot != "" {
+		err = m.ExportStateSnapshot(common.HexToHash(snapshotBlock), exportSnapshot)
+		if err != nil {
+			logrus.Panicf("export state snapshot error: %s", err.Error())
+		}
+		return
+	}
+
 	m.Startup()
 }
 
@@ -45,6 +66,9 @@ func initCfgFromFlags() {
 	useDefaultCfg := flag.Bool("dc", false, "default config files")
 
 	flag.StringVar(&masterCfgPath, "m", "yu_conf/master.toml", "Master config file path")
+	flag.StringVar(&exportSnapshot, "export-snapshot", "", "export the state snapshot into the file and exit")
+	flag.StringVar(&snapshotBlock, "snapshot-block", "", "block hash of the exported state snapshot")
+	flag.StringVar(&importSnapshot, "import-snapshot", "", "import the state snapshot file before starting up")
 
 	flag.Parse()
 	if *useDefaultCfg {
@@ -84,6 +108,7 @@ func initDefaultCfg() {
 		Timeout:         60,
 		P2pListenAddrs:  []string{"/ip4/127.0.0.1/tcp/8887"},
 		Bootnodes:       nil,
+		SyncMode:        config.FullSync,
 		ProtocolID:      "yu",
 		NodeKeyType:     1,
 		NodeKeyRandSeed: 1,
@@ -92,6 +117,8 @@ func initDefaultCfg() {
 		NodeKeyFile:     "",
 	}
 	masterCfg.BlockChain = config.BlockchainConf{
+		StoreType:    config.SqlStore,
+		ConvergeType: config.LongestConverge,
 		ChainDB: config.SqlDbConf{
 			SqlDbType: "sqlite",
 			Dsn:       "chain.db",
@@ -102,6 +129,7 @@ func initDefaultCfg() {
 		},
 	}
 	masterCfg.BlockBase = config.BlockBaseConf{
+		StoreType: config.SqlStore,
 		BaseDB: config.SqlDbConf{
 			SqlDbType: "sqlite",
 			Dsn:       "blockbase.db",
@@ -123,5 +151,9 @@ func initDefaultCfg() {
 			Path:   "./state_base.db",
 			Hosts:  nil,
 		},
+		NodeCacheSize: 100000,
+		Prune: config.PruneConf{
+			Mode: config.ArchiveMode,
+		},
 	}}
 }
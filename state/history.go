@@ -0,0 +1,227 @@
+package state
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/yerror"
+)
+
+// Besides blockHash -> stateRoot, indexDB also keeps the order of committed blocks
+// and the change set of every committed block.
+var (
+	commitCountKey  = []byte("commit-count")
+	lowestSeqKey    = []byte("lowest-seq")
+	commitSeqPrefix = []byte("commit-seq-")
+	changeSetPrefix = []byte("changeset-")
+)
+
+// ChangeSet lists the state changes made by a block.
+type ChangeSet struct {
+	BlockHash Hash           `json:"block_hash"`
+	Changes   []*StateChange `json:"changes"`
+}
+
+// StateChange is the change of a key. A nil OldValue means the key is created,
+// and a nil NewValue means the key is deleted.
+type StateChange struct {
+	TripodName string `json:"tripod_name"`
+	Key        []byte `json:"key"`
+	OldValue   []byte `json:"old_value"`
+	NewValue   []byte `json:"new_value"`
+}
+
+// GetChangeSet returns the state changes made by the block.
+func (skv *StateKV) GetChangeSet(blockHash Hash) (*ChangeSet, error) {
+	err := skv.checkPruned(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	byt, err := skv.indexDB.Get(changeSetKey(blockHash))
+	if err != nil {
+		return nil, err
+	}
+	if byt == nil {
+		return nil, StateNotCommitted(blockHash)
+	}
+	cs := &ChangeSet{}
+	err = json.Unmarshal(byt, cs)
+	return cs, err
+}
+
+// RevertToBlock rewinds the committed states to the one of blockHash.
+// The states of the blocks committed after it are dropped from the index,
+// and the uncommitted writes are discarded.
+func (skv *StateKV) RevertToBlock(blockHash Hash) error {
+	err := skv.checkPruned(blockHash)
+	if err != nil {
+		return err
+	}
+	count, lowest, err := skv.commitRange()
+	if err != nil {
+		return err
+	}
+
+	seq := count
+	for ; seq >= lowest; seq-- {
+		seqBlock, err := skv.getCommitSeq(seq)
+		if err != nil {
+			return err
+		}
+		if seqBlock == blockHash {
+			break
+		}
+	}
+	if seq < lowest {
+		return StateNotCommitted(blockHash)
+	}
+	return skv.revertTo(blockHash, seq, count, lowest)
+}
+
+// RevertToGenesis rewinds to the empty state and drops the states of all the committed blocks,
+// it is used when the genesis block commits no state.
+func (skv *StateKV) RevertToGenesis(genesisHash Hash) error {
+	count, lowest, err := skv.commitRange()
+	if err != nil {
+		return err
+	}
+	return skv.revertTo(genesisHash, 0, count, lowest)
+}
+
+// commitRange returns the number of committed blocks and the lowest commit sequence still kept,
+// because the commit sequences of the pruned blocks have been deleted.
+func (skv *StateKV) commitRange() (count, lowest uint64, err error) {
+	count, err = skv.getCommitCount()
+	if err != nil {
+		return
+	}
+	lowest, err = skv.getLowestSeq()
+	return
+}
+
+// revertTo drops the blocks committed after seq, and builds the next block on the state of blockHash.
+func (skv *StateKV) revertTo(blockHash Hash, seq, count, lowest uint64) error {
+	for s := count; s > seq && s >= lowest; s-- {
+		dropBlock, err := skv.getCommitSeq(s)
+		if err != nil {
+			return err
+		}
+		err = skv.indexDB.Delete(dropBlock.Bytes())
+		if err != nil {
+			return err
+		}
+		err = skv.indexDB.Delete(changeSetKey(dropBlock))
+		if err != nil {
+			return err
+		}
+		err = skv.indexDB.Delete(commitSeqKey(s))
+		if err != nil {
+			return err
+		}
+	}
+	err := skv.indexDB.Set(commitCountKey, uint64ToBytes(seq))
+	if err != nil {
+		return err
+	}
+	// only reverting to genesis goes below the lowest kept sequence,
+	// the next commits reuse the sequences from seq+1.
+	if seq+1 < lowest {
+		err = skv.indexDB.Set(lowestSeqKey, uint64ToBytes(seq+1))
+		if err != nil {
+			return err
+		}
+	}
+
+	skv.nowStashes = nil
+	skv.nowCache = make(map[string]*KvStash)
+	skv.snapshots = nil
+	skv.stashes = nil
+	skv.blockCache = make(map[string]*KvStash)
+	skv.nowBlock = blockHash
+	skv.canReadBlock = blockHash
+	return nil
+}
+
+func (skv *StateKV) setChangeSet(blockHash Hash, changes []*StateChange) error {
+	byt, err := json.Marshal(&ChangeSet{
+		BlockHash: blockHash,
+		Changes:   changes,
+	})
+	if err != nil {
+		return err
+	}
+	return skv.indexDB.Set(changeSetKey(blockHash), byt)
+}
+
+// appendCommit appends blockHash to the committed blocks,
+// and returns the number of committed blocks.
+func (skv *StateKV) appendCommit(blockHash Hash) (uint64, error) {
+	count, err := skv.getCommitCount()
+	if err != nil {
+		return 0, err
+	}
+	count++
+	err = skv.indexDB.Set(commitSeqKey(count), blockHash.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return count, skv.indexDB.Set(commitCountKey, uint64ToBytes(count))
+}
+
+func newStateChange(key, oldValue, newValue []byte) *StateChange {
+	nameLen := int(binary.BigEndian.Uint16(key))
+	return &StateChange{
+		TripodName: string(key[2 : 2+nameLen]),
+		Key:        key[2+nameLen:],
+		OldValue:   oldValue,
+		NewValue:   newValue,
+	}
+}
+
+func (skv *StateKV) getCommitCount() (uint64, error) {
+	byt, err := skv.indexDB.Get(commitCountKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(byt) == 0 {
+		return 0, nil
+	}
+	return binary.BigEndian.Uint64(byt), nil
+}
+
+// getLowestSeq returns the lowest commit sequence not pruned, 1 if nothing is pruned.
+func (skv *StateKV) getLowestSeq() (uint64, error) {
+	byt, err := skv.indexDB.Get(lowestSeqKey)
+	if err != nil {
+		return 0, err
+	}
+	if len(byt) == 0 {
+		return 1, nil
+	}
+	return binary.BigEndian.Uint64(byt), nil
+}
+
+func (skv *StateKV) getCommitSeq(seq uint64) (Hash, error) {
+	byt, err := skv.indexDB.Get(commitSeqKey(seq))
+	if err != nil {
+		return NullHash, err
+	}
+	if len(byt) == 0 {
+		return NullHash, CommitSeqNotFound(seq)
+	}
+	return BytesToHash(byt), nil
+}
+
+func commitSeqKey(seq uint64) []byte {
+	return append(CopyBytes(commitSeqPrefix), uint64ToBytes(seq)...)
+}
+
+func changeSetKey(blockHash Hash) []byte {
+	return append(CopyBytes(changeSetPrefix), blockHash.Bytes()...)
+}
+
+func uint64ToBytes(u uint64) []byte {
+	byt := make([]byte, 8)
+	binary.BigEndian.PutUint64(byt, u)
+	return byt
+}
@@ -1,10 +1,12 @@
 package state
 
 import (
+	"bytes"
 	. "github.com/Lawliet-Chan/yu/common"
 	. "github.com/Lawliet-Chan/yu/config"
 	. "github.com/Lawliet-Chan/yu/storage/kv"
-	. "github.com/Lawliet-Chan/yu/trie/mpt"
+	"github.com/Lawliet-Chan/yu/trie/mpt"
+	. "github.com/Lawliet-Chan/yu/yerror"
 	"github.com/sirupsen/logrus"
 )
 
@@ -20,13 +22,23 @@ type StateKV struct {
 	// blockHash -> stateRoot
 	indexDB KV
 
-	nodeBase *NodeBase
+	nodeBase *mpt.NodeBase
 
 	nowBlock     Hash
 	canReadBlock Hash
 
 	nowStashes []*KvStash
 	stashes    []*KvStash
+
+	// read-your-writes caches over the committed state,
+	// key -> the latest stash of the current txn / the current block.
+	nowCache   map[string]*KvStash
+	blockCache map[string]*KvStash
+
+	// snapshot id -> the number of nowStashes when the snapshot is taken
+	snapshots []int
+
+	pruneCfg PruneConf
 }
 
 func NewStateKV(cfg *StateKvConf) (*StateKV, error) {
@@ -35,17 +47,29 @@ func NewStateKV(cfg *StateKvConf) (*StateKV, error) {
 		return nil, err
 	}
 
-	nodeBase, err := NewNodeBase(&cfg.NodeBase)
+	nodeBase, err := mpt.NewNodeBase(&cfg.NodeBase, cfg.NodeCacheSize)
 	if err != nil {
 		return nil, err
 	}
 
+	pruneCfg := cfg.Prune
+	if pruneCfg.Mode == PruneMode && pruneCfg.KeepBlocks == 0 {
+		// the state of the latest block must be kept.
+		pruneCfg.KeepBlocks = 1
+	}
+	if pruneCfg.GcInterval == 0 {
+		pruneCfg.GcInterval = DefaultGcInterval
+	}
+
 	return &StateKV{
 		indexDB:    indexDB,
 		nodeBase:   nodeBase,
 		nowBlock:   NullHash,
 		nowStashes: make([]*KvStash, 0),
 		stashes:    make([]*KvStash, 0),
+		nowCache:   make(map[string]*KvStash),
+		blockCache: make(map[string]*KvStash),
+		pruneCfg:   pruneCfg,
 	}, nil
 }
 
@@ -54,10 +78,16 @@ func (skv *StateKV) NextTxn() {
 		skv.stashes = append(skv.stashes, stash)
 	}
 	skv.nowStashes = make([]*KvStash, 0)
+
+	for key, stash := range skv.nowCache {
+		skv.blockCache[key] = stash
+	}
+	skv.nowCache = make(map[string]*KvStash)
+	skv.snapshots = nil
 }
 
 func (skv *StateKV) Set(triName NameString, key, value []byte) {
-	skv.nowStashes = append(skv.nowStashes, &KvStash{
+	skv.stash(&KvStash{
 		ops:   SetOp,
 		Key:   makeKey(triName, key),
 		Value: value,
@@ -65,14 +95,28 @@ func (skv *StateKV) Set(triName NameString, key, value []byte) {
 }
 
 func (skv *StateKV) Delete(triName NameString, key []byte) {
-	skv.nowStashes = append(skv.nowStashes, &KvStash{
+	skv.stash(&KvStash{
 		ops:   DeleteOp,
 		Key:   makeKey(triName, key),
 		Value: nil,
 	})
 }
 
+func (skv *StateKV) stash(stash *KvStash) {
+	skv.nowStashes = append(skv.nowStashes, stash)
+	skv.nowCache[string(stash.Key)] = stash
+}
+
+// Get reads the writes of the current txn first, then the ones of the current block,
+// and finally the committed state of canReadBlock.
 func (skv *StateKV) Get(triName NameString, key []byte) ([]byte, error) {
+	mkey := string(makeKey(triName, key))
+	if stash, ok := skv.nowCache[mkey]; ok {
+		return stash.Value, nil
+	}
+	if stash, ok := skv.blockCache[mkey]; ok {
+		return stash.Value, nil
+	}
 	return skv.GetByBlockHash(triName, key, skv.canReadBlock)
 }
 
@@ -82,15 +126,76 @@ func (skv *StateKV) Exist(triName NameString, key []byte) bool {
 }
 
 func (skv *StateKV) GetByBlockHash(triName NameString, key []byte, blockHash Hash) ([]byte, error) {
+	err := skv.checkPruned(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	stateRoot, err := skv.getIndexDB(blockHash)
+	if err != nil {
+		return nil, err
+	}
+	trie, err := mpt.NewTrie(stateRoot, skv.nodeBase)
+	if err != nil {
+		return nil, err
+	}
+	return trie.TryGet(makeKey(triName, key))
+}
+
+// Iter iterates the keys beginning with prefix in the namespace of triName,
+// in the state of blockHash. Keys of the Entry are without the namespace.
+func (skv *StateKV) Iter(triName NameString, prefix []byte, blockHash Hash) (Iterator, error) {
+	err := skv.checkPruned(blockHash)
+	if err != nil {
+		return nil, err
+	}
 	stateRoot, err := skv.getIndexDB(blockHash)
 	if err != nil {
 		return nil, err
 	}
-	mpt, err := NewTrie(stateRoot, skv.nodeBase)
+	trie, err := mpt.NewTrie(stateRoot, skv.nodeBase)
+	if err != nil {
+		return nil, err
+	}
+	iter, err := trie.NewIterator(makeKey(triName, prefix))
 	if err != nil {
 		return nil, err
 	}
-	return mpt.TryGet(makeKey(triName, key))
+	return &stateIterator{
+		Iterator:  iter,
+		namespace: len(makeKey(triName, nil)),
+	}, nil
+}
+
+// GetWithProof returns the value of key in the state of blockHash, together with
+// the MPT proof nodes which can be verified by VerifyProof against the StateRoot of that block.
+func (skv *StateKV) GetWithProof(triName NameString, key []byte, blockHash Hash) ([]byte, [][]byte, error) {
+	err := skv.checkPruned(blockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	stateRoot, err := skv.getIndexDB(blockHash)
+	if err != nil {
+		return nil, nil, err
+	}
+	trie, err := mpt.NewTrie(stateRoot, skv.nodeBase)
+	if err != nil {
+		return nil, nil, err
+	}
+	value, err := trie.TryGet(makeKey(triName, key))
+	if err != nil {
+		return nil, nil, err
+	}
+	proof, err := trie.TryProve(makeKey(triName, key))
+	if err != nil {
+		return nil, nil, err
+	}
+	return value, proof, nil
+}
+
+// VerifyProof checks the proof returned by GetWithProof and returns the proved value.
+// If the state does not contain key, it returns a nil value and no error.
+func VerifyProof(stateRoot Hash, triName NameString, key []byte, proof [][]byte) ([]byte, error) {
+	return mpt.VerifyProof(stateRoot, makeKey(triName, key), proof)
 }
 
 // return StateRoot or error
@@ -100,23 +205,30 @@ func (skv *StateKV) Commit() (Hash, error) {
 		return NullHash, err
 	}
 	if lastStateRoot == NullHash {
-		lastStateRoot = EmptyRoot
+		lastStateRoot = mpt.EmptyRoot
 	}
-	mpt, err := NewTrie(lastStateRoot, skv.nodeBase)
+	trie, err := mpt.NewTrie(lastStateRoot, skv.nodeBase)
 	if err != nil {
 		skv.DiscardAll()
 		return NullHash, err
 	}
+
+	changes, err := skv.collectChanges(trie)
+	if err != nil {
+		skv.DiscardAll()
+		return NullHash, err
+	}
+
 	for _, stash := range skv.stashes {
 		switch stash.ops {
 		case SetOp:
-			err := mpt.TryUpdate(stash.Key, stash.Value)
+			err := trie.TryUpdate(stash.Key, stash.Value)
 			if err != nil {
 				skv.DiscardAll()
 				return NullHash, err
 			}
 		case DeleteOp:
-			err := mpt.TryDelete(stash.Key)
+			err := trie.TryDelete(stash.Key)
 			if err != nil {
 				skv.DiscardAll()
 				return NullHash, err
@@ -124,12 +236,14 @@ func (skv *StateKV) Commit() (Hash, error) {
 		}
 	}
 
-	stateRoot, err := mpt.Commit(nil)
+	stateRoot, err := trie.Commit(nil)
 	if err != nil {
 		skv.DiscardAll()
 		return NullHash, err
 	}
 
+	committed := skv.indexDB.Exist(skv.nowBlock.Bytes())
+
 	err = skv.setIndexDB(skv.nowBlock, stateRoot)
 	if err != nil {
 		skv.DiscardAll()
@@ -137,11 +251,80 @@ func (skv *StateKV) Commit() (Hash, error) {
 	}
 
 	skv.stashes = nil
+	skv.blockCache = make(map[string]*KvStash)
+
+	err = skv.setChangeSet(skv.nowBlock, changes)
+	if err != nil {
+		return NullHash, err
+	}
+	if committed {
+		return stateRoot, nil
+	}
+	count, err := skv.appendCommit(skv.nowBlock)
+	if err != nil {
+		return NullHash, err
+	}
+	if skv.isPruneMode() {
+		err = skv.prune(count)
+		if err != nil {
+			return NullHash, err
+		}
+	}
 	return stateRoot, nil
 }
 
+// collectChanges compares the final writes of the block with the state of trie,
+// in the order that the keys are first written.
+func (skv *StateKV) collectChanges(trie *mpt.Trie) ([]*StateChange, error) {
+	changes := make([]*StateChange, 0)
+	seen := make(map[string]bool)
+	for _, stash := range skv.stashes {
+		key := string(stash.Key)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		oldValue, err := trie.TryGet(stash.Key)
+		if err != nil {
+			return nil, err
+		}
+		newValue := skv.blockCache[key].Value
+		if bytes.Equal(oldValue, newValue) {
+			continue
+		}
+		changes = append(changes, newStateChange(stash.Key, oldValue, newValue))
+	}
+	return changes, nil
+}
+
 func (skv *StateKV) Discard() {
 	skv.nowStashes = nil
+	skv.nowCache = make(map[string]*KvStash)
+	skv.snapshots = nil
+}
+
+// Snapshot marks the current writes of the txn and returns the id of the mark.
+// Snapshots are only valid in the current txn.
+func (skv *StateKV) Snapshot() int {
+	skv.snapshots = append(skv.snapshots, len(skv.nowStashes))
+	return len(skv.snapshots) - 1
+}
+
+// RevertTo drops the writes of the txn after the snapshot id,
+// together with the snapshots taken after it.
+func (skv *StateKV) RevertTo(id int) error {
+	if id < 0 || id >= len(skv.snapshots) {
+		return SnapshotIdIllegal(id)
+	}
+	skv.nowStashes = skv.nowStashes[:skv.snapshots[id]]
+	skv.snapshots = skv.snapshots[:id]
+
+	skv.nowCache = make(map[string]*KvStash)
+	for _, stash := range skv.nowStashes {
+		skv.nowCache[string(stash.Key)] = stash
+	}
+	return nil
 }
 
 func (skv *StateKV) DiscardAll() {
@@ -155,6 +338,7 @@ func (skv *StateKV) DiscardAll() {
 	}
 
 	skv.stashes = nil
+	skv.blockCache = make(map[string]*KvStash)
 }
 
 func (skv *StateKV) StartBlock(blockHash Hash) {
@@ -165,6 +349,27 @@ func (skv *StateKV) SetCanRead(blockHash Hash) {
 	skv.canReadBlock = blockHash
 }
 
+// CanReadBlock returns the block whose state the next block is built on.
+func (skv *StateKV) CanReadBlock() Hash {
+	return skv.canReadBlock
+}
+
+// StateRoot returns the state root committed by the block.
+func (skv *StateKV) StateRoot(blockHash Hash) (Hash, error) {
+	err := skv.checkPruned(blockHash)
+	if err != nil {
+		return NullHash, err
+	}
+	stateRoot, err := skv.getIndexDB(blockHash)
+	if err != nil {
+		return NullHash, err
+	}
+	if stateRoot == NullHash {
+		return NullHash, StateNotCommitted(blockHash)
+	}
+	return stateRoot, nil
+}
+
 func (skv *StateKV) setIndexDB(blockHash, stateRoot Hash) error {
 	return skv.indexDB.Set(blockHash.Bytes(), stateRoot.Bytes())
 }
@@ -177,9 +382,18 @@ func (skv *StateKV) getIndexDB(blockHash Hash) (Hash, error) {
 	return BytesToHash(stateRoot), nil
 }
 
-func makeKey(triName NameString, key []byte) []byte {
-	tripodName := []byte(triName.Name())
-	return append(tripodName, key...)
+type stateIterator struct {
+	*mpt.Iterator
+	// length of tripod namespace in the key
+	namespace int
+}
+
+func (si *stateIterator) Entry() ([]byte, []byte, error) {
+	key, value, err := si.Iterator.Entry()
+	if key != nil {
+		key = key[si.namespace:]
+	}
+	return key, value, err
 }
 
 type Ops int
@@ -1,8 +1,12 @@
 package state
 
 import (
+	"bytes"
+	"fmt"
 	. "github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/config"
+	"github.com/Lawliet-Chan/yu/trie/mpt"
+	"github.com/Lawliet-Chan/yu/yerror"
 	"os"
 	"testing"
 )
@@ -62,3 +66,575 @@ func removeTestDB() {
 	os.RemoveAll(TestStateKvCfg.NodeBase.Path)
 	os.RemoveAll(TestStateKvCfg.IndexDB.Path)
 }
+
+func TestGetWithProof(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+
+	statekv.Set(tri, []byte("dayu-key"), []byte("dayu-value"))
+	statekv.NextTxn()
+
+	stateRoot, err := statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit state-kv error: %s", err.Error())
+	}
+
+	value, proof, err := statekv.GetWithProof(tri, []byte("dayu-key"), NullHash)
+	if err != nil {
+		t.Fatalf("get state-kv with proof error: %s", err.Error())
+	}
+	if string(value) != "dayu-value" {
+		t.Fatalf("get value is %s, want dayu-value", string(value))
+	}
+
+	provedValue, err := VerifyProof(stateRoot, tri, []byte("dayu-key"), proof)
+	if err != nil {
+		t.Fatalf("verify proof error: %s", err.Error())
+	}
+	if string(provedValue) != "dayu-value" {
+		t.Fatalf("proved value is %s, want dayu-value", string(provedValue))
+	}
+}
+
+func TestPruneStates(t *testing.T) {
+	cfg := *TestStateKvCfg
+	cfg.Prune = config.PruneConf{
+		Mode:       config.PruneMode,
+		KeepBlocks: 2,
+		GcInterval: 1,
+	}
+	statekv, err := NewStateKV(&cfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+
+	var (
+		blocks []Hash
+		roots  []Hash
+	)
+	for i := 1; i <= 4; i++ {
+		blockHash := BytesToHash([]byte{byte(i)})
+		statekv.StartBlock(blockHash)
+		statekv.Set(tri, []byte("dayu-key"), []byte{byte(i)})
+		statekv.NextTxn()
+		stateRoot, err := statekv.Commit()
+		if err != nil {
+			t.Fatalf("commit state-kv error: %s", err.Error())
+		}
+		statekv.SetCanRead(blockHash)
+		blocks = append(blocks, blockHash)
+		roots = append(roots, stateRoot)
+	}
+
+	_, err = statekv.GetByBlockHash(tri, []byte("dayu-key"), blocks[1])
+	if _, ok := err.(yerror.ErrStatePruned); !ok {
+		t.Fatalf("get pruned state should return ErrStatePruned, but got %v", err)
+	}
+	if node, _ := statekv.nodeBase.Get(roots[1].Bytes()); node != nil {
+		t.Fatalf("trie nodes of pruned state-root(%s) are not swept", roots[1].String())
+	}
+
+	for i := 2; i < 4; i++ {
+		value, err := statekv.GetByBlockHash(tri, []byte("dayu-key"), blocks[i])
+		if err != nil {
+			t.Fatalf("get state of block(%d) error: %s", i+1, err.Error())
+		}
+		if len(value) != 1 || value[0] != byte(i+1) {
+			t.Fatalf("get state of block(%d) is %v", i+1, value)
+		}
+	}
+}
+
+func TestPruneAfterRevert(t *testing.T) {
+	cfg := *TestStateKvCfg
+	cfg.Prune = config.PruneConf{
+		Mode:       config.PruneMode,
+		KeepBlocks: 2,
+	}
+	statekv, err := NewStateKV(&cfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+	commit := func(i byte) Hash {
+		blockHash := BytesToHash([]byte{i})
+		statekv.StartBlock(blockHash)
+		statekv.Set(tri, []byte("dayu-key"), []byte{i})
+		statekv.NextTxn()
+		_, err := statekv.Commit()
+		if err != nil {
+			t.Fatalf("commit block(%d) error: %s", i, err.Error())
+		}
+		statekv.SetCanRead(blockHash)
+		return blockHash
+	}
+	for i := byte(1); i <= 4; i++ {
+		commit(i)
+	}
+
+	// blocks 1 and 2 are pruned, the next commits must not prune them again.
+	block3 := BytesToHash([]byte{3})
+	err = statekv.RevertToBlock(block3)
+	if err != nil {
+		t.Fatalf("revert to block3 error: %s", err.Error())
+	}
+	block5 := commit(5)
+	assertGetByBlock(t, statekv, tri, block3, 3)
+	assertGetByBlock(t, statekv, tri, block5, 5)
+	if err = statekv.checkPruned(NullHash); err != nil {
+		t.Fatalf("null hash is marked pruned: %v", err)
+	}
+
+	block6 := commit(6)
+	_, err = statekv.GetByBlockHash(tri, []byte("dayu-key"), block3)
+	if _, ok := err.(yerror.ErrStatePruned); !ok {
+		t.Fatalf("get pruned state of block3, error: %v", err)
+	}
+	assertGetByBlock(t, statekv, tri, block5, 5)
+	assertGetByBlock(t, statekv, tri, block6, 6)
+}
+
+func assertGetByBlock(t *testing.T, statekv *StateKV, tri *TestTripod, blockHash Hash, want byte) {
+	value, err := statekv.GetByBlockHash(tri, []byte("dayu-key"), blockHash)
+	if err != nil {
+		t.Fatalf("get state of block(%s) error: %s", blockHash.String(), err.Error())
+	}
+	if len(value) != 1 || value[0] != want {
+		t.Fatalf("get state of block(%s) is %v, want %d", blockHash.String(), value, want)
+	}
+}
+
+type OtherTripod struct{}
+
+func (ot *OtherTripod) Name() string {
+	return "other-tripod"
+}
+
+func TestIterState(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+	other := &OtherTripod{}
+
+	statekv.Set(tri, []byte("account-1"), []byte("1"))
+	statekv.Set(tri, []byte("account-2"), []byte("2"))
+	statekv.Set(tri, []byte("config"), []byte("c"))
+	statekv.Set(other, []byte("account-3"), []byte("3"))
+	statekv.NextTxn()
+
+	_, err = statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit state-kv error: %s", err.Error())
+	}
+
+	iter, err := statekv.Iter(tri, []byte("account-"), NullHash)
+	if err != nil {
+		t.Fatalf("iter state-kv error: %s", err.Error())
+	}
+	defer iter.Close()
+
+	var keys []string
+	for iter.Valid() {
+		key, _, err := iter.Entry()
+		if err != nil {
+			t.Fatalf("get entry error: %s", err.Error())
+		}
+		keys = append(keys, string(key))
+		err = iter.Next()
+		if err != nil {
+			t.Fatalf("iterate next error: %s", err.Error())
+		}
+	}
+	if len(keys) != 2 || keys[0] != "account-1" || keys[1] != "account-2" {
+		t.Fatalf("iterate keys are %v", keys)
+	}
+}
+
+type namedTripod string
+
+func (nt namedTripod) Name() string {
+	return string(nt)
+}
+
+func TestNamespaceNoCollision(t *testing.T) {
+	asse, asset := namedTripod("asse"), namedTripod("asset")
+	if bytes.Equal(makeKey(asse, []byte("t-key")), makeKey(asset, []byte("-key"))) {
+		t.Fatal("keys of different tripods collide")
+	}
+}
+
+func TestMigrateNamespace(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	// write the state in the old namespace: tripodName | key
+	oldTrie, err := mpt.NewTrie(mpt.EmptyRoot, statekv.nodeBase)
+	if err != nil {
+		t.Fatalf("new trie error: %s", err.Error())
+	}
+	oldTrie.Update([]byte("asse"+"t-key"), []byte("asse-value"))
+	oldTrie.Update([]byte("asset"+"key"), []byte("asset-value"))
+	oldRoot, err := oldTrie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit trie error: %s", err.Error())
+	}
+	blockHash := HexToHash("0x1")
+	err = statekv.setIndexDB(blockHash, oldRoot)
+	if err != nil {
+		t.Fatalf("set indexDB error: %s", err.Error())
+	}
+
+	err = statekv.MigrateNamespace([]string{"asse", "asset", "zoo"})
+	if err != nil {
+		t.Fatalf("migrate namespace error: %s", err.Error())
+	}
+
+	value, err := statekv.GetByBlockHash(namedTripod("asset"), []byte("key"), blockHash)
+	if err != nil {
+		t.Fatalf("get state error: %s", err.Error())
+	}
+	if string(value) != "asset-value" {
+		t.Fatalf("value of asset is %s", value)
+	}
+	value, err = statekv.GetByBlockHash(namedTripod("asse"), []byte("t-key"), blockHash)
+	if err != nil {
+		t.Fatalf("get state error: %s", err.Error())
+	}
+	// the old key "asset-key" is given to the longest tripod name.
+	if value != nil {
+		t.Fatalf("value of asse is %s", value)
+	}
+
+	// migrating again is a no-op.
+	err = statekv.MigrateNamespace(nil)
+	if err != nil {
+		t.Fatalf("migrate namespace again error: %s", err.Error())
+	}
+}
+
+func TestMigrateNamespaceByCommitSeq(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	oldTrie, err := mpt.NewTrie(mpt.EmptyRoot, statekv.nodeBase)
+	if err != nil {
+		t.Fatalf("new trie error: %s", err.Error())
+	}
+	oldTrie.Update([]byte("asset"+"key"), []byte("asset-value"))
+	oldRoot, err := oldTrie.Commit(nil)
+	if err != nil {
+		t.Fatalf("commit trie error: %s", err.Error())
+	}
+	blockHash := HexToHash("0x1")
+	err = statekv.setIndexDB(blockHash, oldRoot)
+	if err != nil {
+		t.Fatalf("set indexDB error: %s", err.Error())
+	}
+	_, err = statekv.appendCommit(blockHash)
+	if err != nil {
+		t.Fatalf("append commit error: %s", err.Error())
+	}
+	// another key as long as a hash is not taken as a state root.
+	err = statekv.indexDB.Set(Keccak256([]byte("not a block")), Keccak256([]byte("not a root")))
+	if err != nil {
+		t.Fatalf("set indexDB error: %s", err.Error())
+	}
+
+	err = statekv.MigrateNamespace([]string{"asset"})
+	if err != nil {
+		t.Fatalf("migrate namespace error: %s", err.Error())
+	}
+	value, err := statekv.GetByBlockHash(namedTripod("asset"), []byte("key"), blockHash)
+	if err != nil {
+		t.Fatalf("get state error: %s", err.Error())
+	}
+	if string(value) != "asset-value" {
+		t.Fatalf("value of asset is %s", value)
+	}
+}
+
+func TestReadYourWrites(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+
+	statekv.Set(tri, []byte("balance"), []byte("100"))
+	assertGet(t, statekv, tri, "balance", "100")
+	statekv.NextTxn()
+
+	// the next txn in the same block sees the writes of the previous one.
+	assertGet(t, statekv, tri, "balance", "100")
+	statekv.Set(tri, []byte("balance"), []byte("50"))
+	assertGet(t, statekv, tri, "balance", "50")
+
+	// discarding the current txn falls back to the block writes.
+	statekv.Discard()
+	assertGet(t, statekv, tri, "balance", "100")
+
+	statekv.Delete(tri, []byte("balance"))
+	if statekv.Exist(tri, []byte("balance")) {
+		t.Fatal("deleted key still exists")
+	}
+	statekv.NextTxn()
+
+	_, err = statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit state-kv error: %s", err.Error())
+	}
+	if statekv.Exist(tri, []byte("balance")) {
+		t.Fatal("deleted key exists after commit")
+	}
+}
+
+func assertGet(t *testing.T, statekv *StateKV, tri NameString, key, want string) {
+	value, err := statekv.Get(tri, []byte(key))
+	if err != nil {
+		t.Fatalf("get state-kv error: %s", err.Error())
+	}
+	if string(value) != want {
+		t.Fatalf("value of %s is %s, want %s", key, value, want)
+	}
+}
+
+func TestSnapshotRevert(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+
+	statekv.Set(tri, []byte("a"), []byte("1"))
+	outer := statekv.Snapshot()
+	statekv.Set(tri, []byte("a"), []byte("2"))
+	statekv.Set(tri, []byte("b"), []byte("2"))
+	inner := statekv.Snapshot()
+	statekv.Set(tri, []byte("b"), []byte("3"))
+
+	err = statekv.RevertTo(inner)
+	if err != nil {
+		t.Fatalf("revert to inner snapshot error: %s", err.Error())
+	}
+	assertGet(t, statekv, tri, "a", "2")
+	assertGet(t, statekv, tri, "b", "2")
+
+	err = statekv.RevertTo(outer)
+	if err != nil {
+		t.Fatalf("revert to outer snapshot error: %s", err.Error())
+	}
+	assertGet(t, statekv, tri, "a", "1")
+	assertGet(t, statekv, tri, "b", "")
+
+	// the inner snapshot is dropped together with the outer one.
+	err = statekv.RevertTo(inner)
+	if _, ok := err.(yerror.ErrSnapshotIdIllegal); !ok {
+		t.Fatalf("revert to dropped snapshot, error: %v", err)
+	}
+
+	statekv.NextTxn()
+	_, err = statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit state-kv error: %s", err.Error())
+	}
+	assertGet(t, statekv, tri, "a", "1")
+	assertGet(t, statekv, tri, "b", "")
+}
+
+func TestChangeSetAndRevert(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+	block1, block2 := HexToHash("0x1"), HexToHash("0x2")
+
+	statekv.StartBlock(block1)
+	statekv.Set(tri, []byte("a"), []byte("1"))
+	statekv.Set(tri, []byte("b"), []byte("1"))
+	statekv.NextTxn()
+	_, err = statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit block1 error: %s", err.Error())
+	}
+	statekv.SetCanRead(block1)
+
+	statekv.StartBlock(block2)
+	statekv.Set(tri, []byte("a"), []byte("2"))
+	statekv.Delete(tri, []byte("b"))
+	statekv.NextTxn()
+	_, err = statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit block2 error: %s", err.Error())
+	}
+	statekv.SetCanRead(block2)
+
+	cs, err := statekv.GetChangeSet(block2)
+	if err != nil {
+		t.Fatalf("get change set error: %s", err.Error())
+	}
+	if len(cs.Changes) != 2 {
+		t.Fatalf("block2 has %d changes", len(cs.Changes))
+	}
+	change := cs.Changes[0]
+	if change.TripodName != tri.Name() || string(change.Key) != "a" ||
+		string(change.OldValue) != "1" || string(change.NewValue) != "2" {
+		t.Fatalf("change of a is %+v", change)
+	}
+	if cs.Changes[1].NewValue != nil {
+		t.Fatalf("deleted b has new value %s", cs.Changes[1].NewValue)
+	}
+
+	err = statekv.RevertToBlock(block1)
+	if err != nil {
+		t.Fatalf("revert to block1 error: %s", err.Error())
+	}
+	assertGet(t, statekv, tri, "a", "1")
+	assertGet(t, statekv, tri, "b", "1")
+
+	_, err = statekv.GetChangeSet(block2)
+	if _, ok := err.(yerror.ErrStateNotCommitted); !ok {
+		t.Fatalf("change set of reverted block2, error: %v", err)
+	}
+	err = statekv.RevertToBlock(block2)
+	if _, ok := err.(yerror.ErrStateNotCommitted); !ok {
+		t.Fatalf("revert to reverted block2, error: %v", err)
+	}
+
+	err = statekv.RevertToGenesis(NullHash)
+	if err != nil {
+		t.Fatalf("revert to genesis error: %s", err.Error())
+	}
+	assertGet(t, statekv, tri, "a", "")
+	_, err = statekv.StateRoot(block1)
+	if _, ok := err.(yerror.ErrStateNotCommitted); !ok {
+		t.Fatalf("state root of reverted block1, error: %v", err)
+	}
+}
+
+func TestSnapshotExportImport(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	tri := &TestTripod{}
+	blockHash := HexToHash("0x1")
+	statekv.StartBlock(blockHash)
+	for i := 0; i < 50; i++ {
+		statekv.Set(tri, []byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	statekv.NextTxn()
+	stateRoot, err := statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit state-kv error: %s", err.Error())
+	}
+
+	var buf bytes.Buffer
+	err = statekv.ExportSnapshot(blockHash, []byte("block"), &buf)
+	if err != nil {
+		t.Fatalf("export snapshot error: %s", err.Error())
+	}
+	snapshot := buf.Bytes()
+
+	importCfg := &config.StateKvConf{
+		IndexDB:  config.KVconf{KvType: "memory"},
+		NodeBase: config.KVconf{KvType: "memory"},
+	}
+	importer, err := NewStateKV(importCfg)
+	if err != nil {
+		t.Fatalf("new state-kv error: %s", err.Error())
+	}
+
+	_, err = importer.ImportSnapshot(bytes.NewReader(snapshot), HexToHash("0x2"))
+	if _, ok := err.(yerror.ErrSnapshotIllegal); !ok {
+		t.Fatalf("import snapshot with wrong state root, error: %v", err)
+	}
+
+	broken := CopyBytes(snapshot)
+	broken[len(broken)/2] ^= 0xff
+	_, err = importer.ImportSnapshot(bytes.NewReader(broken), stateRoot)
+	if err == nil {
+		t.Fatal("import broken snapshot without error")
+	}
+
+	header, err := importer.ImportSnapshot(bytes.NewReader(snapshot), stateRoot)
+	if err != nil {
+		t.Fatalf("import snapshot error: %s", err.Error())
+	}
+	if header.BlockHash != blockHash || string(header.Block) != "block" {
+		t.Fatalf("block of snapshot is %s", header.BlockHash.String())
+	}
+	importer.SetCanRead(blockHash)
+	for i := 0; i < 50; i++ {
+		assertGet(t, importer, tri, fmt.Sprintf("key-%d", i), fmt.Sprintf("value-%d", i))
+	}
+}
+
+func TestNonce(t *testing.T) {
+	statekv, err := NewStateKV(TestStateKvCfg)
+	if err != nil {
+		panic("new state-kv error: " + err.Error())
+	}
+	defer removeTestDB()
+
+	addr := HexToAddress("0x01")
+	blockHash := HexToHash("0x01")
+	nonce, err := statekv.GetNonceByBlockHash(addr, blockHash)
+	if err != nil {
+		t.Fatalf("get nonce error: %s", err.Error())
+	}
+	if nonce != 0 {
+		t.Fatalf("nonce of new account is %d", nonce)
+	}
+
+	statekv.StartBlock(blockHash)
+	statekv.SetNonce(addr, 1)
+	statekv.NextTxn()
+	nonce, err = statekv.GetNonce(addr)
+	if err != nil {
+		t.Fatalf("get nonce error: %s", err.Error())
+	}
+	if nonce != 1 {
+		t.Fatalf("nonce is %d, want 1", nonce)
+	}
+	_, err = statekv.Commit()
+	if err != nil {
+		t.Fatalf("commit state-kv error: %s", err.Error())
+	}
+
+	nonce, err = statekv.GetNonceByBlockHash(addr, blockHash)
+	if err != nil {
+		t.Fatalf("get nonce error: %s", err.Error())
+	}
+	if nonce != 1 {
+		t.Fatalf("committed nonce is %d, want 1", nonce)
+	}
+}
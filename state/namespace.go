@@ -0,0 +1,180 @@
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/trie/mpt"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"github.com/sirupsen/logrus"
+	"sort"
+)
+
+// namespaceVersionKey in indexDB marks that all the state tries use the
+// length-prefixed namespace of makeKey.
+var namespaceVersionKey = []byte("namespace-version")
+
+const namespaceVersion byte = 1
+
+// makeKey puts the key under the namespace of the tripod:
+// uint16(len(tripodName)) | tripodName | key
+// The length prefix keeps the namespaces of "asse" and "asset" from overlapping.
+func makeKey(triName NameString, key []byte) []byte {
+	name := triName.Name()
+	byt := make([]byte, 2, 2+len(name)+len(key))
+	binary.BigEndian.PutUint16(byt, uint16(len(name)))
+	byt = append(byt, name...)
+	return append(byt, key...)
+}
+
+// MigrateNamespace rewrites the state tries of all the blocks in indexDB
+// from the old namespace (tripodName | key) into the one of makeKey.
+// tripodNames are all the tripods that have ever written state; an old key is
+// given to the longest name it begins with. It only runs once,
+// and marks a new chain as migrated directly.
+func (skv *StateKV) MigrateNamespace(tripodNames []string) error {
+	if skv.indexDB.Exist(namespaceVersionKey) {
+		return nil
+	}
+
+	names := make([]string, len(tripodNames))
+	copy(names, tripodNames)
+	sort.Slice(names, func(i, j int) bool {
+		return len(names[i]) > len(names[j])
+	})
+
+	blocks, roots, err := skv.allStateRoots()
+	if err != nil {
+		return err
+	}
+
+	migrated := make(map[Hash]Hash)
+	for i, blockHash := range blocks {
+		oldRoot := roots[i]
+		newRoot, ok := migrated[oldRoot]
+		if !ok {
+			newRoot, err = skv.migrateTrie(oldRoot, names)
+			if err != nil {
+				return err
+			}
+			migrated[oldRoot] = newRoot
+		}
+		err = skv.setIndexDB(blockHash, newRoot)
+		if err != nil {
+			return err
+		}
+	}
+	logrus.Infof("state namespace migration rewrites %d state tries of %d blocks", len(migrated), len(blocks))
+
+	return skv.indexDB.Set(namespaceVersionKey, []byte{namespaceVersion})
+}
+
+// allStateRoots returns all the blockHash -> stateRoot pairs in indexDB.
+// The committed blocks are enumerated by the commit sequences of history.go,
+// only an indexDB written before them is scanned, which has nothing but the pairs.
+func (skv *StateKV) allStateRoots() ([]Hash, []Hash, error) {
+	if !skv.indexDB.Exist(commitCountKey) {
+		return skv.scanStateRoots()
+	}
+	count, lowest, err := skv.commitRange()
+	if err != nil {
+		return nil, nil, err
+	}
+	var blocks, roots []Hash
+	for seq := lowest; seq <= count; seq++ {
+		blockHash, err := skv.getCommitSeq(seq)
+		if err != nil {
+			return nil, nil, err
+		}
+		stateRoot, err := skv.getIndexDB(blockHash)
+		if err != nil {
+			return nil, nil, err
+		}
+		blocks = append(blocks, blockHash)
+		roots = append(roots, stateRoot)
+	}
+	return blocks, roots, nil
+}
+
+// scanStateRoots returns all the pairs of an indexDB without commit sequences.
+func (skv *StateKV) scanStateRoots() ([]Hash, []Hash, error) {
+	iter, err := skv.indexDB.Iter(nil)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer iter.Close()
+
+	var blocks, roots []Hash
+	for iter.Valid() {
+		key, value, err := iter.Entry()
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(key) == HashLen {
+			blocks = append(blocks, BytesToHash(key))
+			roots = append(roots, BytesToHash(value))
+		}
+		err = iter.Next()
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	return blocks, roots, nil
+}
+
+func (skv *StateKV) migrateTrie(oldRoot Hash, names []string) (Hash, error) {
+	if oldRoot == NullHash || oldRoot == mpt.EmptyRoot {
+		return oldRoot, nil
+	}
+	oldTrie, err := mpt.NewTrie(oldRoot, skv.nodeBase)
+	if err != nil {
+		return NullHash, err
+	}
+	newTrie, err := mpt.NewTrie(mpt.EmptyRoot, skv.nodeBase)
+	if err != nil {
+		return NullHash, err
+	}
+
+	iter, err := oldTrie.NewIterator(nil)
+	if err != nil {
+		return NullHash, err
+	}
+	defer iter.Close()
+
+	for iter.Valid() {
+		key, value, err := iter.Entry()
+		if err != nil {
+			return NullHash, err
+		}
+		newKey, err := migrateKey(key, names)
+		if err != nil {
+			return NullHash, err
+		}
+		err = newTrie.TryUpdate(newKey, CopyBytes(value))
+		if err != nil {
+			return NullHash, err
+		}
+		err = iter.Next()
+		if err != nil {
+			return NullHash, err
+		}
+	}
+	return newTrie.Commit(nil)
+}
+
+// migrateKey converts an old key into the namespace of makeKey,
+// names must be sorted from the longest to the shortest.
+func migrateKey(oldKey []byte, names []string) ([]byte, error) {
+	for _, name := range names {
+		if bytes.HasPrefix(oldKey, []byte(name)) {
+			return makeKey(tripodName(name), oldKey[len(name):]), nil
+		}
+	}
+	return nil, StateKeyNoTripod(oldKey)
+}
+
+type tripodName string
+
+func (t tripodName) Name() string {
+	return string(t)
+}
@@ -0,0 +1,46 @@
+package state
+
+import (
+	"encoding/binary"
+	. "github.com/Lawliet-Chan/yu/common"
+)
+
+// nonceSpace is the namespace of account nonces in state, the leading
+// underscore keeps it apart from the names of tripods.
+type nonceSpace struct{}
+
+func (nonceSpace) Name() string {
+	return "_nonce"
+}
+
+// GetNonce returns the nonce that the next txn of the account must carry,
+// the writes of the current block are included.
+func (skv *StateKV) GetNonce(addr Address) (uint64, error) {
+	value, err := skv.Get(nonceSpace{}, addr.Bytes())
+	if err != nil {
+		return 0, err
+	}
+	return decodeNonce(value), nil
+}
+
+// GetNonceByBlockHash returns the nonce of the account in the state committed by the block.
+func (skv *StateKV) GetNonceByBlockHash(addr Address, blockHash Hash) (uint64, error) {
+	value, err := skv.GetByBlockHash(nonceSpace{}, addr.Bytes(), blockHash)
+	if err != nil {
+		return 0, err
+	}
+	return decodeNonce(value), nil
+}
+
+func (skv *StateKV) SetNonce(addr Address, nonce uint64) {
+	value := make([]byte, 8)
+	binary.BigEndian.PutUint64(value, nonce)
+	skv.Set(nonceSpace{}, addr.Bytes(), value)
+}
+
+func decodeNonce(value []byte) uint64 {
+	if len(value) != 8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(value)
+}
@@ -0,0 +1,100 @@
+package state
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"github.com/sirupsen/logrus"
+)
+
+// indexDB keeps the blocks whose states have been pruned.
+var prunedPrefix = []byte("pruned-")
+
+func (skv *StateKV) isPruneMode() bool {
+	return skv.pruneCfg.Mode == PruneMode
+}
+
+// prune drops the states which fall out of the latest 'KeepBlocks' blocks,
+// and sweeps the trie nodes of the dropped states every 'GcInterval' blocks.
+// count is the number of committed blocks.
+func (skv *StateKV) prune(count uint64) error {
+	keep := skv.pruneCfg.KeepBlocks
+	lowest, err := skv.getLowestSeq()
+	if err != nil {
+		return err
+	}
+	if count < lowest+keep {
+		return nil
+	}
+
+	// the lowest kept sequence is persisted, so the blocks pruned before a revert are not dropped again.
+	for ; lowest+keep <= count; lowest++ {
+		err = skv.dropCommit(lowest)
+		if err != nil {
+			return err
+		}
+	}
+	err = skv.indexDB.Set(lowestSeqKey, uint64ToBytes(lowest))
+	if err != nil {
+		return err
+	}
+
+	if count%skv.pruneCfg.GcInterval == 0 {
+		return skv.gc(lowest, count)
+	}
+	return nil
+}
+
+// dropCommit drops the state of the block committed at seq, and marks the block pruned.
+func (skv *StateKV) dropCommit(seq uint64) error {
+	dropBlock, err := skv.getCommitSeq(seq)
+	if err != nil {
+		return err
+	}
+	err = skv.indexDB.Set(prunedKey(dropBlock), []byte{1})
+	if err != nil {
+		return err
+	}
+	err = skv.indexDB.Delete(dropBlock.Bytes())
+	if err != nil {
+		return err
+	}
+	err = skv.indexDB.Delete(changeSetKey(dropBlock))
+	if err != nil {
+		return err
+	}
+	return skv.indexDB.Delete(commitSeqKey(seq))
+}
+
+// gc sweeps all the trie nodes which are unreachable from the kept states.
+func (skv *StateKV) gc(lowest, count uint64) error {
+	keepRoots := make([]Hash, 0)
+	for seq := lowest; seq <= count; seq++ {
+		blockHash, err := skv.getCommitSeq(seq)
+		if err != nil {
+			return err
+		}
+		stateRoot, err := skv.getIndexDB(blockHash)
+		if err != nil {
+			return err
+		}
+		keepRoots = append(keepRoots, stateRoot)
+	}
+	swept, err := skv.nodeBase.Prune(keepRoots)
+	if err != nil {
+		return err
+	}
+	logrus.Debugf("state gc sweeps %d trie nodes", swept)
+	return nil
+}
+
+func (skv *StateKV) checkPruned(blockHash Hash) error {
+	if skv.indexDB.Exist(prunedKey(blockHash)) {
+		return StatePruned(blockHash)
+	}
+	return nil
+}
+
+func prunedKey(blockHash Hash) []byte {
+	return append(CopyBytes(prunedPrefix), blockHash.Bytes()...)
+}
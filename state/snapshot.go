@@ -0,0 +1,296 @@
+package state
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/trie/mpt"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"github.com/sirupsen/logrus"
+	"hash"
+	"io"
+)
+
+// A snapshot file is: magic | version(uint16) | blockHash | stateRoot |
+// uvarint len(block) | encoded block |
+// entries (uvarint len(key) | key | uvarint len(value) | value)... |
+// end mark (uvarint 0) | count of entries(uint64) | sha256 of all the bytes before.
+// Keys are the keys in the state trie, which contain the tripod namespace.
+var snapshotMagic = []byte("yu-state-snapshot")
+
+const SnapshotVersion uint16 = 2
+
+// the max length of a key or value in snapshot.
+const maxSnapshotItemLen = 1 << 26
+
+// SnapshotHeader describes the state in a snapshot file.
+type SnapshotHeader struct {
+	Version   uint16
+	BlockHash Hash
+	StateRoot Hash
+	// the encoded snapshot block with the producer signature,
+	// so the importer can check StateRoot without having the block.
+	Block []byte
+}
+
+// ExportSnapshot writes the full state of blockHash into w, block is the encoded block of blockHash.
+func (skv *StateKV) ExportSnapshot(blockHash Hash, block []byte, w io.Writer) error {
+	err := skv.checkPruned(blockHash)
+	if err != nil {
+		return err
+	}
+	stateRoot, err := skv.getIndexDB(blockHash)
+	if err != nil {
+		return err
+	}
+	if stateRoot == NullHash {
+		return StateNotCommitted(blockHash)
+	}
+	trie, err := mpt.NewTrie(stateRoot, skv.nodeBase)
+	if err != nil {
+		return err
+	}
+	iter, err := trie.NewIterator(nil)
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	sw := newSnapshotWriter(w)
+	sw.write(snapshotMagic)
+	sw.writeUint16(SnapshotVersion)
+	sw.write(blockHash.Bytes())
+	sw.write(stateRoot.Bytes())
+	sw.writeBytes(block)
+
+	var count uint64
+	for iter.Valid() {
+		key, value, err := iter.Entry()
+		if err != nil {
+			return err
+		}
+		sw.writeBytes(key)
+		sw.writeBytes(value)
+		count++
+		err = iter.Next()
+		if err != nil {
+			return err
+		}
+	}
+	sw.writeUvarint(0)
+	sw.writeUint64(count)
+	if sw.err != nil {
+		return sw.err
+	}
+
+	_, err = sw.w.Write(sw.sum.Sum(nil))
+	if err != nil {
+		return err
+	}
+	logrus.Infof("export state snapshot of block(%s) with %d entries", blockHash.String(), count)
+	return sw.w.Flush()
+}
+
+// ImportSnapshot reads a snapshot from r and checks its state root against stateRoot,
+// which should come from the verified header of the snapshot block.
+// The state of the snapshot block is committed, so the chain can start from it.
+func (skv *StateKV) ImportSnapshot(r io.Reader, stateRoot Hash) (*SnapshotHeader, error) {
+	sr := newSnapshotReader(r)
+	header, err := sr.readHeader()
+	if err != nil {
+		return nil, err
+	}
+	if header.StateRoot != stateRoot {
+		return nil, SnapshotIllegal("state root of snapshot mismatches the block header")
+	}
+
+	trie, err := mpt.NewTrie(mpt.EmptyRoot, skv.nodeBase)
+	if err != nil {
+		return nil, err
+	}
+
+	var count uint64
+	for {
+		key := sr.readBytes()
+		if sr.err != nil {
+			return nil, sr.err
+		}
+		if len(key) == 0 {
+			break
+		}
+		value := sr.readBytes()
+		if sr.err != nil {
+			return nil, sr.err
+		}
+		err = trie.TryUpdate(key, value)
+		if err != nil {
+			return nil, err
+		}
+		count++
+	}
+	entries := sr.readUint64()
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	if entries != count {
+		return nil, SnapshotIllegal("count of entries mismatches")
+	}
+	sum := sr.sum.Sum(nil)
+	checksum := make([]byte, sha256.Size)
+	_, err = io.ReadFull(sr.r, checksum)
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(sum, checksum) {
+		return nil, SnapshotIllegal("checksum mismatches")
+	}
+
+	// check the recomputed root before anything is written.
+	if trie.Hash() != stateRoot {
+		return nil, SnapshotIllegal("recomputed state root mismatches the block header")
+	}
+	_, err = trie.Commit(nil)
+	if err != nil {
+		return nil, err
+	}
+	err = skv.CommitSyncedState(header.BlockHash, stateRoot)
+	if err != nil {
+		return nil, err
+	}
+	logrus.Infof("import state snapshot of block(%s) with %d entries", header.BlockHash.String(), count)
+	return header, nil
+}
+
+// ReadSnapshotHeader reads the header of a snapshot,
+// so the importer can verify the snapshot block before importing.
+func ReadSnapshotHeader(r io.Reader) (*SnapshotHeader, error) {
+	return newSnapshotReader(r).readHeader()
+}
+
+// snapshotWriter writes into w and the checksum together, and keeps the first error.
+type snapshotWriter struct {
+	w   *bufio.Writer
+	sum hash.Hash
+	err error
+}
+
+func newSnapshotWriter(w io.Writer) *snapshotWriter {
+	return &snapshotWriter{
+		w:   bufio.NewWriter(w),
+		sum: sha256.New(),
+	}
+}
+
+func (sw *snapshotWriter) write(byt []byte) {
+	if sw.err != nil {
+		return
+	}
+	_, sw.err = sw.w.Write(byt)
+	sw.sum.Write(byt)
+}
+
+func (sw *snapshotWriter) writeUvarint(u uint64) {
+	buf := make([]byte, binary.MaxVarintLen64)
+	sw.write(buf[:binary.PutUvarint(buf, u)])
+}
+
+func (sw *snapshotWriter) writeUint16(u uint16) {
+	buf := make([]byte, 2)
+	binary.BigEndian.PutUint16(buf, u)
+	sw.write(buf)
+}
+
+func (sw *snapshotWriter) writeUint64(u uint64) {
+	sw.write(uint64ToBytes(u))
+}
+
+func (sw *snapshotWriter) writeBytes(byt []byte) {
+	sw.writeUvarint(uint64(len(byt)))
+	sw.write(byt)
+}
+
+// snapshotReader reads from r and sums the read bytes, and keeps the first error.
+type snapshotReader struct {
+	r   *bufio.Reader
+	sum hash.Hash
+	err error
+}
+
+func newSnapshotReader(r io.Reader) *snapshotReader {
+	return &snapshotReader{
+		r:   bufio.NewReader(r),
+		sum: sha256.New(),
+	}
+}
+
+func (sr *snapshotReader) readHeader() (*SnapshotHeader, error) {
+	magic := sr.read(len(snapshotMagic))
+	if sr.err == nil && !bytes.Equal(magic, snapshotMagic) {
+		return nil, SnapshotIllegal("not a state snapshot")
+	}
+	version := sr.readUint16()
+	if sr.err == nil && version != SnapshotVersion {
+		return nil, SnapshotIllegal("unsupported version")
+	}
+	header := &SnapshotHeader{
+		Version:   version,
+		BlockHash: BytesToHash(sr.read(HashLen)),
+		StateRoot: BytesToHash(sr.read(HashLen)),
+		Block:     sr.readBytes(),
+	}
+	if sr.err != nil {
+		return nil, sr.err
+	}
+	return header, nil
+}
+
+func (sr *snapshotReader) read(n int) []byte {
+	if sr.err != nil {
+		return nil
+	}
+	buf := make([]byte, n)
+	_, sr.err = io.ReadFull(sr.r, buf)
+	sr.sum.Write(buf)
+	return buf
+}
+
+func (sr *snapshotReader) readUvarint() uint64 {
+	if sr.err != nil {
+		return 0
+	}
+	var u uint64
+	u, sr.err = binary.ReadUvarint(sr.r)
+	buf := make([]byte, binary.MaxVarintLen64)
+	sr.sum.Write(buf[:binary.PutUvarint(buf, u)])
+	return u
+}
+
+func (sr *snapshotReader) readUint16() uint16 {
+	buf := sr.read(2)
+	if sr.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint16(buf)
+}
+
+func (sr *snapshotReader) readUint64() uint64 {
+	buf := sr.read(8)
+	if sr.err != nil {
+		return 0
+	}
+	return binary.BigEndian.Uint64(buf)
+}
+
+func (sr *snapshotReader) readBytes() []byte {
+	n := sr.readUvarint()
+	if n == 0 {
+		return nil
+	}
+	if n > maxSnapshotItemLen {
+		sr.err = SnapshotIllegal("item is too large")
+		return nil
+	}
+	return sr.read(int(n))
+}
@@ -0,0 +1,251 @@
+// Package storage provides typed containers over the state of a tripod.
+// Values are encoded by codec.GlobalCodec, and keys are hashed
+// under the namespace of the container name.
+package storage
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/state"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	"github.com/pkg/errors"
+)
+
+// KVDB is the state that containers read and write, *state.StateKV implements it.
+type KVDB interface {
+	Get(triName NameString, key []byte) ([]byte, error)
+	GetByBlockHash(triName NameString, key []byte, blockHash Hash) ([]byte, error)
+	Exist(triName NameString, key []byte) bool
+	Set(triName NameString, key, value []byte)
+	Delete(triName NameString, key []byte)
+}
+
+// base is the storage of a container: the tripod it belongs to,
+// the hashed container name as key prefix, and the default value.
+type base struct {
+	tri    NameString
+	prefix []byte
+	dflt   interface{}
+}
+
+func newBase(tri NameString, name string, dflt interface{}) base {
+	return base{
+		tri:    tri,
+		prefix: Keccak256([]byte(name)),
+		dflt:   dflt,
+	}
+}
+
+// makeKey returns prefix | hash(encode(k1)) | hash(encode(k2)) ...
+func (b *base) makeKey(keys ...interface{}) ([]byte, error) {
+	storageKey := CopyBytes(b.prefix)
+	for _, key := range keys {
+		byt, err := codec.GlobalCodec.EncodeToBytes(key)
+		if err != nil {
+			return nil, errors.Wrap(err, "encode storage key")
+		}
+		storageKey = append(storageKey, Keccak256(byt)...)
+	}
+	return storageKey, nil
+}
+
+func (b *base) get(kvdb KVDB, key []byte, value interface{}) (bool, error) {
+	byt, err := kvdb.Get(b.tri, key)
+	if err != nil {
+		return false, err
+	}
+	return b.decode(byt, value)
+}
+
+func (b *base) getAt(kvdb KVDB, blockHash Hash, key []byte, value interface{}) (bool, error) {
+	byt, err := kvdb.GetByBlockHash(b.tri, key, blockHash)
+	if err != nil {
+		return false, err
+	}
+	return b.decode(byt, value)
+}
+
+// decode decodes byt into value. If byt is nil, the default value
+// is decoded into value instead and false is returned.
+func (b *base) decode(byt []byte, value interface{}) (bool, error) {
+	if byt == nil {
+		if b.dflt == nil {
+			return false, nil
+		}
+		dflt, err := codec.GlobalCodec.EncodeToBytes(b.dflt)
+		if err != nil {
+			return false, errors.Wrap(err, "encode storage default value")
+		}
+		err = codec.GlobalCodec.DecodeBytes(dflt, value)
+		if err != nil {
+			return false, errors.Wrap(err, "decode storage default value")
+		}
+		return false, nil
+	}
+	err := codec.GlobalCodec.DecodeBytes(byt, value)
+	if err != nil {
+		return true, errors.Wrap(err, "decode storage value")
+	}
+	return true, nil
+}
+
+func (b *base) set(kvdb KVDB, key []byte, value interface{}) error {
+	byt, err := codec.GlobalCodec.EncodeToBytes(value)
+	if err != nil {
+		return errors.Wrap(err, "encode storage value")
+	}
+	kvdb.Set(b.tri, key, byt)
+	return nil
+}
+
+// StorageValue stores a single value.
+type StorageValue struct {
+	base
+}
+
+// NewStorageValue creates a StorageValue named name in the state of tri.
+// dflt is returned by Get when the value is not set, nil means no default value.
+func NewStorageValue(tri NameString, name string, dflt interface{}) *StorageValue {
+	return &StorageValue{newBase(tri, name, dflt)}
+}
+
+// Get decodes the value into the pointer value, and reports whether the value is set.
+func (sv *StorageValue) Get(kvdb KVDB, value interface{}) (bool, error) {
+	return sv.get(kvdb, sv.prefix, value)
+}
+
+// GetAt is Get in the state of blockHash.
+func (sv *StorageValue) GetAt(kvdb KVDB, blockHash Hash, value interface{}) (bool, error) {
+	return sv.getAt(kvdb, blockHash, sv.prefix, value)
+}
+
+func (sv *StorageValue) Set(kvdb KVDB, value interface{}) error {
+	return sv.set(kvdb, sv.prefix, value)
+}
+
+func (sv *StorageValue) Exist(kvdb KVDB) bool {
+	return kvdb.Exist(sv.tri, sv.prefix)
+}
+
+func (sv *StorageValue) Delete(kvdb KVDB) {
+	kvdb.Delete(sv.tri, sv.prefix)
+}
+
+// StorageMap stores values by key.
+type StorageMap struct {
+	base
+}
+
+// NewStorageMap creates a StorageMap named name in the state of tri.
+// dflt is returned by Get when the key is not set, nil means no default value.
+func NewStorageMap(tri NameString, name string, dflt interface{}) *StorageMap {
+	return &StorageMap{newBase(tri, name, dflt)}
+}
+
+// Key returns the key of the map entry in the state of the tripod,
+// which is used to get the proof of the entry.
+func (sm *StorageMap) Key(key interface{}) ([]byte, error) {
+	return sm.makeKey(key)
+}
+
+// Get decodes the value of key into the pointer value, and reports whether key is set.
+func (sm *StorageMap) Get(kvdb KVDB, key, value interface{}) (bool, error) {
+	storageKey, err := sm.makeKey(key)
+	if err != nil {
+		return false, err
+	}
+	return sm.get(kvdb, storageKey, value)
+}
+
+// GetAt is Get in the state of blockHash.
+func (sm *StorageMap) GetAt(kvdb KVDB, blockHash Hash, key, value interface{}) (bool, error) {
+	storageKey, err := sm.makeKey(key)
+	if err != nil {
+		return false, err
+	}
+	return sm.getAt(kvdb, blockHash, storageKey, value)
+}
+
+func (sm *StorageMap) Set(kvdb KVDB, key, value interface{}) error {
+	storageKey, err := sm.makeKey(key)
+	if err != nil {
+		return err
+	}
+	return sm.set(kvdb, storageKey, value)
+}
+
+func (sm *StorageMap) Exist(kvdb KVDB, key interface{}) (bool, error) {
+	storageKey, err := sm.makeKey(key)
+	if err != nil {
+		return false, err
+	}
+	return kvdb.Exist(sm.tri, storageKey), nil
+}
+
+func (sm *StorageMap) Delete(kvdb KVDB, key interface{}) error {
+	storageKey, err := sm.makeKey(key)
+	if err != nil {
+		return err
+	}
+	kvdb.Delete(sm.tri, storageKey)
+	return nil
+}
+
+// StorageDoubleMap stores values by a pair of keys.
+type StorageDoubleMap struct {
+	base
+}
+
+// NewStorageDoubleMap creates a StorageDoubleMap named name in the state of tri.
+// dflt is returned by Get when the keys are not set, nil means no default value.
+func NewStorageDoubleMap(tri NameString, name string, dflt interface{}) *StorageDoubleMap {
+	return &StorageDoubleMap{newBase(tri, name, dflt)}
+}
+
+// Key returns the key of the map entry in the state of the tripod,
+// which is used to get the proof of the entry.
+func (sdm *StorageDoubleMap) Key(key1, key2 interface{}) ([]byte, error) {
+	return sdm.makeKey(key1, key2)
+}
+
+// Get decodes the value of (key1, key2) into the pointer value, and reports whether the keys are set.
+func (sdm *StorageDoubleMap) Get(kvdb KVDB, key1, key2, value interface{}) (bool, error) {
+	storageKey, err := sdm.makeKey(key1, key2)
+	if err != nil {
+		return false, err
+	}
+	return sdm.get(kvdb, storageKey, value)
+}
+
+// GetAt is Get in the state of blockHash.
+func (sdm *StorageDoubleMap) GetAt(kvdb KVDB, blockHash Hash, key1, key2, value interface{}) (bool, error) {
+	storageKey, err := sdm.makeKey(key1, key2)
+	if err != nil {
+		return false, err
+	}
+	return sdm.getAt(kvdb, blockHash, storageKey, value)
+}
+
+func (sdm *StorageDoubleMap) Set(kvdb KVDB, key1, key2, value interface{}) error {
+	storageKey, err := sdm.makeKey(key1, key2)
+	if err != nil {
+		return err
+	}
+	return sdm.set(kvdb, storageKey, value)
+}
+
+func (sdm *StorageDoubleMap) Exist(kvdb KVDB, key1, key2 interface{}) (bool, error) {
+	storageKey, err := sdm.makeKey(key1, key2)
+	if err != nil {
+		return false, err
+	}
+	return kvdb.Exist(sdm.tri, storageKey), nil
+}
+
+func (sdm *StorageDoubleMap) Delete(kvdb KVDB, key1, key2 interface{}) error {
+	storageKey, err := sdm.makeKey(key1, key2)
+	if err != nil {
+		return err
+	}
+	kvdb.Delete(sdm.tri, storageKey)
+	return nil
+}
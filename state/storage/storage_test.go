@@ -0,0 +1,132 @@
+package storage
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/state"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	"testing"
+)
+
+type testTripod struct{}
+
+func (tt *testTripod) Name() string {
+	return "test-tripod"
+}
+
+type memKVDB map[string][]byte
+
+func (m memKVDB) Get(triName NameString, key []byte) ([]byte, error) {
+	return m[triName.Name()+string(key)], nil
+}
+
+func (m memKVDB) GetByBlockHash(triName NameString, key []byte, _ Hash) ([]byte, error) {
+	return m.Get(triName, key)
+}
+
+func (m memKVDB) Exist(triName NameString, key []byte) bool {
+	_, ok := m[triName.Name()+string(key)]
+	return ok
+}
+
+func (m memKVDB) Set(triName NameString, key, value []byte) {
+	m[triName.Name()+string(key)] = value
+}
+
+func (m memKVDB) Delete(triName NameString, key []byte) {
+	delete(m, triName.Name()+string(key))
+}
+
+func init() {
+	codec.GlobalCodec = &codec.RlpCodec{}
+}
+
+func TestStorageValue(t *testing.T) {
+	kvdb := make(memKVDB)
+	total := NewStorageValue(&testTripod{}, "total", uint64(10))
+
+	var value uint64
+	exist, err := total.Get(kvdb, &value)
+	if err != nil {
+		t.Fatalf("get value error: %s", err.Error())
+	}
+	if exist || value != 10 {
+		t.Fatalf("default value is %d, exist %v", value, exist)
+	}
+
+	err = total.Set(kvdb, uint64(20))
+	if err != nil {
+		t.Fatalf("set value error: %s", err.Error())
+	}
+	exist, err = total.Get(kvdb, &value)
+	if err != nil {
+		t.Fatalf("get value error: %s", err.Error())
+	}
+	if !exist || value != 20 {
+		t.Fatalf("value is %d, exist %v", value, exist)
+	}
+
+	// decoding into a wrong type returns an error.
+	var wrong []uint64
+	_, err = total.Get(kvdb, &wrong)
+	if err == nil {
+		t.Fatal("decode into wrong type without error")
+	}
+}
+
+func TestStorageMaps(t *testing.T) {
+	kvdb := make(memKVDB)
+	tri := &testTripod{}
+	balances := NewStorageMap(tri, "balances", nil)
+	allowances := NewStorageDoubleMap(tri, "allowances", uint64(0))
+
+	alice, bob := HexToAddress("0x1"), HexToAddress("0x2")
+
+	err := balances.Set(kvdb, alice, uint64(100))
+	if err != nil {
+		t.Fatalf("set map error: %s", err.Error())
+	}
+	var balance uint64
+	exist, err := balances.Get(kvdb, bob, &balance)
+	if err != nil {
+		t.Fatalf("get map error: %s", err.Error())
+	}
+	if exist {
+		t.Fatal("balance of bob exists")
+	}
+	exist, err = balances.Get(kvdb, alice, &balance)
+	if err != nil {
+		t.Fatalf("get map error: %s", err.Error())
+	}
+	if !exist || balance != 100 {
+		t.Fatalf("balance of alice is %d, exist %v", balance, exist)
+	}
+
+	err = allowances.Set(kvdb, alice, bob, uint64(5))
+	if err != nil {
+		t.Fatalf("set double map error: %s", err.Error())
+	}
+	var allowance uint64
+	_, err = allowances.Get(kvdb, bob, alice, &allowance)
+	if err != nil {
+		t.Fatalf("get double map error: %s", err.Error())
+	}
+	if allowance != 0 {
+		t.Fatalf("allowance of (bob, alice) is %d", allowance)
+	}
+	_, err = allowances.Get(kvdb, alice, bob, &allowance)
+	if err != nil {
+		t.Fatalf("get double map error: %s", err.Error())
+	}
+	if allowance != 5 {
+		t.Fatalf("allowance of (alice, bob) is %d", allowance)
+	}
+
+	err = allowances.Delete(kvdb, alice, bob)
+	if err != nil {
+		t.Fatalf("delete double map error: %s", err.Error())
+	}
+	exist, err = allowances.Exist(kvdb, alice, bob)
+	if err != nil || exist {
+		t.Fatalf("deleted allowance exists %v, error %v", exist, err)
+	}
+}
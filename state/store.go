@@ -3,6 +3,8 @@ package state
 import (
 	. "github.com/Lawliet-Chan/yu/common"
 	. "github.com/Lawliet-Chan/yu/config"
+	"github.com/Lawliet-Chan/yu/trie/mpt"
+	"io"
 )
 
 type StateStore struct {
@@ -25,6 +27,14 @@ func (ss *StateStore) SetCanRead(blockHash Hash) {
 	ss.KVDB.SetCanRead(blockHash)
 }
 
+func (ss *StateStore) CanReadBlock() Hash {
+	return ss.KVDB.CanReadBlock()
+}
+
+func (ss *StateStore) StateRoot(blockHash Hash) (Hash, error) {
+	return ss.KVDB.StateRoot(blockHash)
+}
+
 func (ss *StateStore) Commit() (Hash, error) {
 	return ss.KVDB.Commit()
 }
@@ -37,6 +47,62 @@ func (ss *StateStore) DiscardAll() {
 	ss.KVDB.DiscardAll()
 }
 
+func (ss *StateStore) Snapshot() int {
+	return ss.KVDB.Snapshot()
+}
+
+func (ss *StateStore) RevertTo(id int) error {
+	return ss.KVDB.RevertTo(id)
+}
+
+func (ss *StateStore) GetChangeSet(blockHash Hash) (*ChangeSet, error) {
+	return ss.KVDB.GetChangeSet(blockHash)
+}
+
+func (ss *StateStore) RevertToBlock(blockHash Hash) error {
+	return ss.KVDB.RevertToBlock(blockHash)
+}
+
+func (ss *StateStore) RevertToGenesis(genesisHash Hash) error {
+	return ss.KVDB.RevertToGenesis(genesisHash)
+}
+
+func (ss *StateStore) ExportSnapshot(blockHash Hash, block []byte, w io.Writer) error {
+	return ss.KVDB.ExportSnapshot(blockHash, block, w)
+}
+
+func (ss *StateStore) ImportSnapshot(r io.Reader, stateRoot Hash) (*SnapshotHeader, error) {
+	return ss.KVDB.ImportSnapshot(r, stateRoot)
+}
+
+func (ss *StateStore) GetTrieNodes(hashes []Hash) ([][]byte, error) {
+	return ss.KVDB.GetTrieNodes(hashes)
+}
+
+func (ss *StateStore) NewStateSync(stateRoot Hash) *mpt.Sync {
+	return ss.KVDB.NewStateSync(stateRoot)
+}
+
+func (ss *StateStore) CommitSyncedState(blockHash, stateRoot Hash) error {
+	return ss.KVDB.CommitSyncedState(blockHash, stateRoot)
+}
+
 func (ss *StateStore) NextTxn() {
 	ss.KVDB.NextTxn()
 }
+
+func (ss *StateStore) MigrateNamespace(tripodNames []string) error {
+	return ss.KVDB.MigrateNamespace(tripodNames)
+}
+
+func (ss *StateStore) GetNonce(addr Address) (uint64, error) {
+	return ss.KVDB.GetNonce(addr)
+}
+
+func (ss *StateStore) GetNonceByBlockHash(addr Address, blockHash Hash) (uint64, error) {
+	return ss.KVDB.GetNonceByBlockHash(addr, blockHash)
+}
+
+func (ss *StateStore) SetNonce(addr Address, nonce uint64) {
+	ss.KVDB.SetNonce(addr, nonce)
+}
@@ -0,0 +1,39 @@
+package state
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/trie/mpt"
+)
+
+// GetTrieNodes returns the encoded trie nodes of hashes, nil for the missing ones.
+func (skv *StateKV) GetTrieNodes(hashes []Hash) ([][]byte, error) {
+	nodes := make([][]byte, len(hashes))
+	for i, hash := range hashes {
+		blob, err := skv.nodeBase.Get(hash.Bytes())
+		if err != nil {
+			return nil, err
+		}
+		nodes[i] = blob
+	}
+	return nodes, nil
+}
+
+// NewStateSync starts to download the state trie of stateRoot.
+// After the sync is done, call CommitSyncedState to make it the state of a block.
+func (skv *StateKV) NewStateSync(stateRoot Hash) *mpt.Sync {
+	return mpt.NewSync(stateRoot, skv.nodeBase)
+}
+
+// CommitSyncedState commits stateRoot, whose trie is downloaded or imported, as the state of blockHash.
+func (skv *StateKV) CommitSyncedState(blockHash, stateRoot Hash) error {
+	_, err := mpt.NewTrie(stateRoot, skv.nodeBase)
+	if err != nil {
+		return err
+	}
+	err = skv.setIndexDB(blockHash, stateRoot)
+	if err != nil {
+		return err
+	}
+	_, err = skv.appendCommit(blockHash)
+	return err
+}
@@ -31,14 +31,14 @@ func (bg *badgerKV) Get(key []byte) ([]byte, error) {
 	var valCopy []byte
 	err := bg.db.View(func(txn *badger.Txn) error {
 		item, err := txn.Get(key)
+		if err == badger.ErrKeyNotFound {
+			return nil
+		}
 		if err != nil {
 			return err
 		}
-		err = item.Value(func(val []byte) error {
-			valCopy = append(valCopy, val...)
-			return nil
-		})
-		return nil
+		valCopy, err = copyValue(item)
+		return err
 	})
 	return valCopy, err
 }
@@ -61,16 +61,19 @@ func (bg *badgerKV) Exist(key []byte) bool {
 }
 
 func (bg *badgerKV) Iter(key []byte) (Iterator, error) {
-	var iter *badger.Iterator
-	err := bg.db.View(func(txn *badger.Txn) error {
-		iter = txn.NewIterator(badger.DefaultIteratorOptions)
-		iter.Seek(key)
-		return nil
-	})
+	return bg.IterFrom(key, key)
+}
+
+func (bg *badgerKV) IterFrom(prefix, start []byte) (Iterator, error) {
+	// the read-only txn must be alive until the iterator is closed.
+	txn := bg.db.NewTransaction(false)
+	iter := txn.NewIterator(badger.DefaultIteratorOptions)
+	iter.Seek(start)
 	return &badgerIterator{
-		key:  key,
+		key:  prefix,
 		iter: iter,
-	}, err
+		txn:  txn,
+	}, nil
 }
 
 func (bg *badgerKV) NewKvTxn() (KvTxn, error) {
@@ -80,9 +83,16 @@ func (bg *badgerKV) NewKvTxn() (KvTxn, error) {
 	}, nil
 }
 
+// NewBatch returns a Batch written in one badger txn,
+// so a batch larger than the txn limit of badger fails with ErrTxnTooBig.
+func (bg *badgerKV) NewBatch() Batch {
+	return newTxnBatch(bg)
+}
+
 type badgerIterator struct {
 	key  []byte
 	iter *badger.Iterator
+	txn  *badger.Txn
 }
 
 func (bgi *badgerIterator) Valid() bool {
@@ -97,7 +107,7 @@ func (bgi *badgerIterator) Next() error {
 func (bgi *badgerIterator) Entry() ([]byte, []byte, error) {
 	var value []byte
 	item := bgi.iter.Item()
-	key := item.Key()
+	key := item.KeyCopy(nil)
 	err := item.Value(func(val []byte) error {
 		value = append(value, val...)
 		return nil
@@ -107,6 +117,7 @@ func (bgi *badgerIterator) Entry() ([]byte, []byte, error) {
 
 func (bgi *badgerIterator) Close() {
 	bgi.iter.Close()
+	bgi.txn.Discard()
 }
 
 type badgerTxn struct {
@@ -115,15 +126,13 @@ type badgerTxn struct {
 
 func (bt *badgerTxn) Get(key []byte) ([]byte, error) {
 	item, err := bt.tx.Get(key)
+	if err == badger.ErrKeyNotFound {
+		return nil, nil
+	}
 	if err != nil {
 		return nil, err
 	}
-	var value []byte
-	err = item.Value(func(val []byte) error {
-		value = append(value, val...)
-		return nil
-	})
-	return value, err
+	return copyValue(item)
 }
 
 func (bt *badgerTxn) Set(key, value []byte) error {
@@ -142,3 +151,13 @@ func (bt *badgerTxn) Rollback() error {
 	bt.tx.Discard()
 	return nil
 }
+
+// copyValue returns a non-nil value for an existing key, even if the value is empty.
+func copyValue(item *badger.Item) ([]byte, error) {
+	value := make([]byte, 0, item.ValueSize())
+	err := item.Value(func(val []byte) error {
+		value = append(value, val...)
+		return nil
+	})
+	return value, err
+}
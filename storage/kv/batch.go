@@ -0,0 +1,69 @@
+package kv
+
+// Batch buffers writes in memory, and writes them into the KV atomically.
+type Batch interface {
+	Set(key, value []byte) error
+	Delete(key []byte) error
+	// Write writes all the buffered writes in one KvTxn.
+	Write() error
+	// Reset drops all the buffered writes.
+	Reset()
+	// Len returns the number of buffered writes.
+	Len() int
+}
+
+type batchOp struct {
+	key   []byte
+	value []byte
+	del   bool
+}
+
+// txnBatch is a Batch for the KVs whose KvTxn is atomic.
+type txnBatch struct {
+	kv  KV
+	ops []batchOp
+}
+
+func newTxnBatch(kv KV) *txnBatch {
+	return &txnBatch{kv: kv}
+}
+
+func (tb *txnBatch) Set(key, value []byte) error {
+	tb.ops = append(tb.ops, batchOp{key: key, value: value})
+	return nil
+}
+
+func (tb *txnBatch) Delete(key []byte) error {
+	tb.ops = append(tb.ops, batchOp{key: key, del: true})
+	return nil
+}
+
+func (tb *txnBatch) Write() error {
+	if len(tb.ops) == 0 {
+		return nil
+	}
+	txn, err := tb.kv.NewKvTxn()
+	if err != nil {
+		return err
+	}
+	for _, op := range tb.ops {
+		if op.del {
+			err = txn.Delete(op.key)
+		} else {
+			err = txn.Set(op.key, op.value)
+		}
+		if err != nil {
+			txn.Rollback()
+			return err
+		}
+	}
+	return txn.Commit()
+}
+
+func (tb *txnBatch) Reset() {
+	tb.ops = nil
+}
+
+func (tb *txnBatch) Len() int {
+	return len(tb.ops)
+}
@@ -65,16 +65,24 @@ func (b *boltKV) Exist(key []byte) bool {
 }
 
 func (b *boltKV) Iter(keyPrefix []byte) (Iterator, error) {
-	var c *bbolt.Cursor
-	err := b.db.View(func(tx *bbolt.Tx) error {
-		c = tx.Bucket(bucket).Cursor()
-		c.Seek(keyPrefix)
-		return nil
-	})
+	return b.IterFrom(keyPrefix, keyPrefix)
+}
+
+func (b *boltKV) IterFrom(keyPrefix, start []byte) (Iterator, error) {
+	// the read-only tx must be alive until the iterator is closed.
+	tx, err := b.db.Begin(false)
+	if err != nil {
+		return nil, err
+	}
+	c := tx.Bucket(bucket).Cursor()
+	key, value := c.Seek(start)
 	return &boltIterator{
-		c:         c,
 		keyPrefix: keyPrefix,
-	}, err
+		key:       key,
+		value:     value,
+		c:         c,
+		tx:        tx,
+	}, nil
 }
 
 func (b *boltKV) NewKvTxn() (KvTxn, error) {
@@ -87,11 +95,16 @@ func (b *boltKV) NewKvTxn() (KvTxn, error) {
 	}, nil
 }
 
+func (b *boltKV) NewBatch() Batch {
+	return newTxnBatch(b)
+}
+
 type boltIterator struct {
 	keyPrefix []byte
 	key       []byte
 	value     []byte
 	c         *bbolt.Cursor
+	tx        *bbolt.Tx
 }
 
 func (bi *boltIterator) Valid() bool {
@@ -108,7 +121,7 @@ func (bi *boltIterator) Entry() ([]byte, []byte, error) {
 }
 
 func (bi *boltIterator) Close() {
-
+	bi.tx.Rollback()
 }
 
 type boltTxn struct {
@@ -13,7 +13,11 @@ type KV interface {
 	Delete(key []byte) error
 	Exist(key []byte) bool
 	Iter(key []byte) (Iterator, error)
+	// IterFrom iterates the keys with prefix from the first one not less than start,
+	// start must begin with prefix.
+	IterFrom(prefix, start []byte) (Iterator, error)
 	NewKvTxn() (KvTxn, error)
+	NewBatch() Batch
 }
 
 func NewKV(cfg *KVconf) (KV, error) {
@@ -22,6 +26,10 @@ func NewKV(cfg *KVconf) (KV, error) {
 		return NewBadger(cfg.Path)
 	case "bolt":
 		return NewBolt(cfg.Path)
+	case "pebble":
+		return NewPebble(cfg.Path)
+	case "memory":
+		return NewMemory(), nil
 	//case "tikv":
 	//	return NewTiKV(cfg.Path)
 
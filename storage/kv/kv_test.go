@@ -0,0 +1,227 @@
+package kv
+
+import (
+	"bytes"
+	. "github.com/Lawliet-Chan/yu/config"
+	"os"
+	"testing"
+)
+
+// every backend must pass the conformance suite.
+var backends = []*KVconf{
+	{KvType: "bolt", Path: "./conformance_bolt"},
+	{KvType: "badger", Path: "./conformance_badger"},
+	{KvType: "pebble", Path: "./conformance_pebble"},
+	{KvType: "memory"},
+}
+
+func TestConformance(t *testing.T) {
+	suite := map[string]func(*testing.T, KV){
+		"GetSetDelete": testGetSetDelete,
+		"Iter":         testIter,
+		"IterFrom":     testIterFrom,
+		"KvTxn":        testKvTxn,
+		"Batch":        testBatch,
+	}
+	for _, cfg := range backends {
+		for name, fn := range suite {
+			// KV cannot be closed, so every test has its own path.
+			cfg, fn := *cfg, fn
+			if cfg.Path != "" {
+				cfg.Path += "_" + name
+			}
+			t.Run(cfg.KvType+"/"+name, func(t *testing.T) {
+				if cfg.Path != "" {
+					defer os.RemoveAll(cfg.Path)
+				}
+				kv, err := NewKV(&cfg)
+				if err != nil {
+					t.Fatalf("new %s error: %s", cfg.KvType, err.Error())
+				}
+				fn(t, kv)
+			})
+		}
+	}
+}
+
+func testGetSetDelete(t *testing.T, kv KV) {
+	value, err := kv.Get([]byte("missing"))
+	if err != nil {
+		t.Fatalf("get missing key error: %s", err.Error())
+	}
+	if value != nil || kv.Exist([]byte("missing")) {
+		t.Fatal("missing key exists")
+	}
+
+	err = kv.Set([]byte("key"), []byte("value"))
+	if err != nil {
+		t.Fatalf("set error: %s", err.Error())
+	}
+	assertValue(t, kv.Get, "key", "value")
+	if !kv.Exist([]byte("key")) {
+		t.Fatal("key not exists")
+	}
+
+	err = kv.Set([]byte("empty"), []byte{})
+	if err != nil {
+		t.Fatalf("set empty value error: %s", err.Error())
+	}
+	if !kv.Exist([]byte("empty")) {
+		t.Fatal("key with empty value not exists")
+	}
+
+	err = kv.Delete([]byte("key"))
+	if err != nil {
+		t.Fatalf("delete error: %s", err.Error())
+	}
+	if kv.Exist([]byte("key")) {
+		t.Fatal("deleted key exists")
+	}
+}
+
+func testIter(t *testing.T, kv KV) {
+	for _, key := range []string{"b-2", "a-1", "b-1", "c-1", "b-3"} {
+		err := kv.Set([]byte(key), []byte("v"+key))
+		if err != nil {
+			t.Fatalf("set error: %s", err.Error())
+		}
+	}
+
+	iter, err := kv.Iter([]byte("b-"))
+	if err != nil {
+		t.Fatalf("iter error: %s", err.Error())
+	}
+	defer iter.Close()
+
+	var keys []string
+	for iter.Valid() {
+		key, value, err := iter.Entry()
+		if err != nil {
+			t.Fatalf("entry error: %s", err.Error())
+		}
+		if string(value) != "v"+string(key) {
+			t.Fatalf("value of %s is %s", key, value)
+		}
+		keys = append(keys, string(key))
+		err = iter.Next()
+		if err != nil {
+			t.Fatalf("next error: %s", err.Error())
+		}
+	}
+	if len(keys) != 3 || keys[0] != "b-1" || keys[1] != "b-2" || keys[2] != "b-3" {
+		t.Fatalf("iterate keys are %v", keys)
+	}
+}
+
+func testIterFrom(t *testing.T, kv KV) {
+	for _, key := range []string{"b-2", "a-1", "b-1", "c-1", "b-3"} {
+		err := kv.Set([]byte(key), []byte("v"+key))
+		if err != nil {
+			t.Fatalf("set error: %s", err.Error())
+		}
+	}
+
+	iter, err := kv.IterFrom([]byte("b-"), []byte("b-15"))
+	if err != nil {
+		t.Fatalf("iter error: %s", err.Error())
+	}
+	defer iter.Close()
+
+	var keys []string
+	for iter.Valid() {
+		key, _, err := iter.Entry()
+		if err != nil {
+			t.Fatalf("entry error: %s", err.Error())
+		}
+		keys = append(keys, string(key))
+		err = iter.Next()
+		if err != nil {
+			t.Fatalf("next error: %s", err.Error())
+		}
+	}
+	if len(keys) != 2 || keys[0] != "b-2" || keys[1] != "b-3" {
+		t.Fatalf("iterate keys are %v", keys)
+	}
+}
+
+func testKvTxn(t *testing.T, kv KV) {
+	err := kv.Set([]byte("old"), []byte("old"))
+	if err != nil {
+		t.Fatalf("set error: %s", err.Error())
+	}
+
+	txn, err := kv.NewKvTxn()
+	if err != nil {
+		t.Fatalf("new txn error: %s", err.Error())
+	}
+	err = txn.Set([]byte("new"), []byte("new"))
+	if err != nil {
+		t.Fatalf("txn set error: %s", err.Error())
+	}
+	err = txn.Delete([]byte("old"))
+	if err != nil {
+		t.Fatalf("txn delete error: %s", err.Error())
+	}
+	// a txn reads its own writes.
+	assertValue(t, txn.Get, "new", "new")
+	assertValue(t, txn.Get, "old", "")
+	err = txn.Commit()
+	if err != nil {
+		t.Fatalf("txn commit error: %s", err.Error())
+	}
+	assertValue(t, kv.Get, "new", "new")
+	assertValue(t, kv.Get, "old", "")
+
+	txn, err = kv.NewKvTxn()
+	if err != nil {
+		t.Fatalf("new txn error: %s", err.Error())
+	}
+	err = txn.Set([]byte("rollback"), []byte("rollback"))
+	if err != nil {
+		t.Fatalf("txn set error: %s", err.Error())
+	}
+	err = txn.Rollback()
+	if err != nil {
+		t.Fatalf("txn rollback error: %s", err.Error())
+	}
+	assertValue(t, kv.Get, "rollback", "")
+}
+
+func testBatch(t *testing.T, kv KV) {
+	err := kv.Set([]byte("old"), []byte("old"))
+	if err != nil {
+		t.Fatalf("set error: %s", err.Error())
+	}
+
+	batch := kv.NewBatch()
+	batch.Set([]byte("new"), []byte("new"))
+	batch.Delete([]byte("old"))
+	if batch.Len() != 2 {
+		t.Fatalf("batch has %d writes", batch.Len())
+	}
+	// nothing is written before Write.
+	assertValue(t, kv.Get, "new", "")
+	assertValue(t, kv.Get, "old", "old")
+
+	err = batch.Write()
+	if err != nil {
+		t.Fatalf("batch write error: %s", err.Error())
+	}
+	assertValue(t, kv.Get, "new", "new")
+	assertValue(t, kv.Get, "old", "")
+
+	batch.Reset()
+	if batch.Len() != 0 {
+		t.Fatalf("reset batch has %d writes", batch.Len())
+	}
+}
+
+func assertValue(t *testing.T, get func([]byte) ([]byte, error), key, want string) {
+	value, err := get([]byte(key))
+	if err != nil {
+		t.Fatalf("get %s error: %s", key, err.Error())
+	}
+	if !bytes.Equal(value, []byte(want)) {
+		t.Fatalf("value of %s is %s, want %s", key, value, want)
+	}
+}
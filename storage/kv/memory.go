@@ -0,0 +1,162 @@
+package kv
+
+import (
+	"bytes"
+	"github.com/Lawliet-Chan/yu/storage"
+	"sort"
+	"sync"
+)
+
+// memoryKV keeps everything in memory and loses it when the process exits,
+// it is for tests and ephemeral dev chains.
+type memoryKV struct {
+	lock sync.RWMutex
+	data map[string][]byte
+}
+
+func NewMemory() *memoryKV {
+	return &memoryKV{data: make(map[string][]byte)}
+}
+
+func (*memoryKV) Type() storage.StoreType {
+	return storage.Embedded
+}
+
+func (*memoryKV) Kind() storage.StoreKind {
+	return storage.KV
+}
+
+func (m *memoryKV) Get(key []byte) ([]byte, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	value, ok := m.data[string(key)]
+	if !ok {
+		return nil, nil
+	}
+	return append([]byte{}, value...), nil
+}
+
+func (m *memoryKV) Set(key []byte, value []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data[string(key)] = append([]byte{}, value...)
+	return nil
+}
+
+func (m *memoryKV) Delete(key []byte) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.data, string(key))
+	return nil
+}
+
+func (m *memoryKV) Exist(key []byte) bool {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	_, ok := m.data[string(key)]
+	return ok
+}
+
+// Iter iterates a snapshot of the keys beginning with keyPrefix.
+func (m *memoryKV) Iter(keyPrefix []byte) (Iterator, error) {
+	return m.IterFrom(keyPrefix, keyPrefix)
+}
+
+func (m *memoryKV) IterFrom(keyPrefix, start []byte) (Iterator, error) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	var entries []memoryEntry
+	for key, value := range m.data {
+		if bytes.HasPrefix([]byte(key), keyPrefix) && bytes.Compare([]byte(key), start) >= 0 {
+			entries = append(entries, memoryEntry{key: []byte(key), value: value})
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return bytes.Compare(entries[i].key, entries[j].key) < 0
+	})
+	return &memoryIterator{entries: entries}, nil
+}
+
+func (m *memoryKV) NewKvTxn() (KvTxn, error) {
+	return &memoryTxn{
+		kv:     m,
+		writes: make(map[string]*batchOp),
+	}, nil
+}
+
+func (m *memoryKV) NewBatch() Batch {
+	return newTxnBatch(m)
+}
+
+type memoryEntry struct {
+	key   []byte
+	value []byte
+}
+
+type memoryIterator struct {
+	entries []memoryEntry
+	pos     int
+}
+
+func (mi *memoryIterator) Valid() bool {
+	return mi.pos < len(mi.entries)
+}
+
+func (mi *memoryIterator) Next() error {
+	mi.pos++
+	return nil
+}
+
+func (mi *memoryIterator) Entry() ([]byte, []byte, error) {
+	entry := mi.entries[mi.pos]
+	return append([]byte{}, entry.key...), append([]byte{}, entry.value...), nil
+}
+
+func (mi *memoryIterator) Close() {
+	mi.entries = nil
+}
+
+// memoryTxn buffers the writes, which are applied under the lock of memoryKV when committed.
+type memoryTxn struct {
+	kv     *memoryKV
+	writes map[string]*batchOp
+}
+
+func (mt *memoryTxn) Get(key []byte) ([]byte, error) {
+	if op, ok := mt.writes[string(key)]; ok {
+		if op.del {
+			return nil, nil
+		}
+		return append([]byte{}, op.value...), nil
+	}
+	return mt.kv.Get(key)
+}
+
+func (mt *memoryTxn) Set(key, value []byte) error {
+	mt.writes[string(key)] = &batchOp{key: key, value: append([]byte{}, value...)}
+	return nil
+}
+
+func (mt *memoryTxn) Delete(key []byte) error {
+	mt.writes[string(key)] = &batchOp{key: key, del: true}
+	return nil
+}
+
+func (mt *memoryTxn) Commit() error {
+	mt.kv.lock.Lock()
+	defer mt.kv.lock.Unlock()
+	for key, op := range mt.writes {
+		if op.del {
+			delete(mt.kv.data, key)
+		} else {
+			mt.kv.data[key] = op.value
+		}
+	}
+	mt.writes = nil
+	return nil
+}
+
+func (mt *memoryTxn) Rollback() error {
+	mt.writes = nil
+	return nil
+}
@@ -0,0 +1,159 @@
+package kv
+
+import (
+	"bytes"
+	"github.com/Lawliet-Chan/yu/storage"
+	"github.com/cockroachdb/pebble"
+	"io"
+)
+
+type pebbleKV struct {
+	db *pebble.DB
+}
+
+func NewPebble(path string) (*pebbleKV, error) {
+	db, err := pebble.Open(path, &pebble.Options{})
+	if err != nil {
+		return nil, err
+	}
+	return &pebbleKV{db: db}, nil
+}
+
+func (*pebbleKV) Type() storage.StoreType {
+	return storage.Embedded
+}
+
+func (*pebbleKV) Kind() storage.StoreKind {
+	return storage.KV
+}
+
+func (p *pebbleKV) Get(key []byte) ([]byte, error) {
+	return pebbleGet(p.db.Get(key))
+}
+
+func (p *pebbleKV) Set(key []byte, value []byte) error {
+	return p.db.Set(key, value, pebble.Sync)
+}
+
+func (p *pebbleKV) Delete(key []byte) error {
+	return p.db.Delete(key, pebble.Sync)
+}
+
+func (p *pebbleKV) Exist(key []byte) bool {
+	value, _ := p.Get(key)
+	return value != nil
+}
+
+func (p *pebbleKV) Iter(keyPrefix []byte) (Iterator, error) {
+	return p.IterFrom(keyPrefix, keyPrefix)
+}
+
+func (p *pebbleKV) IterFrom(keyPrefix, start []byte) (Iterator, error) {
+	iter := p.db.NewIter(&pebble.IterOptions{LowerBound: start})
+	iter.First()
+	return &pebbleIterator{
+		keyPrefix: keyPrefix,
+		iter:      iter,
+	}, nil
+}
+
+func (p *pebbleKV) NewKvTxn() (KvTxn, error) {
+	return &pebbleTxn{batch: p.db.NewIndexedBatch()}, nil
+}
+
+func (p *pebbleKV) NewBatch() Batch {
+	return &pebbleBatch{batch: p.db.NewBatch()}
+}
+
+// pebbleGet copies the value out of pebble, and returns nil if the key is not found.
+func pebbleGet(value []byte, closer io.Closer, err error) ([]byte, error) {
+	if err == pebble.ErrNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer closer.Close()
+	return append([]byte{}, value...), nil
+}
+
+type pebbleIterator struct {
+	keyPrefix []byte
+	iter      *pebble.Iterator
+}
+
+func (pi *pebbleIterator) Valid() bool {
+	return pi.iter.Valid() && bytes.HasPrefix(pi.iter.Key(), pi.keyPrefix)
+}
+
+func (pi *pebbleIterator) Next() error {
+	pi.iter.Next()
+	return pi.iter.Error()
+}
+
+func (pi *pebbleIterator) Entry() ([]byte, []byte, error) {
+	key := append([]byte{}, pi.iter.Key()...)
+	value := append([]byte{}, pi.iter.Value()...)
+	return key, value, pi.iter.Error()
+}
+
+func (pi *pebbleIterator) Close() {
+	pi.iter.Close()
+}
+
+// pebbleTxn is an indexed batch, which reads its own writes
+// and commits them atomically.
+type pebbleTxn struct {
+	batch *pebble.Batch
+}
+
+func (pt *pebbleTxn) Get(key []byte) ([]byte, error) {
+	return pebbleGet(pt.batch.Get(key))
+}
+
+func (pt *pebbleTxn) Set(key, value []byte) error {
+	return pt.batch.Set(key, value, nil)
+}
+
+func (pt *pebbleTxn) Delete(key []byte) error {
+	return pt.batch.Delete(key, nil)
+}
+
+func (pt *pebbleTxn) Commit() error {
+	err := pt.batch.Commit(pebble.Sync)
+	if err != nil {
+		return err
+	}
+	return pt.batch.Close()
+}
+
+func (pt *pebbleTxn) Rollback() error {
+	return pt.batch.Close()
+}
+
+type pebbleBatch struct {
+	batch *pebble.Batch
+}
+
+func (pb *pebbleBatch) Set(key, value []byte) error {
+	return pb.batch.Set(key, value, nil)
+}
+
+func (pb *pebbleBatch) Delete(key []byte) error {
+	return pb.batch.Delete(key, nil)
+}
+
+func (pb *pebbleBatch) Write() error {
+	if pb.batch.Empty() {
+		return nil
+	}
+	return pb.batch.Commit(pebble.Sync)
+}
+
+func (pb *pebbleBatch) Reset() {
+	pb.batch.Reset()
+}
+
+func (pb *pebbleBatch) Len() int {
+	return int(pb.batch.Count())
+}
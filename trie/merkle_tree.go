@@ -3,11 +3,17 @@ package trie
 import (
 	"crypto/sha256"
 	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/yerror"
 )
 
 // MerkleTree represent a Merkle tree
 type MerkleTree struct {
 	RootNode *MerkleNode
+
+	// nodes of every level, from leaves to root.
+	levels [][]*MerkleNode
+	// number of data, without the padding one.
+	size int
 }
 
 // MerkleNode represent a Merkle tree node
@@ -17,7 +23,15 @@ type MerkleNode struct {
 	Data  Hash
 }
 
-// NewMerkleTree creates a new Merkle tree from a sequence of data
+// MerkleProof proves a leaf is in the tree by the sibling hashes from the leaf up to the root.
+type MerkleProof struct {
+	// index of the leaf, its bits tell whether the siblings are on the left or right.
+	Index    uint64 `json:"index"`
+	Siblings []Hash `json:"siblings"`
+}
+
+// NewMerkleTree creates a new Merkle tree from a sequence of data.
+// The last node of a level is paired with itself if the number of nodes is odd.
 func NewMerkleTree(data []Hash) *MerkleTree {
 	if len(data) == 0 {
 		return &MerkleTree{RootNode: &MerkleNode{
@@ -27,31 +41,63 @@ func NewMerkleTree(data []Hash) *MerkleTree {
 		}}
 	}
 
-	var nodes []MerkleNode
-
-	if len(data)%2 != 0 {
-		data = append(data, data[len(data)-1])
-	}
-
+	nodes := make([]*MerkleNode, 0, len(data))
 	for _, datum := range data {
-		node := newMerkleNode(nil, nil, datum)
-		nodes = append(nodes, *node)
+		nodes = append(nodes, newMerkleNode(nil, nil, datum))
 	}
 
-	for i := 0; i < len(data)/2; i++ {
-		var newLevel []MerkleNode
+	var levels [][]*MerkleNode
+	for {
+		if len(nodes)%2 != 0 {
+			nodes = append(nodes, nodes[len(nodes)-1])
+		}
+		levels = append(levels, nodes)
 
+		var newLevel []*MerkleNode
 		for j := 0; j < len(nodes); j += 2 {
-			node := newMerkleNode(&nodes[j], &nodes[j+1], NullHash)
-			newLevel = append(newLevel, *node)
+			newLevel = append(newLevel, newMerkleNode(nodes[j], nodes[j+1], NullHash))
 		}
-
 		nodes = newLevel
+		if len(nodes) == 1 {
+			break
+		}
 	}
+	levels = append(levels, nodes)
 
-	mTree := MerkleTree{&nodes[0]}
+	return &MerkleTree{RootNode: nodes[0], levels: levels, size: len(data)}
+}
+
+// Proof returns the proof of the data on index.
+func (t *MerkleTree) Proof(index int) (*MerkleProof, error) {
+	if index < 0 || index >= t.size {
+		return nil, MerkleIndexOutOfRange
+	}
+	proof := &MerkleProof{Index: uint64(index)}
+	// the root level has no sibling.
+	for _, level := range t.levels[:len(t.levels)-1] {
+		proof.Siblings = append(proof.Siblings, level[index^1].Data)
+		index /= 2
+	}
+	return proof, nil
+}
 
-	return &mTree
+// VerifyProof reports whether leaf is the data on proof.Index in the tree of root.
+func VerifyProof(root, leaf Hash, proof *MerkleProof) bool {
+	if proof == nil {
+		return false
+	}
+	node := newMerkleNode(nil, nil, leaf)
+	index := proof.Index
+	for _, sibling := range proof.Siblings {
+		siblingNode := &MerkleNode{Data: sibling}
+		if index%2 == 0 {
+			node = newMerkleNode(node, siblingNode, NullHash)
+		} else {
+			node = newMerkleNode(siblingNode, node, NullHash)
+		}
+		index /= 2
+	}
+	return index == 0 && node.Data == root
 }
 
 // NewMerkleNode creates a new Merkle tree node
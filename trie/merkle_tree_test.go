@@ -0,0 +1,42 @@
+package trie
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"strconv"
+	"testing"
+)
+
+func TestMerkleProof(t *testing.T) {
+	for size := 1; size <= 9; size++ {
+		var data []Hash
+		for i := 0; i < size; i++ {
+			data = append(data, Keccak256Hash([]byte(strconv.Itoa(i))))
+		}
+		tree := NewMerkleTree(data)
+		root := tree.RootNode.Data
+
+		for i, leaf := range data {
+			proof, err := tree.Proof(i)
+			if err != nil {
+				t.Fatalf("proof of %d in %d leaves error: %s", i, size, err.Error())
+			}
+			if !VerifyProof(root, leaf, proof) {
+				t.Fatalf("verify proof of %d in %d leaves failed", i, size)
+			}
+			if VerifyProof(root, Keccak256Hash([]byte("other")), proof) {
+				t.Fatalf("verify proof of other leaf as %d in %d leaves", i, size)
+			}
+			// the last leaf of odd size is paired with itself, so its sibling index is the same.
+			proof.Index ^= 1
+			if int(proof.Index) < size && VerifyProof(root, leaf, proof) {
+				t.Fatalf("verify proof of %d on wrong index in %d leaves", i, size)
+			}
+		}
+
+		_, err := tree.Proof(size)
+		if err != MerkleIndexOutOfRange {
+			t.Fatalf("proof of index %d in %d leaves, error: %v", size, size, err)
+		}
+	}
+}
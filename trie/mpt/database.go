@@ -4,29 +4,69 @@ import (
 	. "github.com/Lawliet-Chan/yu/common"
 	"github.com/Lawliet-Chan/yu/config"
 	"github.com/Lawliet-Chan/yu/storage/kv"
+	lru "github.com/hashicorp/golang-lru"
 	"sync"
 )
 
+// the max number of nodes buffered in batch, a large trie such as an imported
+// snapshot is written in several batches to keep each kv txn small.
+//
+// So a commit is not atomic, a crash in the middle of it leaves some nodes of the new trie
+// on disk but never its root, which is written in the last batch. It is safe because:
+//  1. the hasher stores the children before their parent, so every node on disk has its whole
+//     subtree on disk, and Sync which skips the existing subtrees still fetches all the missing nodes;
+//  2. nodes are keyed by their hashes, committing the same trie again rewrites the same nodes;
+//  3. the root is only referenced after Trie.Commit returns, so the partial nodes are unreachable
+//     from any committed state, and Prune sweeps them as garbage.
+const maxBatchNodes = 10000
+
 type NodeBase struct {
 	db   kv.KV
 	lock sync.RWMutex
+
+	// hash -> decoded node, nil if disabled.
+	cache *lru.Cache
+	// nodes stored by the hasher, flushed when Trie.Commit ends or maxBatchNodes are buffered.
+	batch kv.Batch
 }
 
-func NewNodeBase(cfg *config.KVconf) (*NodeBase, error) {
+// NewNodeBase creates a NodeBase which caches at most cacheSize decoded nodes,
+// 0 disables the cache.
+func NewNodeBase(cfg *config.KVconf, cacheSize int) (*NodeBase, error) {
 	db, err := kv.NewKV(cfg)
 	if err != nil {
 		return nil, err
 	}
-	return &NodeBase{db: db}, nil
+	var cache *lru.Cache
+	if cacheSize > 0 {
+		cache, err = lru.New(cacheSize)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return &NodeBase{
+		db:    db,
+		cache: cache,
+		batch: db.NewBatch(),
+	}, nil
 }
 
 func (db *NodeBase) node(hash Hash) node {
+	if db.cache != nil {
+		if n, ok := db.cache.Get(hash); ok {
+			return n.(node)
+		}
+	}
 	enc, err := db.db.Get(hash.Bytes())
 	if err != nil || enc == nil {
 		return nil
 	}
 	// fmt.Println("node", hex.EncodeToString(hash[:]) , "->", hex.EncodeToString(enc))
-	return mustDecodeNode(hash.Bytes(), enc)
+	n := mustDecodeNode(hash.Bytes(), enc)
+	if db.cache != nil {
+		db.cache.Add(hash, n)
+	}
+	return n
 }
 
 func (db *NodeBase) Get(toGet []byte) ([]byte, error) {
@@ -41,7 +81,24 @@ func (db *NodeBase) Close() error {
 	return nil
 }
 
-func (db *NodeBase) insert(hash Hash, blob []byte) {
+// insert buffers the node into the batch, the caller must hold the lock.
+func (db *NodeBase) insert(hash Hash, blob []byte) error {
 	// fmt.Println("inserting", hash, blob)
-	db.Put(hash.Bytes(), blob)
+	// blob is the buffer of hasher, which is reused.
+	db.batch.Set(hash.Bytes(), CopyBytes(blob))
+	if db.batch.Len() < maxBatchNodes {
+		return nil
+	}
+	err := db.batch.Write()
+	db.batch.Reset()
+	return err
+}
+
+// flush writes all the buffered nodes atomically.
+func (db *NodeBase) flush() error {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+	err := db.batch.Write()
+	db.batch.Reset()
+	return err
 }
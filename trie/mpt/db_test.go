@@ -3,6 +3,7 @@ package mpt
 import (
 	"bytes"
 	"github.com/Lawliet-Chan/yu/config"
+	"os"
 	"testing"
 )
 
@@ -11,7 +12,8 @@ func TestDataBaseSetPutandGet(t *testing.T) {
 		KvType: "badger",
 		Path:   "./testdb",
 	}
-	db, err := NewNodeBase(cfg)
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, 0)
 	if err != nil {
 		t.Error(err)
 		return
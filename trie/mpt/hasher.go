@@ -183,8 +183,11 @@ func (h *hasher) store(n node, db *NodeBase, force bool) (node, error) {
 		hash := BytesToHash(hash)
 
 		db.lock.Lock()
-		db.insert(hash, h.tmp)
+		err := db.insert(hash, h.tmp)
 		db.lock.Unlock()
+		if err != nil {
+			return nil, err
+		}
 
 		// Track external references from account->storage trie
 		if h.onleaf != nil {
@@ -0,0 +1,115 @@
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// Iterator walks the key-value pairs under a key prefix of a trie in key order.
+// The trie nodes are resolved from the database on demand.
+type Iterator struct {
+	trie *Trie
+	// hex-encoded prefix without terminator
+	prefix []byte
+	stack  []iterItem
+
+	valid bool
+	key   []byte
+	value []byte
+	err   error
+}
+
+type iterItem struct {
+	n node
+	// hex-encoded path from root to n
+	path []byte
+}
+
+// NewIterator creates an iterator over all the keys beginning with prefix,
+// and moves it to the first key.
+func (t *Trie) NewIterator(prefix []byte) (*Iterator, error) {
+	hexPrefix := keybytesToHex(prefix)
+	it := &Iterator{
+		trie:   t,
+		prefix: hexPrefix[:len(hexPrefix)-1],
+	}
+	if t.root != nil {
+		it.stack = append(it.stack, iterItem{n: t.root})
+	}
+	return it, it.Next()
+}
+
+func (it *Iterator) Valid() bool {
+	return it.valid
+}
+
+// Next moves the iterator to the next key.
+// If a trie node cannot be resolved, the iterator becomes invalid and the error is returned.
+func (it *Iterator) Next() error {
+	it.valid = false
+	for len(it.stack) > 0 {
+		item := it.stack[len(it.stack)-1]
+		it.stack = it.stack[:len(it.stack)-1]
+		if !it.mayHavePrefix(item.path) {
+			continue
+		}
+
+		switch n := item.n.(type) {
+		case *ShortNode:
+			it.stack = append(it.stack, iterItem{n: n.Val, path: concat(item.path, n.Key...)})
+		case *FullNode:
+			// push in reverse order to pop in key order,
+			// the value of this node (index 16) has the shortest key.
+			for i := 15; i >= 0; i-- {
+				if n.Children[i] != nil {
+					it.stack = append(it.stack, iterItem{n: n.Children[i], path: concat(item.path, byte(i))})
+				}
+			}
+			if n.Children[16] != nil {
+				it.stack = append(it.stack, iterItem{n: n.Children[16], path: concat(item.path, 16)})
+			}
+		case HashNode:
+			child, err := it.trie.resolveHash(n, item.path)
+			if err != nil {
+				it.stack = nil
+				it.err = err
+				return err
+			}
+			it.stack = append(it.stack, iterItem{n: child, path: item.path})
+		case ValueNode:
+			if !bytes.HasPrefix(item.path, it.prefix) {
+				continue
+			}
+			it.valid = true
+			it.key = hexToKeybytes(item.path)
+			it.value = n
+			return nil
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", n, n))
+		}
+	}
+	it.key, it.value = nil, nil
+	return nil
+}
+
+// Entry returns the current key and value.
+// The value bytes must not be modified by the caller.
+func (it *Iterator) Entry() ([]byte, []byte, error) {
+	return it.key, it.value, it.err
+}
+
+func (it *Iterator) Close() {
+	it.stack = nil
+	it.valid = false
+}
+
+// mayHavePrefix reports whether the keys under path can begin with the prefix.
+func (it *Iterator) mayHavePrefix(path []byte) bool {
+	if hasTerm(path) {
+		path = path[:len(path)-1]
+	}
+	if len(path) < len(it.prefix) {
+		return bytes.HasPrefix(it.prefix, path)
+	}
+	return bytes.HasPrefix(path, it.prefix)
+}
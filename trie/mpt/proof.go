@@ -0,0 +1,159 @@
+// Copyright 2015 The go-ethereum Authors
+// This file is part of the go-ethereum library.
+//
+// The go-ethereum library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-ethereum library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-ethereum library. If not, see <http://www.gnu.org/licenses/>.
+
+package mpt
+
+import (
+	"bytes"
+	"fmt"
+	"github.com/HyperService-Consortium/go-rlp"
+	. "github.com/Lawliet-Chan/yu/common"
+)
+
+// Prove returns the Merkle proof for key. See TryProve.
+func (t *Trie) Prove(key []byte) [][]byte {
+	proof, err := t.TryProve(key)
+	if err != nil {
+		panic(fmt.Sprintf("Unhandled trie error: %v", err))
+	}
+	return proof
+}
+
+// TryProve constructs a merkle proof for key. The result contains all encoded nodes
+// on the path to the value at key. The value itself is also included in the last
+// node and can be retrieved by verifying the proof.
+//
+// If the trie does not contain a value for key, the returned proof contains all
+// nodes of the longest existing prefix of the key (at least the root node), ending
+// with the node that proves the absence of the key.
+func (t *Trie) TryProve(key []byte) ([][]byte, error) {
+	// Collect all nodes on the path to key.
+	key = keybytesToHex(key)
+	var nodes []node
+	tn := t.root
+	for len(key) > 0 && tn != nil {
+		switch n := tn.(type) {
+		case *ShortNode:
+			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+				// The trie doesn't contain the key.
+				tn = nil
+			} else {
+				tn = n.Val
+				key = key[len(n.Key):]
+			}
+			nodes = append(nodes, n)
+		case *FullNode:
+			tn = n.Children[key[0]]
+			key = key[1:]
+			nodes = append(nodes, n)
+		case HashNode:
+			var err error
+			tn, err = t.resolveHash(n, nil)
+			if err != nil {
+				return nil, err
+			}
+		case ValueNode:
+			tn = nil
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
+		}
+	}
+
+	h := newHasher(nil)
+	defer returnHasherToPool(h)
+
+	proof := make([][]byte, 0, len(nodes))
+	for i, n := range nodes {
+		// Don't bother checking for errors here since hasher panics
+		// if encoding doesn't work and we're not writing to any database.
+		n, _, _ = h.hashChildren(n, nil)
+		hn, _ := h.store(n, nil, false)
+		if _, ok := hn.(HashNode); ok || i == 0 {
+			// If the node's database encoding is a hash (or is the
+			// root node), it becomes a proof element.
+			enc, err := rlp.EncodeToBytes(n)
+			if err != nil {
+				return nil, err
+			}
+			proof = append(proof, enc)
+		}
+	}
+	return proof, nil
+}
+
+// VerifyProof checks merkle proofs. The given proof must contain the value for
+// key in a trie with the given root hash. VerifyProof returns an error if the
+// proof contains invalid trie nodes or the wrong value.
+// If the trie does not contain key, VerifyProof returns a nil value and no error.
+func VerifyProof(rootHash Hash, key []byte, proof [][]byte) ([]byte, error) {
+	if rootHash == NullHash || rootHash == EmptyRoot {
+		return nil, nil
+	}
+	proofNodes := make(map[Hash][]byte, len(proof))
+	for _, enc := range proof {
+		proofNodes[Keccak256Hash(enc)] = enc
+	}
+
+	key = keybytesToHex(key)
+	wantHash := rootHash
+	for i := 0; ; i++ {
+		buf, ok := proofNodes[wantHash]
+		if !ok {
+			return nil, fmt.Errorf("proof node %d (hash %064x) missing", i, wantHash)
+		}
+		n, err := DecodeNode(wantHash.Bytes(), buf)
+		if err != nil {
+			return nil, fmt.Errorf("bad proof node %d: %v", i, err)
+		}
+		keyrest, cld := getFromProofNode(n, key)
+		switch cld := cld.(type) {
+		case nil:
+			// The trie doesn't contain the key.
+			return nil, nil
+		case HashNode:
+			key = keyrest
+			wantHash = BytesToHash(cld)
+		case ValueNode:
+			return cld, nil
+		}
+	}
+}
+
+// getFromProofNode walks the embedded nodes of tn along key and returns the
+// remaining key together with the first hash or value node it reaches.
+func getFromProofNode(tn node, key []byte) ([]byte, node) {
+	for {
+		switch n := tn.(type) {
+		case *ShortNode:
+			if len(key) < len(n.Key) || !bytes.Equal(n.Key, key[:len(n.Key)]) {
+				return nil, nil
+			}
+			tn = n.Val
+			key = key[len(n.Key):]
+		case *FullNode:
+			tn = n.Children[key[0]]
+			key = key[1:]
+		case HashNode:
+			return key, n
+		case nil:
+			return key, nil
+		case ValueNode:
+			return nil, n
+		default:
+			panic(fmt.Sprintf("%T: invalid node: %v", tn, tn))
+		}
+	}
+}
@@ -6,8 +6,9 @@ import (
 	"encoding/json"
 	"fmt"
 	. "github.com/Lawliet-Chan/yu/common"
-	"github.com/Lawliet-Chan/yu/storage/kv"
+	"github.com/Lawliet-Chan/yu/config"
 	"io"
+	"os"
 	"testing"
 	"unicode/utf8"
 )
@@ -130,11 +131,12 @@ CheckKeyValueOK:
 }
 
 func TestGenerateProof(t *testing.T) {
-	cfg := &kv.KVconf{
-		KVtype: "badger",
-		Path:   "./testdb",
+	cfg := &config.KVconf{
+		KvType: "badger",
+		Path:   "./proof_testdb",
 	}
-	db, err := NewNodeBase(cfg)
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, 0)
 	if err != nil {
 		t.Error(err)
 		return
@@ -168,11 +170,12 @@ func TestGenerateProof(t *testing.T) {
 }
 
 func TestGenerateLongProof(t *testing.T) {
-	cfg := &kv.KVconf{
-		KVtype: "badger",
-		Path:   "./testdb",
+	cfg := &config.KVconf{
+		KvType: "badger",
+		Path:   "./long_proof_testdb",
 	}
-	db, err := NewNodeBase(cfg)
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, 0)
 	if err != nil {
 		t.Error(err)
 		return
@@ -209,3 +212,65 @@ func TestGenerateLongProof(t *testing.T) {
 		fmt.Println(hex.EncodeToString(bt))
 	}
 }
+
+func TestVerifyProof(t *testing.T) {
+	cfg := &config.KVconf{
+		KvType: "badger",
+		Path:   "./verify_proof_testdb",
+	}
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTrie(EmptyRoot, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	kvs := map[string]string{
+		"key":     "value-key",
+		"keyy":    "value-keyy",
+		"keyyyy":  "value-keyyyy",
+		"another": "value-another",
+	}
+	for k, v := range kvs {
+		tr.Update([]byte(k), []byte(v))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err = NewTrie(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for k, v := range kvs {
+		proof, err := tr.TryProve([]byte(k))
+		if err != nil {
+			t.Fatalf("prove key(%s) error: %s", k, err.Error())
+		}
+		value, err := VerifyProof(root, []byte(k), proof)
+		if err != nil {
+			t.Fatalf("verify proof of key(%s) error: %s", k, err.Error())
+		}
+		if !bytes.Equal(value, []byte(v)) {
+			t.Fatalf("verified value of key(%s) is %s, want %s", k, value, v)
+		}
+	}
+
+	proof, err := tr.TryProve([]byte("kez"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := VerifyProof(root, []byte("kez"), proof)
+	if err != nil || value != nil {
+		t.Fatalf("absent key should be proved absent, got value(%x) error(%v)", value, err)
+	}
+
+	proof, _ = tr.TryProve([]byte("key"))
+	if _, err = VerifyProof(HexToHash("0x01"), []byte("key"), proof); err == nil {
+		t.Fatal("proof should not verify against a wrong root")
+	}
+}
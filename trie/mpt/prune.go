@@ -0,0 +1,101 @@
+package mpt
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+)
+
+// Prune deletes all the trie nodes which cannot be reached from keepRoots (mark-and-sweep).
+// It returns the number of deleted nodes.
+func (db *NodeBase) Prune(keepRoots []Hash) (int, error) {
+	db.lock.Lock()
+	defer db.lock.Unlock()
+
+	marked := make(map[Hash]struct{})
+	for _, root := range keepRoots {
+		if root == NullHash || root == EmptyRoot {
+			continue
+		}
+		err := db.mark(root, marked)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	garbage, err := db.unmarked(marked)
+	if err != nil {
+		return 0, err
+	}
+	batch := db.db.NewBatch()
+	for _, hash := range garbage {
+		err = batch.Delete(hash.Bytes())
+		if err != nil {
+			return 0, err
+		}
+		if db.cache != nil {
+			db.cache.Remove(hash)
+		}
+	}
+	return len(garbage), batch.Write()
+}
+
+func (db *NodeBase) mark(hash Hash, marked map[Hash]struct{}) error {
+	if _, ok := marked[hash]; ok {
+		return nil
+	}
+	n := db.node(hash)
+	if n == nil {
+		return &MissingNodeError{NodeHash: hash}
+	}
+	marked[hash] = struct{}{}
+	return forEachHashChild(n, func(child HashNode) error {
+		return db.mark(BytesToHash(child), marked)
+	})
+}
+
+// unmarked returns the hashes of all stored nodes which are not marked.
+func (db *NodeBase) unmarked(marked map[Hash]struct{}) ([]Hash, error) {
+	iter, err := db.db.Iter(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer iter.Close()
+
+	var hashes []Hash
+	for iter.Valid() {
+		key, _, err := iter.Entry()
+		if err != nil {
+			return nil, err
+		}
+		// only trie nodes are keyed by hash.
+		if len(key) == HashLen {
+			hash := BytesToHash(key)
+			if _, ok := marked[hash]; !ok {
+				hashes = append(hashes, hash)
+			}
+		}
+		err = iter.Next()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hashes, nil
+}
+
+// forEachHashChild calls fn on every HashNode referenced by n,
+// including the ones referenced by its embedded children.
+func forEachHashChild(n node, fn func(HashNode) error) error {
+	switch n := n.(type) {
+	case *ShortNode:
+		return forEachHashChild(n.Val, fn)
+	case *FullNode:
+		for i := 0; i < 16; i++ {
+			err := forEachHashChild(n.Children[i], fn)
+			if err != nil {
+				return err
+			}
+		}
+	case HashNode:
+		return fn(n)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package mpt
+
+import (
+	"errors"
+	"fmt"
+	. "github.com/Lawliet-Chan/yu/common"
+)
+
+// ErrNotRequested is returned by Sync.Process if the node is not requested.
+var ErrNotRequested = errors.New("trie node not requested")
+
+// syncRequest is a trie node to be fetched, or fetched and waiting for its children.
+type syncRequest struct {
+	hash Hash
+	blob []byte
+	// the requests which wait for this one.
+	parents []*syncRequest
+	// the number of children not committed yet.
+	deps int
+}
+
+// Sync downloads the trie of a root from remote.
+// A node is written into NodeBase only after all its children are written,
+// so a node existing in NodeBase always means a complete subtrie,
+// even if the sync is interrupted.
+type Sync struct {
+	db *NodeBase
+	// all the requests not committed.
+	requests map[Hash]*syncRequest
+	// hashes of the nodes to fetch.
+	queue []Hash
+	// the number of committed nodes.
+	synced int
+}
+
+// NewSync starts to sync the trie of root into db.
+func NewSync(root Hash, db *NodeBase) *Sync {
+	s := &Sync{
+		db:       db,
+		requests: make(map[Hash]*syncRequest),
+	}
+	if root != NullHash && root != EmptyRoot && !s.exist(root) {
+		s.schedule(root, nil)
+	}
+	return s
+}
+
+// Missing pops at most max hashes of the nodes to fetch, 0 means no limit.
+// The nodes which fail to be fetched should be given back by Retry.
+func (s *Sync) Missing(max int) []Hash {
+	n := len(s.queue)
+	if max > 0 && max < n {
+		n = max
+	}
+	hashes := s.queue[:n:n]
+	s.queue = s.queue[n:]
+	return hashes
+}
+
+// Retry puts the hashes back to fetch them again.
+func (s *Sync) Retry(hashes []Hash) {
+	s.queue = append(s.queue, hashes...)
+}
+
+// Process checks the fetched node against its hash, and schedules its children.
+func (s *Sync) Process(hash Hash, blob []byte) error {
+	req, ok := s.requests[hash]
+	if !ok || req.blob != nil {
+		return ErrNotRequested
+	}
+	if Keccak256Hash(blob) != hash {
+		return fmt.Errorf("trie node %x mismatches its hash", hash)
+	}
+	n, err := DecodeNode(hash.Bytes(), blob)
+	if err != nil {
+		return err
+	}
+	req.blob = blob
+
+	err = forEachHashChild(n, func(child HashNode) error {
+		childHash := BytesToHash(child)
+		if childReq, ok := s.requests[childHash]; ok {
+			childReq.parents = append(childReq.parents, req)
+			req.deps++
+			return nil
+		}
+		if s.exist(childHash) {
+			return nil
+		}
+		s.schedule(childHash, req)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if req.deps == 0 {
+		return s.commit(req)
+	}
+	return nil
+}
+
+// Pending returns the number of nodes not written into NodeBase.
+func (s *Sync) Pending() int {
+	return len(s.requests)
+}
+
+// Synced returns the number of nodes written into NodeBase.
+func (s *Sync) Synced() int {
+	return s.synced
+}
+
+func (s *Sync) schedule(hash Hash, parent *syncRequest) {
+	req := &syncRequest{hash: hash}
+	if parent != nil {
+		req.parents = append(req.parents, parent)
+		parent.deps++
+	}
+	s.requests[hash] = req
+	s.queue = append(s.queue, hash)
+}
+
+// commit writes the node whose children are all written, and then its parents if possible.
+func (s *Sync) commit(req *syncRequest) error {
+	err := s.db.Put(req.hash.Bytes(), req.blob)
+	if err != nil {
+		return err
+	}
+	delete(s.requests, req.hash)
+	s.synced++
+	for _, parent := range req.parents {
+		parent.deps--
+		if parent.deps == 0 {
+			err = s.commit(parent)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Sync) exist(hash Hash) bool {
+	blob, _ := s.db.Get(hash.Bytes())
+	return blob != nil
+}
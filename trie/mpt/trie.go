@@ -138,76 +138,6 @@ func (t *Trie) tryGet(origNode node, key []byte, pos int) (value []byte, newnode
 	}
 }
 
-func (t *Trie) Prove(key []byte) [][]byte {
-	res, err := t.TryProve(key)
-	if err != nil {
-		panic(fmt.Sprintf("Unhandled trie error: %v", err))
-	}
-	return res
-}
-
-// TryGet returns the value for key stored in the trie.
-// The value bytes must not be modified by the caller.
-// If a node was not found in the database, a MissingNodeError is returned.
-func (t *Trie) TryProve(key []byte) ([][]byte, error) {
-	key = keybytesToHex(key)
-	trieHash, err := t.Commit(nil)
-	var pureTrie *Trie
-	pureTrie, err = NewTrie(trieHash, t.db)
-	if err != nil {
-		return nil, err
-	}
-	var pbt []byte
-	pbt, err = t.db.Get(trieHash.Bytes())
-	if err != nil {
-		return nil, err
-	}
-	var tailProof [][]byte
-	tailProof, _, _, err = pureTrie.tryProve(pureTrie.root, key, 0)
-	return append([][]byte{trieHash.Bytes(), pbt}, tailProof...), err
-}
-
-func (t *Trie) tryProve(origNode node, key []byte, pos int) (proof [][]byte, newnode node, didResolve bool, err error) {
-	switch n := (origNode).(type) {
-	case nil:
-		return nil, nil, false, nil
-	case ValueNode:
-		return [][]byte{}, n, false, nil
-	case *ShortNode:
-		if len(key)-pos < len(n.Key) || !bytes.Equal(n.Key, key[pos:pos+len(n.Key)]) {
-			// key not found in trie
-			return [][]byte{}, n, false, nil
-		}
-		proof, newnode, didResolve, err = t.tryProve(n.Val, key, pos+len(n.Key))
-		if err == nil && didResolve {
-			n = n.copy()
-			n.Val = newnode
-		}
-		return proof, n, didResolve, err
-	case *FullNode:
-		proof, newnode, didResolve, err = t.tryProve(n.Children[key[pos]], key, pos+1)
-		if err == nil && didResolve {
-			n = n.copy()
-			n.Children[key[pos]] = newnode
-		}
-		return proof, n, didResolve, err
-	case HashNode:
-		child, err := t.resolveHash(n, key[:pos])
-		if err != nil {
-			return nil, n, true, err
-		}
-		var pbt []byte
-		pbt, err = t.db.Get([]byte(n))
-		if err != nil {
-			return nil, n, true, err
-		}
-		tailProof, newnode, _, err := t.tryProve(child, key, pos)
-		return append([][]byte{pbt}, tailProof...), newnode, true, err
-	default:
-		panic(fmt.Sprintf("%T: invalid node: %v", origNode, origNode))
-	}
-}
-
 // Update associates key with value in the trie. Subsequent calls to
 // Get will return value. If value has length zero, any existing value
 // is deleted from the trie and calls to Get will return nil.
@@ -486,6 +416,10 @@ func (t *Trie) Commit(onleaf LeafCallback) (root Hash, err error) {
 	if err != nil {
 		return Hash{}, err
 	}
+	err = t.db.flush()
+	if err != nil {
+		return Hash{}, err
+	}
 	t.root = cached
 	return BytesToHash(hash.(HashNode)), nil
 }
@@ -2,17 +2,21 @@ package mpt
 
 import (
 	"bytes"
+	"fmt"
 	. "github.com/Lawliet-Chan/yu/common"
-	"github.com/Lawliet-Chan/yu/storage/kv"
+	"github.com/Lawliet-Chan/yu/config"
+	"os"
+	"strings"
 	"testing"
 )
 
 func TestTrieSetPutandGet(t *testing.T) {
-	cfg := &kv.KVconf{
-		KVtype: "badger",
-		Path:   "./testdb",
+	cfg := &config.KVconf{
+		KvType: "badger",
+		Path:   "./trie_testdb",
 	}
-	db, err := NewNodeBase(cfg)
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, 0)
 	if err != nil {
 		t.Error(err)
 		return
@@ -55,3 +59,388 @@ func TestTrieSetPutandGet(t *testing.T) {
 		return
 	}
 }
+
+func TestTrieIterator(t *testing.T) {
+	cfg := &config.KVconf{
+		KvType: "badger",
+		Path:   "./iter_testdb",
+	}
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTrie(EmptyRoot, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keys := []string{"a", "ab", "abc", "abd", "b", "ba", "doge", "dog", "do", "horse"}
+	for _, k := range keys {
+		tr.Update([]byte(k), []byte("value-"+k))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err = NewTrie(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for prefix, want := range map[string][]string{
+		"":   {"a", "ab", "abc", "abd", "b", "ba", "do", "dog", "doge", "horse"},
+		"ab": {"ab", "abc", "abd"},
+		"do": {"do", "dog", "doge"},
+		"x":  nil,
+	} {
+		iter, err := tr.NewIterator([]byte(prefix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for iter.Valid() {
+			key, value, err := iter.Entry()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != "value-"+string(key) {
+				t.Fatalf("value of key(%s) is %s", key, value)
+			}
+			got = append(got, string(key))
+			err = iter.Next()
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		iter.Close()
+		if strings.Join(got, ",") != strings.Join(want, ",") {
+			t.Fatalf("iterate prefix(%s) got %v, want %v", prefix, got, want)
+		}
+	}
+}
+
+func TestTrieWithNodeCache(t *testing.T) {
+	cfg := &config.KVconf{
+		KvType: "bolt",
+		Path:   "./cache_testdb",
+	}
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	tr, err := NewTrie(EmptyRoot, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// read twice, from the KV and from the cache.
+	for round := 0; round < 2; round++ {
+		tr, err = NewTrie(root, db)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			value, err := tr.TryGet([]byte(fmt.Sprintf("key-%d", i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(value) != fmt.Sprintf("value-%d", i) {
+				t.Fatalf("value of key-%d is %s", i, value)
+			}
+		}
+	}
+
+	// pruned nodes are evicted from the cache.
+	_, err = db.Prune(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewTrie(root, db)
+	if _, ok := err.(*MissingNodeError); !ok {
+		t.Fatalf("open pruned trie, error: %v", err)
+	}
+}
+
+func BenchmarkTrieCommit(b *testing.B) {
+	benchmarkTrie(b, 0, func(b *testing.B, db *NodeBase, _ Hash) {
+		for i := 0; i < b.N; i++ {
+			tr, err := NewTrie(EmptyRoot, db)
+			if err != nil {
+				b.Fatal(err)
+			}
+			for j := 0; j < 100; j++ {
+				tr.Update([]byte(fmt.Sprintf("key-%d-%d", i, j)), []byte("value"))
+			}
+			_, err = tr.Commit(nil)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func BenchmarkTrieGetNoCache(b *testing.B) {
+	benchmarkTrie(b, 0, benchmarkGet)
+}
+
+func BenchmarkTrieGetWithCache(b *testing.B) {
+	benchmarkTrie(b, 10000, benchmarkGet)
+}
+
+func benchmarkGet(b *testing.B, db *NodeBase, root Hash) {
+	for i := 0; i < b.N; i++ {
+		tr, err := NewTrie(root, db)
+		if err != nil {
+			b.Fatal(err)
+		}
+		_, err = tr.TryGet([]byte(fmt.Sprintf("key-%d", i%1000)))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// benchmarkTrie runs fn over a NodeBase which holds a trie of 1000 keys.
+func benchmarkTrie(b *testing.B, cacheSize int, fn func(*testing.B, *NodeBase, Hash)) {
+	cfg := &config.KVconf{
+		KvType: "bolt",
+		Path:   "./bench_testdb",
+	}
+	defer os.RemoveAll(cfg.Path)
+	db, err := NewNodeBase(cfg, cacheSize)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer db.Close()
+
+	tr, err := NewTrie(EmptyRoot, db)
+	if err != nil {
+		b.Fatal(err)
+	}
+	for i := 0; i < 1000; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.ResetTimer()
+	fn(b, db, root)
+}
+
+func TestTrieSync(t *testing.T) {
+	srcDB, err := NewNodeBase(&config.KVconf{KvType: "memory"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dstDB, err := NewNodeBase(&config.KVconf{KvType: "memory"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tr, err := NewTrie(EmptyRoot, srcDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), []byte(fmt.Sprintf("value-%d", i)))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sync := NewSync(root, dstDB)
+	for sync.Pending() > 0 {
+		hashes := sync.Missing(10)
+		if len(hashes) == 0 {
+			t.Fatalf("%d nodes pending but none missing", sync.Pending())
+		}
+		for _, hash := range hashes {
+			blob, err := srcDB.Get(hash.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			// a forged node is rejected.
+			if sync.Process(hash, append(CopyBytes(blob), 0)) == nil {
+				t.Fatal("process forged node without error")
+			}
+			err = sync.Process(hash, blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	tr, err = NewTrie(root, dstDB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 500; i++ {
+		value, err := tr.TryGet([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(value) != fmt.Sprintf("value-%d", i) {
+			t.Fatalf("value of key-%d is %s", i, value)
+		}
+	}
+
+	// nothing to sync for an existing trie.
+	if NewSync(root, dstDB).Pending() != 0 {
+		t.Fatal("sync an existing trie")
+	}
+}
+
+func TestCommitInSeveralBatches(t *testing.T) {
+	db, err := NewNodeBase(&config.KVconf{KvType: "memory"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTrie(EmptyRoot, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// more nodes than one batch holds.
+	count := maxBatchNodes * 2
+	for i := 0; i < count; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), Keccak256([]byte(fmt.Sprintf("value-%d", i))))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if db.batch.Len() != 0 {
+		t.Fatalf("%d nodes left in batch", db.batch.Len())
+	}
+
+	tr, err = NewTrie(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i += 1000 {
+		value, err := tr.TryGet([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(value, Keccak256([]byte(fmt.Sprintf("value-%d", i)))) {
+			t.Fatalf("value of key-%d is %x", i, value)
+		}
+	}
+}
+
+// TestRecoverFromPartialCommit crashes a commit after some batches are written,
+// the partial trie is synced, committed again or pruned as garbage.
+func TestRecoverFromPartialCommit(t *testing.T) {
+	count := maxBatchNodes * 2
+	srcDB, err := NewNodeBase(&config.KVconf{KvType: "memory"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := commitTestTrie(t, srcDB, count)
+
+	// commit again after the crash.
+	db := partialCommit(t, count, root)
+	if recommitted := commitTestTrie(t, db, count); recommitted != root {
+		t.Fatalf("root of recommitted trie is %s, want %s", recommitted.String(), root.String())
+	}
+	assertTestTrie(t, db, root, count)
+
+	// sync the missing nodes after the crash.
+	db = partialCommit(t, count, root)
+	sync := NewSync(root, db)
+	for sync.Pending() > 0 {
+		hashes := sync.Missing(1000)
+		if len(hashes) == 0 {
+			t.Fatalf("%d nodes pending but none missing", sync.Pending())
+		}
+		for _, hash := range hashes {
+			blob, err := srcDB.Get(hash.Bytes())
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = sync.Process(hash, blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	assertTestTrie(t, db, root, count)
+
+	// the partial nodes are garbage.
+	db = partialCommit(t, count, root)
+	swept, err := db.Prune(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if swept < maxBatchNodes {
+		t.Fatalf("swept %d partial nodes, want at least %d", swept, maxBatchNodes)
+	}
+}
+
+func commitTestTrie(t *testing.T, db *NodeBase, count int) Hash {
+	tr, err := NewTrie(EmptyRoot, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), Keccak256([]byte(fmt.Sprintf("value-%d", i))))
+	}
+	root, err := tr.Commit(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return root
+}
+
+// partialCommit commits the test trie but loses the last batch, as the node crashes before flushing it.
+func partialCommit(t *testing.T, count int, root Hash) *NodeBase {
+	db, err := NewNodeBase(&config.KVconf{KvType: "memory"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTrie(EmptyRoot, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		tr.Update([]byte(fmt.Sprintf("key-%d", i)), Keccak256([]byte(fmt.Sprintf("value-%d", i))))
+	}
+	_, _, err = tr.hashRoot(db, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	db.batch.Reset()
+	if db.node(root) != nil {
+		t.Fatal("root is written by a partial commit")
+	}
+	return db
+}
+
+func assertTestTrie(t *testing.T, db *NodeBase, root Hash, count int) {
+	tr, err := NewTrie(root, db)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < count; i++ {
+		value, err := tr.TryGet([]byte(fmt.Sprintf("key-%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(value, Keccak256([]byte(fmt.Sprintf("value-%d", i)))) {
+			t.Fatalf("value of key-%d is %x", i, value)
+		}
+	}
+}
@@ -14,11 +14,8 @@ type SignedTxn struct {
 	Signature []byte
 }
 
-func NewSignedTxn(caller Address, ecall *Ecall, pubkey PubKey, sig []byte) (*SignedTxn, error) {
-	raw, err := NewUnsignedTxn(caller, ecall)
-	if err != nil {
-		return nil, err
-	}
+// NewSignedTxn wraps the raw txn with the signature over raw.SignBytes.
+func NewSignedTxn(raw *UnsignedTxn, pubkey PubKey, sig []byte) (*SignedTxn, error) {
 	hash, err := raw.Hash()
 	if err != nil {
 		return nil, err
@@ -29,11 +29,19 @@ func TestSignedTxns_Remove(t *testing.T) {
 			ExecName:   istr,
 			Params:     JsonString(istr),
 		}
-		sig, err := privKey.SignData(ecall.Bytes())
+		raw, err := NewUnsignedTxn(pubkey.Address(), ecall, uint64(i), 0, 0, uint64(i))
+		if err != nil {
+			t.Fatalf("new UnsignedTxn error: %s", err.Error())
+		}
+		data, err := raw.SignBytes(0)
+		if err != nil {
+			t.Fatalf("get sign bytes error: %s", err.Error())
+		}
+		sig, err := privKey.SignData(data)
 		if err != nil {
 			t.Fatalf("sign data error: %s", err.Error())
 		}
-		stxn, err := NewSignedTxn(pubkey.Address(), ecall, pubkey, sig)
+		stxn, err := NewSignedTxn(raw, pubkey, sig)
 		if err != nil {
 			t.Fatalf("new SignedTxn error: %s", err.Error())
 		}
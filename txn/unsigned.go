@@ -2,23 +2,33 @@ package txn
 
 import (
 	"crypto/sha256"
+	"encoding/binary"
 	. "github.com/Lawliet-Chan/yu/common"
 	. "github.com/Lawliet-Chan/yu/utils/codec"
-	ytime "github.com/Lawliet-Chan/yu/utils/time"
 )
 
 type UnsignedTxn struct {
-	Id        Hash
-	Caller    Address
-	Ecall     *Ecall
-	Timestamp uint64
+	Id     Hash
+	Caller Address
+	Ecall  *Ecall
+	// Nonce must equal the number of txns the caller has executed,
+	// so a txn can not be executed twice.
+	Nonce uint64
+	// Tip is optional, the txns with higher tips are packed first by the priority txpool.
+	Tip uint64
+	// ValidUntil is the last height the txn can be executed on, 0 means no limit.
+	ValidUntil BlockNum
+	Timestamp  uint64
 }
 
-func NewUnsignedTxn(caller Address, ecall *Ecall) (*UnsignedTxn, error) {
+func NewUnsignedTxn(caller Address, ecall *Ecall, nonce, tip uint64, validUntil BlockNum, timestamp uint64) (*UnsignedTxn, error) {
 	utxn := &UnsignedTxn{
-		Caller:    caller,
-		Ecall:     ecall,
-		Timestamp: ytime.NowNanoTsU64(),
+		Caller:     caller,
+		Ecall:      ecall,
+		Nonce:      nonce,
+		Tip:        tip,
+		ValidUntil: validUntil,
+		Timestamp:  timestamp,
 	}
 	id, err := utxn.Hash()
 	if err != nil {
@@ -40,6 +50,23 @@ func (ut *UnsignedTxn) GetEcall() *Ecall {
 	return ut.Ecall
 }
 
+func (ut *UnsignedTxn) GetNonce() uint64 {
+	return ut.Nonce
+}
+
+func (ut *UnsignedTxn) GetTip() uint64 {
+	return ut.Tip
+}
+
+func (ut *UnsignedTxn) GetValidUntil() BlockNum {
+	return ut.ValidUntil
+}
+
+// ExpiredAt reports whether the txn can not be executed on the height.
+func (ut *UnsignedTxn) ExpiredAt(height BlockNum) bool {
+	return ut.ValidUntil != 0 && height > ut.ValidUntil
+}
+
 func (ut *UnsignedTxn) GetTimestamp() uint64 {
 	return ut.Timestamp
 }
@@ -54,6 +81,20 @@ func (ut *UnsignedTxn) Hash() (Hash, error) {
 	return hash, nil
 }
 
+// SignBytes returns the bytes that the caller signs: the chain id followed by the
+// encoding of the txn without its Id, so the signature is not valid on other chains.
+func (ut *UnsignedTxn) SignBytes(chainID uint64) ([]byte, error) {
+	raw := *ut
+	raw.Id = NullHash
+	byt, err := raw.Encode()
+	if err != nil {
+		return nil, err
+	}
+	data := make([]byte, 8, 8+len(byt))
+	binary.BigEndian.PutUint64(data, chainID)
+	return append(data, byt...), nil
+}
+
 func (ut *UnsignedTxn) Encode() ([]byte, error) {
 	return GlobalCodec.EncodeToBytes(ut)
 }
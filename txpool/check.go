@@ -1,6 +1,7 @@
 package txpool
 
 import (
+	. "github.com/Lawliet-Chan/yu/common"
 	. "github.com/Lawliet-Chan/yu/txn"
 	. "github.com/Lawliet-Chan/yu/yerror"
 )
@@ -30,10 +31,70 @@ func checkPoolLimit(txnsInPool []*SignedTxn, poolsize uint64) error {
 	return nil
 }
 
-func checkSignature(stxn *SignedTxn) error {
-	sig := stxn.GetSignature()
-	ecall := stxn.GetRaw().GetEcall()
-	if !stxn.GetPubkey().VerifySignature(ecall.Bytes(), sig) {
+// checkNonce rejects the txn whose nonce has been used by its account.
+func checkNonce(getter NonceGetter, stxn *SignedTxn) error {
+	if getter == nil {
+		return nil
+	}
+	addr := stxn.GetPubkey().Address()
+	nonce := stxn.GetRaw().GetNonce()
+	want, err := getter(addr)
+	if err != nil {
+		return err
+	}
+	if nonce < want {
+		return NonceIllegal(addr, nonce, want)
+	}
+	return nil
+}
+
+func checkNonceDuplicated(txnsInPool []*SignedTxn, stxn *SignedTxn) error {
+	addr := stxn.GetPubkey().Address()
+	nonce := stxn.GetRaw().GetNonce()
+	for _, pooled := range txnsInPool {
+		if pooled.GetRaw().GetNonce() == nonce && pooled.GetPubkey().Address() == addr {
+			return NonceDuplicated
+		}
+	}
+	return nil
+}
+
+func checkExpired(getter HeightGetter, stxn *SignedTxn) error {
+	height, err := nextHeight(getter)
+	if err != nil {
+		return err
+	}
+	return expiredErr(stxn, height)
+}
+
+// expiredErr returns ErrTxnExpired if the txn can not be executed on the height.
+func expiredErr(stxn *SignedTxn, height BlockNum) error {
+	raw := stxn.GetRaw()
+	if raw.ExpiredAt(height) {
+		return TxnExpired(stxn.GetTxnHash(), raw.GetValidUntil(), height)
+	}
+	return nil
+}
+
+// nextHeight returns the height of the next block, and 0 if there is no HeightGetter,
+// on which no txn is expired.
+func nextHeight(getter HeightGetter) (BlockNum, error) {
+	if getter == nil {
+		return 0, nil
+	}
+	return getter()
+}
+
+func checkSignature(chainID uint64, stxn *SignedTxn) error {
+	// the key owner can not sign txns in the name of other accounts.
+	if stxn.GetRaw().GetCaller() != stxn.GetPubkey().Address() {
+		return CallerIllegal
+	}
+	data, err := stxn.GetRaw().SignBytes(chainID)
+	if err != nil {
+		return err
+	}
+	if !stxn.GetPubkey().VerifySignature(data, stxn.GetSignature()) {
 		return TxnSignatureErr
 	}
 	return nil
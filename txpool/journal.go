@@ -0,0 +1,127 @@
+package txpool
+
+import (
+	"encoding/binary"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	"github.com/Lawliet-Chan/yu/storage/kv"
+	. "github.com/Lawliet-Chan/yu/txn"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"github.com/sirupsen/logrus"
+	"sort"
+)
+
+// Journal keeps the txns of txpool in kv until they are removed,
+// so they are reloaded after a restart.
+// pending-{txnHash} => uint64(seq) | encoded txn
+type Journal struct {
+	db kv.KV
+	// increases on every insert, keeps the order of txns
+	seq uint64
+}
+
+var journalPrefix = []byte("pending-")
+
+func NewJournal(cfg *config.KVconf) (*Journal, error) {
+	db, err := kv.NewKV(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &Journal{db: db}, nil
+}
+
+func (j *Journal) Insert(stxn *SignedTxn) error {
+	byt, err := FromArray(stxn).Encode()
+	if err != nil {
+		return err
+	}
+	j.seq++
+	value := make([]byte, 8, 8+len(byt))
+	binary.BigEndian.PutUint64(value, j.seq)
+	err = j.db.Set(journalKey(stxn.GetTxnHash()), append(value, byt...))
+	if err != nil {
+		return StorageIO("journal txn", err)
+	}
+	return nil
+}
+
+func (j *Journal) Remove(hash Hash) error {
+	err := j.db.Delete(journalKey(hash))
+	if err != nil {
+		return StorageIO("remove txn from journal", err)
+	}
+	return nil
+}
+
+// Load returns all the txns in journal in the order of insertion.
+func (j *Journal) Load() (SignedTxns, error) {
+	iter, err := j.db.Iter(journalPrefix)
+	if err != nil {
+		return nil, StorageIO("load journal", err)
+	}
+	defer iter.Close()
+
+	seqs := make(map[Hash]uint64)
+	stxns := make(SignedTxns, 0)
+	for iter.Valid() {
+		_, value, err := iter.Entry()
+		if err != nil {
+			return nil, StorageIO("load journal", err)
+		}
+		if len(value) < 8 {
+			return nil, StorageIO("load journal", TypeErr)
+		}
+		decoded, err := DecodeSignedTxns(value[8:])
+		if err != nil {
+			return nil, StorageIO("decode journal txn", err)
+		}
+		seq := binary.BigEndian.Uint64(value[:8])
+		if seq > j.seq {
+			j.seq = seq
+		}
+		seqs[decoded[0].GetTxnHash()] = seq
+		stxns = append(stxns, decoded[0])
+		err = iter.Next()
+		if err != nil {
+			return nil, StorageIO("load journal", err)
+		}
+	}
+	sort.Slice(stxns, func(i, k int) bool {
+		return seqs[stxns[i].GetTxnHash()] < seqs[stxns[k].GetTxnHash()]
+	})
+	return stxns, nil
+}
+
+func journalKey(hash Hash) []byte {
+	return append(CopyBytes(journalPrefix), hash.Bytes()...)
+}
+
+// reloadJournal inserts the txns of journal into tp again, the ones failing
+// NecessaryCheck or the checks of Insert are dropped from journal.
+func reloadJournal(tp ItxPool, journal *Journal) error {
+	if journal == nil {
+		return nil
+	}
+	stxns, err := journal.Load()
+	if err != nil {
+		return err
+	}
+	reloaded := 0
+	for _, stxn := range stxns {
+		err = tp.NecessaryCheck(stxn)
+		if err == nil {
+			err = tp.Insert(stxn)
+		}
+		if err != nil {
+			logrus.Warnf("drop txn(%s) from journal: %s", stxn.GetTxnHash().String(), err.Error())
+			err = journal.Remove(stxn.GetTxnHash())
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		reloaded++
+	}
+	logrus.Infof("reload %d txns from txpool journal", reloaded)
+	return nil
+}
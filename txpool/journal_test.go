@@ -0,0 +1,65 @@
+package txpool
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/txn"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	"testing"
+)
+
+func TestReloadJournal(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	bob := newTestAccount(t)
+	nonces := map[Address]uint64{}
+	newPool := func(journal *Journal) *LocalTxPool {
+		tp := LocalWithDefaultChecks(testTxpoolCfg)
+		tp.WithChainID(testChainID)
+		tp.WithNonceGetter(func(addr Address) (uint64, error) {
+			return nonces[addr], nil
+		})
+		tp.WithJournal(journal)
+		return tp
+	}
+
+	journal, err := NewJournal(&config.KVconf{KvType: "memory"})
+	if err != nil {
+		t.Fatalf("new journal error: %s", err.Error())
+	}
+	tp := newPool(journal)
+	a0, a1, b0 := alice.newTxn(t, 0), alice.newTxn(t, 1), bob.newTxn(t, 0)
+	err = tp.BatchInsert(FromArray(a0, a1, b0))
+	if err != nil {
+		t.Fatalf("insert txns error: %s", err.Error())
+	}
+	_, err = tp.Pack(1)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	err = tp.Flush()
+	if err != nil {
+		t.Fatalf("flush txpool error: %s", err.Error())
+	}
+	// a txn signed for another chain can not pass NecessaryCheck.
+	err = journal.Insert(alice.signTxn(t, testChainID+1, 2, 0))
+	if err != nil {
+		t.Fatalf("journal txn error: %s", err.Error())
+	}
+
+	// a0 and b0 are executed before restart.
+	nonces[alice.pubkey.Address()] = 1
+	nonces[bob.pubkey.Address()] = 1
+	tp = newPool(journal)
+	err = tp.Reload()
+	if err != nil {
+		t.Fatalf("reload journal error: %s", err.Error())
+	}
+	assertTxns(t, tp.Txns, a1)
+
+	stxns, err := journal.Load()
+	if err != nil {
+		t.Fatalf("load journal error: %s", err.Error())
+	}
+	assertTxns(t, stxns, a1)
+}
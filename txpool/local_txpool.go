@@ -21,12 +21,21 @@ type LocalTxPool struct {
 	txnsMap      map[Hash]*SignedTxn
 	Txns         SignedTxns
 	startPackIdx int
+	// when the txns are inserted
+	insertTimes map[Hash]time.Time
 
 	blockTime uint64
-	timeout   time.Duration
+	// the unpacked txns staying longer are removed, 0 means never.
+	timeout time.Duration
 
 	baseChecks   []TxnCheck
 	tripodChecks []TxnCheck
+
+	nonceGetter NonceGetter
+	// txns signed for other chains are rejected
+	chainID      uint64
+	heightGetter HeightGetter
+	journal      *Journal
 }
 
 func NewLocalTxPool(cfg *config.TxpoolConf) *LocalTxPool {
@@ -36,7 +45,8 @@ func NewLocalTxPool(cfg *config.TxpoolConf) *LocalTxPool {
 		txnsMap:      make(map[Hash]*SignedTxn),
 		Txns:         make([]*SignedTxn, 0),
 		startPackIdx: 0,
-		timeout:      time.Duration(cfg.Timeout),
+		insertTimes:  make(map[Hash]time.Time),
+		timeout:      time.Duration(cfg.Timeout) * time.Second,
 		baseChecks:   make([]TxnCheck, 0),
 		tripodChecks: make([]TxnCheck, 0),
 	}
@@ -52,6 +62,8 @@ func (tp *LocalTxPool) withDefaultBaseChecks() *LocalTxPool {
 		tp.checkPoolLimit,
 		tp.checkTxnSize,
 		tp.checkSignature,
+		tp.checkNonce,
+		tp.checkExpired,
 	}
 	return tp
 }
@@ -78,6 +90,30 @@ func (tp *LocalTxPool) WithTripodChecks(checkFns []TxnCheck) ItxPool {
 	return tp
 }
 
+func (tp *LocalTxPool) WithNonceGetter(getter NonceGetter) ItxPool {
+	tp.nonceGetter = getter
+	return tp
+}
+
+func (tp *LocalTxPool) WithChainID(chainID uint64) ItxPool {
+	tp.chainID = chainID
+	return tp
+}
+
+func (tp *LocalTxPool) WithHeightGetter(getter HeightGetter) ItxPool {
+	tp.heightGetter = getter
+	return tp
+}
+
+func (tp *LocalTxPool) WithJournal(journal *Journal) ItxPool {
+	tp.journal = journal
+	return tp
+}
+
+func (tp *LocalTxPool) Reload() error {
+	return reloadJournal(tp, tp.journal)
+}
+
 // insert into txpool
 func (tp *LocalTxPool) Insert(stxn *SignedTxn) error {
 	return tp.BatchInsert(FromArray(stxn))
@@ -88,8 +124,9 @@ func (tp *LocalTxPool) BatchInsert(txns SignedTxns) (err error) {
 	tp.Lock()
 	defer tp.Unlock()
 	for _, stxn := range txns {
+		// the txn already in pool is skipped.
 		if _, ok := tp.txnsMap[stxn.TxnHash]; ok {
-			return
+			continue
 		}
 		err = tp.BaseCheck(stxn)
 		if err != nil {
@@ -100,8 +137,16 @@ func (tp *LocalTxPool) BatchInsert(txns SignedTxns) (err error) {
 			return
 		}
 
+		if tp.journal != nil {
+			err = tp.journal.Insert(stxn)
+			if err != nil {
+				return
+			}
+		}
+
 		tp.Txns = append(tp.Txns, stxn)
 		tp.txnsMap[stxn.TxnHash] = stxn
+		tp.insertTimes[stxn.TxnHash] = time.Now()
 	}
 	return
 }
@@ -113,22 +158,104 @@ func (tp *LocalTxPool) Pack(numLimit uint64) ([]*SignedTxn, error) {
 	})
 }
 
+// PackFor packs the txns of every account in the order of nonces, the ones whose nonces
+// are ahead of their accounts are held back, and the stale or expired ones are dropped.
 func (tp *LocalTxPool) PackFor(numLimit uint64, filter func(*SignedTxn) error) ([]*SignedTxn, error) {
 	tp.Lock()
 	defer tp.Unlock()
+
+	height, err := nextHeight(tp.heightGetter)
+	if err != nil {
+		return nil, err
+	}
+
 	stxns := make([]*SignedTxn, 0)
-	for i := 0; i < int(numLimit); i++ {
-		if i >= len(tp.Txns) {
+	packed := make(map[Hash]bool)
+	pack := func(stxn *SignedTxn) error {
+		logrus.Debugf("pack txn(%s)", stxn.GetTxnHash().String())
+		err := filter(stxn)
+		if err != nil {
+			return err
+		}
+		stxns = append(stxns, stxn)
+		packed[stxn.GetTxnHash()] = true
+		return nil
+	}
+
+	// txn hash -> the reason why it is dropped
+	dropped := make(map[Hash]error)
+	nextNonces := make(map[Address]uint64)
+	held := make(map[Address]map[uint64]*SignedTxn)
+	for _, stxn := range tp.Txns[tp.startPackIdx:] {
+		if uint64(len(stxns)) >= numLimit {
 			break
 		}
-		logrus.Info("********************** pack txn: ", tp.Txns[i].GetTxnHash().String())
-		err := filter(tp.Txns[i])
+		err := expiredErr(stxn, height)
 		if err != nil {
-			return nil, err
+			dropped[stxn.GetTxnHash()] = err
+			continue
+		}
+		if tp.nonceGetter == nil {
+			err := pack(stxn)
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		addr := stxn.GetPubkey().Address()
+		want, ok := nextNonces[addr]
+		if !ok {
+			var err error
+			want, err = tp.nonceGetter(addr)
+			if err != nil {
+				return nil, err
+			}
+			nextNonces[addr] = want
+		}
+		nonce := stxn.GetRaw().GetNonce()
+		if nonce < want {
+			dropped[stxn.GetTxnHash()] = NonceIllegal(addr, nonce, want)
+			continue
+		}
+		if nonce > want {
+			if held[addr] == nil {
+				held[addr] = make(map[uint64]*SignedTxn)
+			}
+			held[addr][nonce] = stxn
+			continue
+		}
+
+		// pack the txn and the held ones following it.
+		for stxn != nil && uint64(len(stxns)) < numLimit {
+			err := pack(stxn)
+			if err != nil {
+				return nil, err
+			}
+			want++
+			stxn = held[addr][want]
+			delete(held[addr], want)
 		}
-		stxns = append(stxns, tp.Txns[i])
-		tp.startPackIdx++
+		nextNonces[addr] = want
 	}
+
+	// move the packed txns to the front of the unpacked ones, so Flush removes them.
+	txns := make(SignedTxns, 0, len(tp.Txns)-len(dropped))
+	txns = append(txns, tp.Txns[:tp.startPackIdx]...)
+	txns = append(txns, stxns...)
+	for _, stxn := range tp.Txns[tp.startPackIdx:] {
+		hash := stxn.GetTxnHash()
+		if err, ok := dropped[hash]; ok {
+			logrus.Warnf("drop txn(%s) from txpool: %s", hash.String(), err.Error())
+			tp.forget(hash)
+			continue
+		}
+		if !packed[hash] {
+			txns = append(txns, stxn)
+		}
+	}
+	tp.Txns = txns
+	tp.startPackIdx += len(stxns)
 	return stxns, nil
 }
 
@@ -146,7 +273,7 @@ func (tp *LocalTxPool) RemoveTxns(hashes []Hash) error {
 		if idx == -1 {
 			continue
 		}
-		delete(tp.txnsMap, hash)
+		tp.forget(hash)
 		if idx < tp.startPackIdx {
 			tp.startPackIdx--
 		}
@@ -159,7 +286,7 @@ func (tp *LocalTxPool) RemoveTxns(hashes []Hash) error {
 func (tp *LocalTxPool) Flush() error {
 	tp.Lock()
 	for _, stxn := range tp.Txns[:tp.startPackIdx] {
-		delete(tp.txnsMap, stxn.GetTxnHash())
+		tp.forget(stxn.GetTxnHash())
 	}
 	tp.Txns = tp.Txns[tp.startPackIdx:]
 	tp.startPackIdx = 0
@@ -167,6 +294,45 @@ func (tp *LocalTxPool) Flush() error {
 	return nil
 }
 
+func (tp *LocalTxPool) RemoveExpired() ([]*EvictedTxn, error) {
+	tp.Lock()
+	defer tp.Unlock()
+
+	height, err := nextHeight(tp.heightGetter)
+	if err != nil {
+		return nil, err
+	}
+	evicted := make([]*EvictedTxn, 0)
+	txns := tp.Txns[:tp.startPackIdx]
+	for _, stxn := range tp.Txns[tp.startPackIdx:] {
+		hash := stxn.GetTxnHash()
+		err = expiredErr(stxn, height)
+		if err == nil && tp.timeout > 0 && time.Since(tp.insertTimes[hash]) > tp.timeout {
+			err = TxnTimeout
+		}
+		if err != nil {
+			tp.forget(hash)
+			evicted = append(evicted, &EvictedTxn{Txn: stxn, Err: err})
+			continue
+		}
+		txns = append(txns, stxn)
+	}
+	tp.Txns = txns
+	return evicted, nil
+}
+
+// forget removes the indexes and the journal of the txn.
+func (tp *LocalTxPool) forget(hash Hash) {
+	delete(tp.txnsMap, hash)
+	delete(tp.insertTimes, hash)
+	if tp.journal != nil {
+		err := tp.journal.Remove(hash)
+		if err != nil {
+			logrus.Errorf("remove txn(%s) from journal error: %s", hash.String(), err.Error())
+		}
+	}
+}
+
 func (tp *LocalTxPool) Reset() {
 	tp.blockTime = ytime.NowNanoTsU64()
 }
@@ -198,13 +364,22 @@ func (tp *LocalTxPool) checkPoolLimit(*SignedTxn) error {
 	return checkPoolLimit(tp.Txns, tp.poolSize)
 }
 
+func (tp *LocalTxPool) checkNonce(stxn *SignedTxn) error {
+	err := checkNonce(tp.nonceGetter, stxn)
+	if err != nil {
+		return err
+	}
+	return checkNonceDuplicated(tp.Txns, stxn)
+}
+
+func (tp *LocalTxPool) checkExpired(stxn *SignedTxn) error {
+	return checkExpired(tp.heightGetter, stxn)
+}
+
 func (tp *LocalTxPool) checkSignature(stxn *SignedTxn) error {
-	return checkSignature(stxn)
+	return checkSignature(tp.chainID, stxn)
 }
 
 func (tp *LocalTxPool) checkTxnSize(stxn *SignedTxn) error {
-	if stxn.Size() > tp.TxnMaxSize {
-		return TxnTooLarge
-	}
 	return checkTxnSize(tp.TxnMaxSize, stxn)
 }
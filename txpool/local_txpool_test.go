@@ -0,0 +1,238 @@
+package txpool
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/keypair"
+	. "github.com/Lawliet-Chan/yu/txn"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"strconv"
+	"testing"
+	"time"
+)
+
+var testTxpoolCfg = &config.TxpoolConf{
+	PoolSize:   100,
+	TxnMaxSize: 1024,
+}
+
+const testChainID = 7
+
+type testAccount struct {
+	pubkey  PubKey
+	privkey PrivKey
+	// makes the txns with the same nonce different
+	seq uint64
+	// of the txns made next
+	validUntil BlockNum
+	// the caller of txns made next, the address of pubkey if empty
+	caller Address
+}
+
+func newTestAccount(t *testing.T) *testAccount {
+	pubkey, privkey, err := GenKeyPair(Sr25519)
+	if err != nil {
+		t.Fatalf("generate key error: %s", err.Error())
+	}
+	return &testAccount{pubkey: pubkey, privkey: privkey}
+}
+
+func (a *testAccount) newTxn(t *testing.T, nonce uint64) *SignedTxn {
+	return a.signTxn(t, testChainID, nonce, 0)
+}
+
+func (a *testAccount) newTipTxn(t *testing.T, nonce, tip uint64) *SignedTxn {
+	return a.signTxn(t, testChainID, nonce, tip)
+}
+
+func (a *testAccount) signTxn(t *testing.T, chainID, nonce, tip uint64) *SignedTxn {
+	a.seq++
+	ecall := &Ecall{
+		TripodName: "test",
+		ExecName:   "Test",
+		Params:     JsonString(strconv.FormatUint(a.seq, 10)),
+	}
+	caller := a.caller
+	if caller == NullAddress {
+		caller = a.pubkey.Address()
+	}
+	raw, err := NewUnsignedTxn(caller, ecall, nonce, tip, a.validUntil, a.seq)
+	if err != nil {
+		t.Fatalf("new UnsignedTxn error: %s", err.Error())
+	}
+	data, err := raw.SignBytes(chainID)
+	if err != nil {
+		t.Fatalf("get sign bytes error: %s", err.Error())
+	}
+	sig, err := a.privkey.SignData(data)
+	if err != nil {
+		t.Fatalf("sign data error: %s", err.Error())
+	}
+	stxn, err := NewSignedTxn(raw, a.pubkey, sig)
+	if err != nil {
+		t.Fatalf("new SignedTxn error: %s", err.Error())
+	}
+	return stxn
+}
+
+func TestPackByNonce(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	bob := newTestAccount(t)
+	nonces := map[Address]uint64{
+		alice.pubkey.Address(): 1,
+	}
+	tp := LocalWithDefaultChecks(testTxpoolCfg)
+	tp.WithChainID(testChainID)
+	tp.WithNonceGetter(func(addr Address) (uint64, error) {
+		return nonces[addr], nil
+	})
+
+	err := tp.Insert(alice.newTxn(t, 0))
+	if _, ok := err.(ErrNonceIllegal); !ok {
+		t.Fatalf("insert txn with stale nonce, error is %v", err)
+	}
+
+	a3, a1, b0, a2, a5 := alice.newTxn(t, 3), alice.newTxn(t, 1), bob.newTxn(t, 0), alice.newTxn(t, 2), alice.newTxn(t, 5)
+	err = tp.BatchInsert(FromArray(a3, a1, b0, a2, a5))
+	if err != nil {
+		t.Fatalf("insert txns error: %s", err.Error())
+	}
+	err = tp.Insert(alice.newTxn(t, 1))
+	if err != NonceDuplicated {
+		t.Fatalf("insert txn with duplicated nonce, error is %v", err)
+	}
+
+	// a5 is held back until a4 comes.
+	stxns, err := tp.Pack(10)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	assertTxns(t, stxns, a1, b0, a2, a3)
+
+	err = tp.Flush()
+	if err != nil {
+		t.Fatalf("flush txpool error: %s", err.Error())
+	}
+	assertTxns(t, tp.Txns, a5)
+
+	// a5 is dropped once the account has passed it.
+	nonces[alice.pubkey.Address()] = 6
+	stxns, err = tp.Pack(10)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	assertTxns(t, stxns)
+	assertTxns(t, tp.Txns)
+
+	// the txn already in pool is skipped, and the rest of the batch is inserted.
+	a6, a7 := alice.newTxn(t, 6), alice.newTxn(t, 7)
+	err = tp.Insert(a6)
+	if err != nil {
+		t.Fatalf("insert txn error: %s", err.Error())
+	}
+	err = tp.BatchInsert(FromArray(a6, a7))
+	if err != nil {
+		t.Fatalf("insert txns with a duplicated one error: %s", err.Error())
+	}
+	assertTxns(t, tp.Txns, a6, a7)
+}
+
+func TestCheckSignature(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	bob := newTestAccount(t)
+	tp := LocalWithDefaultChecks(testTxpoolCfg)
+	tp.WithChainID(testChainID)
+
+	err := tp.Insert(alice.newTxn(t, 0))
+	if err != nil {
+		t.Fatalf("insert txn error: %s", err.Error())
+	}
+
+	err = tp.Insert(alice.signTxn(t, testChainID+1, 1, 0))
+	if err != TxnSignatureErr {
+		t.Fatalf("insert txn signed for another chain, error is %v", err)
+	}
+
+	// the signed fields can not be changed by others.
+	stxn := alice.newTxn(t, 2)
+	raw := *stxn.GetRaw()
+	raw.Tip = 100
+	rewrapped, err := NewSignedTxn(&raw, stxn.GetPubkey(), stxn.GetSignature())
+	if err != nil {
+		t.Fatalf("new SignedTxn error: %s", err.Error())
+	}
+	err = tp.Insert(rewrapped)
+	if err != TxnSignatureErr {
+		t.Fatalf("insert rewrapped txn, error is %v", err)
+	}
+
+	// alice can not sign txns in the name of bob.
+	alice.caller = bob.pubkey.Address()
+	err = tp.Insert(alice.newTxn(t, 0))
+	if err != CallerIllegal {
+		t.Fatalf("insert txn with the caller of others, error is %v", err)
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	var height BlockNum = 3
+	tp := LocalWithDefaultChecks(testTxpoolCfg)
+	tp.WithChainID(testChainID)
+	tp.WithHeightGetter(func() (BlockNum, error) {
+		return height, nil
+	})
+	tp.timeout = time.Minute
+
+	alice.validUntil = 2
+	err := tp.Insert(alice.newTxn(t, 0))
+	if _, ok := err.(ErrTxnExpired); !ok {
+		t.Fatalf("insert expired txn, error is %v", err)
+	}
+
+	alice.validUntil = 5
+	untilFive := alice.newTxn(t, 0)
+	alice.validUntil = 0
+	old, fresh := alice.newTxn(t, 1), alice.newTxn(t, 2)
+	err = tp.BatchInsert(FromArray(untilFive, old, fresh))
+	if err != nil {
+		t.Fatalf("insert txns error: %s", err.Error())
+	}
+	tp.insertTimes[old.GetTxnHash()] = time.Now().Add(-time.Hour)
+
+	evicted, err := tp.RemoveExpired()
+	if err != nil {
+		t.Fatalf("remove expired txns error: %s", err.Error())
+	}
+	if len(evicted) != 1 || evicted[0].Txn != old || evicted[0].Err != TxnTimeout {
+		t.Fatalf("evicted txns are %v, want the old one", evicted)
+	}
+
+	height = 6
+	evicted, err = tp.RemoveExpired()
+	if err != nil {
+		t.Fatalf("remove expired txns error: %s", err.Error())
+	}
+	if len(evicted) != 1 || evicted[0].Txn != untilFive {
+		t.Fatalf("evicted txns are %v, want the one valid until 5", evicted)
+	}
+	if _, ok := evicted[0].Err.(ErrTxnExpired); !ok {
+		t.Fatalf("txn is evicted by %v", evicted[0].Err)
+	}
+	assertTxns(t, tp.Txns, fresh)
+}
+
+func assertTxns(t *testing.T, got []*SignedTxn, want ...*SignedTxn) {
+	if len(got) != len(want) {
+		t.Fatalf("got %d txns, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].GetTxnHash() != want[i].GetTxnHash() {
+			t.Fatalf("txn %d has nonce %d, want %d", i, got[i].GetRaw().GetNonce(), want[i].GetRaw().GetNonce())
+		}
+	}
+}
@@ -0,0 +1,501 @@
+package txpool
+
+import (
+	"container/heap"
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/txn"
+	ytime "github.com/Lawliet-Chan/yu/utils/time"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"github.com/sirupsen/logrus"
+	"sync"
+	"time"
+)
+
+// PriorityTxPool packs the txns with higher tips first, and the txns of
+// the same account in the order of nonces.
+// A txn replaces the unpacked one with the same nonce if its tip is higher,
+// and evicts the one with the lowest tip when the pool is full, together with
+// the later txns of the same account which can never execute without it.
+type PriorityTxPool struct {
+	sync.RWMutex
+
+	poolSize   uint64
+	TxnMaxSize int
+
+	txnsMap map[Hash]*pooledTxn
+	// account -> nonce -> txn
+	accounts map[Address]map[uint64]*pooledTxn
+	// the unpacked txns, the one to evict is on the top
+	unpacked evictHeap
+	// increases on every insert
+	seq uint64
+
+	blockTime uint64
+	// the unpacked txns staying longer are removed, 0 means never.
+	timeout time.Duration
+
+	baseChecks   []TxnCheck
+	tripodChecks []TxnCheck
+
+	nonceGetter  NonceGetter
+	chainID      uint64
+	heightGetter HeightGetter
+	journal      *Journal
+}
+
+type pooledTxn struct {
+	*SignedTxn
+	addr Address
+	// the earlier one is packed first when the tips are equal
+	seq uint64
+	// packed txns are removed by Flush
+	packed   bool
+	inserted time.Time
+	// index in the unpacked heap of pool, -1 if not in it
+	evictIdx int
+}
+
+func (pt *pooledTxn) tip() uint64 {
+	return pt.GetRaw().GetTip()
+}
+
+func (pt *pooledTxn) nonce() uint64 {
+	return pt.GetRaw().GetNonce()
+}
+
+// before reports whether pt is packed before other.
+func (pt *pooledTxn) before(other *pooledTxn) bool {
+	if pt.tip() != other.tip() {
+		return pt.tip() > other.tip()
+	}
+	return pt.seq < other.seq
+}
+
+func NewPriorityTxPool(cfg *config.TxpoolConf) *PriorityTxPool {
+	return &PriorityTxPool{
+		poolSize:     cfg.PoolSize,
+		TxnMaxSize:   cfg.TxnMaxSize,
+		txnsMap:      make(map[Hash]*pooledTxn),
+		accounts:     make(map[Address]map[uint64]*pooledTxn),
+		timeout:      time.Duration(cfg.Timeout) * time.Second,
+		baseChecks:   make([]TxnCheck, 0),
+		tripodChecks: make([]TxnCheck, 0),
+	}
+}
+
+func PriorityWithDefaultChecks(cfg *config.TxpoolConf) *PriorityTxPool {
+	tp := NewPriorityTxPool(cfg)
+	return tp.withDefaultBaseChecks()
+}
+
+// the pool limit and the duplicated nonces are handled by Insert,
+// with eviction and replacement.
+func (tp *PriorityTxPool) withDefaultBaseChecks() *PriorityTxPool {
+	tp.baseChecks = []TxnCheck{
+		tp.checkTxnSize,
+		tp.checkSignature,
+		tp.checkNonce,
+		tp.checkExpired,
+	}
+	return tp
+}
+
+func (tp *PriorityTxPool) PoolSize() uint64 {
+	return tp.poolSize
+}
+
+func (tp *PriorityTxPool) WithBaseChecks(checkFns []TxnCheck) ItxPool {
+	tp.baseChecks = append(tp.baseChecks, checkFns...)
+	return tp
+}
+
+func (tp *PriorityTxPool) WithTripodChecks(checkFns []TxnCheck) ItxPool {
+	tp.tripodChecks = append(tp.tripodChecks, checkFns...)
+	return tp
+}
+
+func (tp *PriorityTxPool) WithNonceGetter(getter NonceGetter) ItxPool {
+	tp.nonceGetter = getter
+	return tp
+}
+
+func (tp *PriorityTxPool) WithChainID(chainID uint64) ItxPool {
+	tp.chainID = chainID
+	return tp
+}
+
+func (tp *PriorityTxPool) WithHeightGetter(getter HeightGetter) ItxPool {
+	tp.heightGetter = getter
+	return tp
+}
+
+func (tp *PriorityTxPool) WithJournal(journal *Journal) ItxPool {
+	tp.journal = journal
+	return tp
+}
+
+func (tp *PriorityTxPool) Reload() error {
+	return reloadJournal(tp, tp.journal)
+}
+
+// insert into txpool
+func (tp *PriorityTxPool) Insert(stxn *SignedTxn) error {
+	return tp.BatchInsert(FromArray(stxn))
+}
+
+// batch insert into txpool
+func (tp *PriorityTxPool) BatchInsert(txns SignedTxns) error {
+	tp.Lock()
+	defer tp.Unlock()
+	for _, stxn := range txns {
+		// the txn already in pool is skipped, as LocalTxPool does.
+		if _, ok := tp.txnsMap[stxn.GetTxnHash()]; ok {
+			continue
+		}
+		err := tp.BaseCheck(stxn)
+		if err != nil {
+			return err
+		}
+		err = tp.TripodsCheck(stxn)
+		if err != nil {
+			return err
+		}
+		err = tp.makeRoom(stxn)
+		if err != nil {
+			return err
+		}
+		err = tp.add(stxn)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeRoom removes the txn replaced by stxn, or the ones evicted by it if the pool is full.
+func (tp *PriorityTxPool) makeRoom(stxn *SignedTxn) error {
+	addr := stxn.GetPubkey().Address()
+	tip := stxn.GetRaw().GetTip()
+	old, ok := tp.accounts[addr][stxn.GetRaw().GetNonce()]
+	if ok {
+		if old.packed {
+			return NonceDuplicated
+		}
+		if tip <= old.tip() {
+			return TipTooLow
+		}
+		tp.remove(old)
+		return nil
+	}
+
+	if uint64(len(tp.txnsMap)) < tp.poolSize {
+		return nil
+	}
+	if tp.unpacked.Len() == 0 || tip <= tp.unpacked[0].tip() {
+		return PoolOverflow
+	}
+	lowest := tp.unpacked[0]
+	if lowest.addr == addr && stxn.GetRaw().GetNonce() > lowest.nonce() {
+		// stxn could never execute after the txn it evicts.
+		return PoolOverflow
+	}
+	evicted := make([]*pooledTxn, 0)
+	for nonce, ptxn := range tp.accounts[lowest.addr] {
+		if nonce >= lowest.nonce() && !ptxn.packed {
+			evicted = append(evicted, ptxn)
+		}
+	}
+	for _, ptxn := range evicted {
+		logrus.Debugf("txn(%s) is evicted from txpool", ptxn.GetTxnHash().String())
+		tp.remove(ptxn)
+	}
+	return nil
+}
+
+func (tp *PriorityTxPool) add(stxn *SignedTxn) error {
+	if tp.journal != nil {
+		err := tp.journal.Insert(stxn)
+		if err != nil {
+			return err
+		}
+	}
+	tp.seq++
+	ptxn := &pooledTxn{
+		SignedTxn: stxn,
+		addr:      stxn.GetPubkey().Address(),
+		seq:       tp.seq,
+		inserted:  time.Now(),
+	}
+	heap.Push(&tp.unpacked, ptxn)
+	tp.txnsMap[stxn.GetTxnHash()] = ptxn
+	if tp.accounts[ptxn.addr] == nil {
+		tp.accounts[ptxn.addr] = make(map[uint64]*pooledTxn)
+	}
+	tp.accounts[ptxn.addr][ptxn.nonce()] = ptxn
+	return nil
+}
+
+func (tp *PriorityTxPool) remove(ptxn *pooledTxn) {
+	tp.removeUnpacked(ptxn)
+	delete(tp.txnsMap, ptxn.GetTxnHash())
+	txns := tp.accounts[ptxn.addr]
+	if txns[ptxn.nonce()] == ptxn {
+		delete(txns, ptxn.nonce())
+	}
+	if len(txns) == 0 {
+		delete(tp.accounts, ptxn.addr)
+	}
+	if tp.journal != nil {
+		err := tp.journal.Remove(ptxn.GetTxnHash())
+		if err != nil {
+			logrus.Errorf("remove txn(%s) from journal error: %s", ptxn.GetTxnHash().String(), err.Error())
+		}
+	}
+}
+
+// removeUnpacked removes ptxn from the unpacked heap if it is in.
+func (tp *PriorityTxPool) removeUnpacked(ptxn *pooledTxn) {
+	if ptxn.evictIdx >= 0 {
+		heap.Remove(&tp.unpacked, ptxn.evictIdx)
+	}
+}
+
+// package some txns to send to tripods
+func (tp *PriorityTxPool) Pack(numLimit uint64) ([]*SignedTxn, error) {
+	return tp.PackFor(numLimit, func(*SignedTxn) error {
+		return nil
+	})
+}
+
+// PackFor always packs the executable txn with the highest tip, an account's txn
+// becomes executable after the one with the previous nonce is packed.
+func (tp *PriorityTxPool) PackFor(numLimit uint64, filter func(*SignedTxn) error) ([]*SignedTxn, error) {
+	tp.Lock()
+	defer tp.Unlock()
+
+	height, err := nextHeight(tp.heightGetter)
+	if err != nil {
+		return nil, err
+	}
+	heads := make(txnHeap, 0, len(tp.accounts))
+	for addr, txns := range tp.accounts {
+		want, err := tp.startNonce(addr, txns)
+		if err != nil {
+			return nil, err
+		}
+		for nonce, ptxn := range txns {
+			if ptxn.packed {
+				continue
+			}
+			err = expiredErr(ptxn.SignedTxn, height)
+			if err == nil && nonce < want {
+				err = NonceIllegal(addr, nonce, want)
+			}
+			if err != nil {
+				logrus.Warnf("drop txn(%s) from txpool: %s", ptxn.GetTxnHash().String(), err.Error())
+				tp.remove(ptxn)
+			}
+		}
+		for txns[want] != nil && txns[want].packed {
+			want++
+		}
+		if head, ok := txns[want]; ok {
+			heads = append(heads, head)
+		}
+	}
+	heap.Init(&heads)
+
+	packed := make([]*pooledTxn, 0)
+	for heads.Len() > 0 && uint64(len(packed)) < numLimit {
+		ptxn := heap.Pop(&heads).(*pooledTxn)
+		logrus.Debugf("pack txn(%s)", ptxn.GetTxnHash().String())
+		err := filter(ptxn.SignedTxn)
+		if err != nil {
+			return nil, err
+		}
+		packed = append(packed, ptxn)
+		if next, ok := tp.accounts[ptxn.addr][ptxn.nonce()+1]; ok {
+			heap.Push(&heads, next)
+		}
+	}
+
+	stxns := make([]*SignedTxn, 0, len(packed))
+	for _, ptxn := range packed {
+		ptxn.packed = true
+		tp.removeUnpacked(ptxn)
+		stxns = append(stxns, ptxn.SignedTxn)
+	}
+	return stxns, nil
+}
+
+// startNonce returns the nonce of the account in state,
+// or the lowest one in the pool if there is no NonceGetter.
+func (tp *PriorityTxPool) startNonce(addr Address, txns map[uint64]*pooledTxn) (uint64, error) {
+	if tp.nonceGetter != nil {
+		return tp.nonceGetter(addr)
+	}
+	first := true
+	var lowest uint64
+	for nonce := range txns {
+		if first || nonce < lowest {
+			lowest = nonce
+			first = false
+		}
+	}
+	return lowest, nil
+}
+
+func (tp *PriorityTxPool) GetTxn(hash Hash) (*SignedTxn, error) {
+	tp.RLock()
+	defer tp.RUnlock()
+	ptxn, ok := tp.txnsMap[hash]
+	if !ok {
+		return nil, nil
+	}
+	return ptxn.SignedTxn, nil
+}
+
+func (tp *PriorityTxPool) RemoveTxns(hashes []Hash) error {
+	tp.Lock()
+	for _, hash := range hashes {
+		if ptxn, ok := tp.txnsMap[hash]; ok {
+			tp.remove(ptxn)
+		}
+	}
+	tp.Unlock()
+	return nil
+}
+
+// remove txns after execute all tripods
+func (tp *PriorityTxPool) Flush() error {
+	tp.Lock()
+	for _, ptxn := range tp.txnsMap {
+		if ptxn.packed {
+			tp.remove(ptxn)
+		}
+	}
+	tp.Unlock()
+	return nil
+}
+
+func (tp *PriorityTxPool) RemoveExpired() ([]*EvictedTxn, error) {
+	tp.Lock()
+	defer tp.Unlock()
+
+	height, err := nextHeight(tp.heightGetter)
+	if err != nil {
+		return nil, err
+	}
+	evicted := make([]*EvictedTxn, 0)
+	for _, ptxn := range tp.txnsMap {
+		if ptxn.packed {
+			continue
+		}
+		err = expiredErr(ptxn.SignedTxn, height)
+		if err == nil && tp.timeout > 0 && time.Since(ptxn.inserted) > tp.timeout {
+			err = TxnTimeout
+		}
+		if err != nil {
+			tp.remove(ptxn)
+			evicted = append(evicted, &EvictedTxn{Txn: ptxn.SignedTxn, Err: err})
+		}
+	}
+	return evicted, nil
+}
+
+func (tp *PriorityTxPool) Reset() {
+	tp.blockTime = ytime.NowNanoTsU64()
+}
+
+// --------- check txn ------
+
+func (tp *PriorityTxPool) BaseCheck(stxn *SignedTxn) error {
+	return Check(tp.baseChecks, stxn)
+}
+
+func (tp *PriorityTxPool) TripodsCheck(stxn *SignedTxn) error {
+	return Check(tp.tripodChecks, stxn)
+}
+
+func (tp *PriorityTxPool) NecessaryCheck(stxn *SignedTxn) (err error) {
+	err = tp.checkTxnSize(stxn)
+	if err != nil {
+		return
+	}
+	err = tp.checkSignature(stxn)
+	if err != nil {
+		return
+	}
+
+	return tp.TripodsCheck(stxn)
+}
+
+func (tp *PriorityTxPool) checkNonce(stxn *SignedTxn) error {
+	return checkNonce(tp.nonceGetter, stxn)
+}
+
+func (tp *PriorityTxPool) checkExpired(stxn *SignedTxn) error {
+	return checkExpired(tp.heightGetter, stxn)
+}
+
+func (tp *PriorityTxPool) checkSignature(stxn *SignedTxn) error {
+	return checkSignature(tp.chainID, stxn)
+}
+
+func (tp *PriorityTxPool) checkTxnSize(stxn *SignedTxn) error {
+	return checkTxnSize(tp.TxnMaxSize, stxn)
+}
+
+// txnHeap pops the txn with the highest priority first.
+type txnHeap []*pooledTxn
+
+func (h txnHeap) Len() int           { return len(h) }
+func (h txnHeap) Less(i, j int) bool { return h[i].before(h[j]) }
+func (h txnHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+
+func (h *txnHeap) Push(x interface{}) {
+	*h = append(*h, x.(*pooledTxn))
+}
+
+func (h *txnHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	*h = old[:n-1]
+	return x
+}
+
+// evictHeap pops the txn with the lowest tip first, and the one with
+// the highest nonce if the tips are equal, which is the one to evict.
+type evictHeap []*pooledTxn
+
+func (h evictHeap) Len() int { return len(h) }
+
+func (h evictHeap) Less(i, j int) bool {
+	if h[i].tip() != h[j].tip() {
+		return h[i].tip() < h[j].tip()
+	}
+	return h[i].nonce() > h[j].nonce()
+}
+
+func (h evictHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].evictIdx = i
+	h[j].evictIdx = j
+}
+
+func (h *evictHeap) Push(x interface{}) {
+	ptxn := x.(*pooledTxn)
+	ptxn.evictIdx = len(*h)
+	*h = append(*h, ptxn)
+}
+
+func (h *evictHeap) Pop() interface{} {
+	old := *h
+	n := len(old)
+	x := old[n-1]
+	x.evictIdx = -1
+	*h = old[:n-1]
+	return x
+}
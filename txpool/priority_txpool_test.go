@@ -0,0 +1,179 @@
+package txpool
+
+import (
+	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
+	. "github.com/Lawliet-Chan/yu/txn"
+	"github.com/Lawliet-Chan/yu/utils/codec"
+	. "github.com/Lawliet-Chan/yu/yerror"
+	"testing"
+)
+
+func newTestPriorityPool(poolSize uint64, nonces map[Address]uint64) *PriorityTxPool {
+	tp := PriorityWithDefaultChecks(&config.TxpoolConf{
+		PoolSize:   poolSize,
+		TxnMaxSize: testTxpoolCfg.TxnMaxSize,
+	})
+	tp.WithChainID(testChainID)
+	tp.WithNonceGetter(func(addr Address) (uint64, error) {
+		return nonces[addr], nil
+	})
+	return tp
+}
+
+func TestPackByPriority(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	bob := newTestAccount(t)
+	tp := newTestPriorityPool(100, map[Address]uint64{})
+
+	// the high tip of a1 can not get it packed before a0.
+	a0, a1 := alice.newTipTxn(t, 0, 1), alice.newTipTxn(t, 1, 10)
+	b0, b1 := bob.newTipTxn(t, 0, 5), bob.newTipTxn(t, 1, 2)
+	a3 := alice.newTipTxn(t, 3, 20)
+	err := tp.BatchInsert(FromArray(a1, a0, b1, b0, a3))
+	if err != nil {
+		t.Fatalf("insert txns error: %s", err.Error())
+	}
+
+	stxns, err := tp.Pack(3)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	assertTxns(t, stxns, b0, b1, a0)
+
+	stxns, err = tp.Pack(10)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	assertTxns(t, stxns, a1)
+
+	err = tp.Flush()
+	if err != nil {
+		t.Fatalf("flush txpool error: %s", err.Error())
+	}
+	if len(tp.txnsMap) != 1 {
+		t.Fatalf("%d txns are left in txpool, want 1", len(tp.txnsMap))
+	}
+}
+
+func TestReplaceByTip(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	tp := newTestPriorityPool(100, map[Address]uint64{})
+
+	err := tp.Insert(alice.newTipTxn(t, 0, 5))
+	if err != nil {
+		t.Fatalf("insert txn error: %s", err.Error())
+	}
+	err = tp.Insert(alice.newTipTxn(t, 0, 5))
+	if err != TipTooLow {
+		t.Fatalf("replace txn with the same tip, error is %v", err)
+	}
+	replacement := alice.newTipTxn(t, 0, 6)
+	err = tp.Insert(replacement)
+	if err != nil {
+		t.Fatalf("replace txn error: %s", err.Error())
+	}
+
+	stxns, err := tp.Pack(10)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	assertTxns(t, stxns, replacement)
+
+	// the packed txn can not be replaced.
+	err = tp.Insert(alice.newTipTxn(t, 0, 100))
+	if err != NonceDuplicated {
+		t.Fatalf("replace packed txn, error is %v", err)
+	}
+}
+
+func TestEvictLowestTip(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	bob := newTestAccount(t)
+	tp := newTestPriorityPool(2, map[Address]uint64{})
+
+	a0, b0 := alice.newTipTxn(t, 0, 3), bob.newTipTxn(t, 0, 1)
+	err := tp.BatchInsert(FromArray(a0, b0))
+	if err != nil {
+		t.Fatalf("insert txns error: %s", err.Error())
+	}
+
+	err = tp.Insert(alice.newTipTxn(t, 1, 1))
+	if err != PoolOverflow {
+		t.Fatalf("insert txn into full pool, error is %v", err)
+	}
+	a1 := alice.newTipTxn(t, 1, 2)
+	err = tp.Insert(a1)
+	if err != nil {
+		t.Fatalf("insert txn error: %s", err.Error())
+	}
+	if stxn, _ := tp.GetTxn(b0.GetTxnHash()); stxn != nil {
+		t.Fatal("the txn with the lowest tip is not evicted")
+	}
+
+	stxns, err := tp.Pack(10)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	assertTxns(t, stxns, a0, a1)
+
+	// the packed txns are never evicted.
+	err = tp.Insert(bob.newTipTxn(t, 0, 10))
+	if err != PoolOverflow {
+		t.Fatalf("insert txn into pool full of packed txns, error is %v", err)
+	}
+	err = tp.Flush()
+	if err != nil {
+		t.Fatalf("flush txpool error: %s", err.Error())
+	}
+	err = tp.Insert(bob.newTipTxn(t, 0, 10))
+	if err != nil {
+		t.Fatalf("insert txn after flush error: %s", err.Error())
+	}
+}
+
+func TestEvictLaterNonces(t *testing.T) {
+	codec.GlobalCodec = &codec.RlpCodec{}
+	alice := newTestAccount(t)
+	bob := newTestAccount(t)
+	carol := newTestAccount(t)
+	tp := newTestPriorityPool(3, map[Address]uint64{})
+
+	// a1 can never execute once a0 is evicted.
+	a0, a1, b0 := alice.newTipTxn(t, 0, 1), alice.newTipTxn(t, 1, 5), bob.newTipTxn(t, 0, 3)
+	err := tp.BatchInsert(FromArray(a0, a1, b0))
+	if err != nil {
+		t.Fatalf("insert txns error: %s", err.Error())
+	}
+	// the same account can not evict its own earlier txn.
+	err = tp.Insert(alice.newTipTxn(t, 2, 10))
+	if err != PoolOverflow {
+		t.Fatalf("insert txn evicting its own earlier txn, error is %v", err)
+	}
+
+	c0 := carol.newTipTxn(t, 0, 2)
+	err = tp.Insert(c0)
+	if err != nil {
+		t.Fatalf("insert txn error: %s", err.Error())
+	}
+	for _, evicted := range []*SignedTxn{a0, a1} {
+		if stxn, _ := tp.GetTxn(evicted.GetTxnHash()); stxn != nil {
+			t.Fatalf("txn(%s) is not evicted", evicted.GetTxnHash().String())
+		}
+	}
+
+	// the txn already in pool is skipped, and the rest of the batch is inserted.
+	b1 := bob.newTipTxn(t, 1, 3)
+	err = tp.BatchInsert(FromArray(b0, b1))
+	if err != nil {
+		t.Fatalf("insert txns with a duplicated one error: %s", err.Error())
+	}
+	stxns, err := tp.Pack(10)
+	if err != nil {
+		t.Fatalf("pack txns error: %s", err.Error())
+	}
+	assertTxns(t, stxns, b0, b1, c0)
+}
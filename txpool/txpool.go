@@ -2,9 +2,33 @@ package txpool
 
 import (
 	. "github.com/Lawliet-Chan/yu/common"
+	"github.com/Lawliet-Chan/yu/config"
 	. "github.com/Lawliet-Chan/yu/txn"
+	. "github.com/Lawliet-Chan/yu/yerror"
 )
 
+// LoadTxPool returns the txpool of cfg.PoolType with the default checks,
+// and the journal if cfg.Journal is set.
+func LoadTxPool(cfg *config.TxpoolConf) (ItxPool, error) {
+	var tp ItxPool
+	switch cfg.PoolType {
+	case config.FifoPool, "":
+		tp = LocalWithDefaultChecks(cfg)
+	case config.PriorityPool:
+		tp = PriorityWithDefaultChecks(cfg)
+	default:
+		return nil, NoTxpoolType
+	}
+	if cfg.Journal.KvType == "" {
+		return tp, nil
+	}
+	journal, err := NewJournal(&cfg.Journal)
+	if err != nil {
+		return nil, err
+	}
+	return tp.WithJournal(journal), nil
+}
+
 type ItxPool interface {
 	//NewEmptySignedTxn() *SignedTxn
 	//NewEmptySignedTxns() SignedTxns
@@ -14,6 +38,16 @@ type ItxPool interface {
 	// txpool with the check-functions
 	WithBaseChecks(checkFns []TxnCheck) ItxPool
 	WithTripodChecks(checkFns []TxnCheck) ItxPool
+	// txpool orders txns by the nonces of their accounts
+	WithNonceGetter(getter NonceGetter) ItxPool
+	// txpool checks the signatures of txns over the chain id
+	WithChainID(chainID uint64) ItxPool
+	// txpool rejects the txns expired on the height of the next block
+	WithHeightGetter(getter HeightGetter) ItxPool
+	// txpool records the inserted and removed txns in journal
+	WithJournal(journal *Journal) ItxPool
+	// insert the txns in journal again after restart
+	Reload() error
 	// base check txn
 	BaseCheck(*SignedTxn) error
 	TripodsCheck(stxn *SignedTxn) error
@@ -33,6 +67,20 @@ type ItxPool interface {
 	RemoveTxns(hashes []Hash) error
 	// remove txns after execute all tripods
 	Flush() error
+	// remove the unpacked txns which stay longer than timeout or are expired on the next height
+	RemoveExpired() ([]*EvictedTxn, error)
 
 	Reset()
 }
+
+// NonceGetter returns the nonce that the next txn of the account must carry.
+type NonceGetter func(addr Address) (uint64, error)
+
+// HeightGetter returns the height of the next block.
+type HeightGetter func() (BlockNum, error)
+
+// EvictedTxn is the txn removed from txpool before being packed, and the reason.
+type EvictedTxn struct {
+	Txn *SignedTxn
+	Err error
+}
@@ -13,19 +13,28 @@ var NoKeyType = errors.New("no key type")
 var NoConvergeType = errors.New("no converge type")
 
 var GenesisBlockIllegal = errors.New("genesis block is illegal")
+var ChainIDIllegal = errors.New("chain id is illegal")
 
 var NoKvdbType = errors.New("no kvdb type")
 var NoQueueType = errors.New("no queue type")
 var NoSqlDbType = errors.New("no sqlDB type")
+var NoBlockStoreType = errors.New("no block store type")
+var NoTxpoolType = errors.New("no txpool type")
 
 var (
 	PoolOverflow    error = errors.New("pool size is full")
 	TxnSignatureErr error = errors.New("the signature of Txn illegal")
+	CallerIllegal   error = errors.New("the caller of txn is not the address of its pubkey")
 	TxnTooLarge     error = errors.New("the size of txn is too large")
+	NonceDuplicated error = errors.New("the nonce of account is already in pool")
+	TipTooLow       error = errors.New("the tip of txn is too low")
+	TxnTimeout      error = errors.New("txn stays in pool longer than timeout")
 )
 
 var OutOfEnergy = errors.New("energy out")
 
+var MerkleIndexOutOfRange = errors.New("index out of range of merkle tree")
+
 type ErrBlockIllegal struct {
 	BlockHash string
 }
@@ -38,6 +47,194 @@ func (b ErrBlockIllegal) Error() string {
 	return errors.Errorf("block(%s) illegal", b.BlockHash).Error()
 }
 
+type ErrBlockSignatureIllegal struct {
+	BlockHash string
+}
+
+func BlockSignatureIllegal(blockHash Hash) ErrBlockSignatureIllegal {
+	return ErrBlockSignatureIllegal{BlockHash: blockHash.String()}
+}
+
+func (b ErrBlockSignatureIllegal) Error() string {
+	return errors.Errorf("signature of block(%s) illegal", b.BlockHash).Error()
+}
+
+type ErrProducerIllegal struct {
+	BlockHash string
+	Pubkey    string
+}
+
+func ProducerIllegal(blockHash Hash, pubkey string) ErrProducerIllegal {
+	return ErrProducerIllegal{BlockHash: blockHash.String(), Pubkey: pubkey}
+}
+
+func (p ErrProducerIllegal) Error() string {
+	return errors.Errorf("producer(%s) of block(%s) is not trusted", p.Pubkey, p.BlockHash).Error()
+}
+
+type ErrNonceIllegal struct {
+	Address string
+	Nonce   uint64
+	Want    uint64
+}
+
+func NonceIllegal(addr Address, nonce, want uint64) ErrNonceIllegal {
+	return ErrNonceIllegal{Address: addr.String(), Nonce: nonce, Want: want}
+}
+
+func (n ErrNonceIllegal) Error() string {
+	return errors.Errorf("nonce(%d) of account(%s) illegal, want %d", n.Nonce, n.Address, n.Want).Error()
+}
+
+type ErrTxnExpired struct {
+	TxnHash    string
+	ValidUntil BlockNum
+	Height     BlockNum
+}
+
+func TxnExpired(txnHash Hash, validUntil, height BlockNum) ErrTxnExpired {
+	return ErrTxnExpired{TxnHash: txnHash.String(), ValidUntil: validUntil, Height: height}
+}
+
+func (t ErrTxnExpired) Error() string {
+	return errors.Errorf("txn(%s) is valid until height %d, but the height is %d", t.TxnHash, t.ValidUntil, t.Height).Error()
+}
+
+type ErrBlockNotFound struct {
+	BlockHash string
+}
+
+func BlockNotFound(blockHash Hash) ErrBlockNotFound {
+	return ErrBlockNotFound{BlockHash: blockHash.String()}
+}
+
+func (b ErrBlockNotFound) Error() string {
+	return errors.Errorf("block(%s) not found", b.BlockHash).Error()
+}
+
+type ErrDuplicateBlock struct {
+	BlockHash string
+}
+
+func DuplicateBlock(blockHash Hash) ErrDuplicateBlock {
+	return ErrDuplicateBlock{BlockHash: blockHash.String()}
+}
+
+func (b ErrDuplicateBlock) Error() string {
+	return errors.Errorf("block(%s) is duplicate", b.BlockHash).Error()
+}
+
+type ErrTxnNotFound struct {
+	TxnHash string
+}
+
+func TxnNotFound(txnHash Hash) ErrTxnNotFound {
+	return ErrTxnNotFound{TxnHash: txnHash.String()}
+}
+
+func (t ErrTxnNotFound) Error() string {
+	return errors.Errorf("txn(%s) not found", t.TxnHash).Error()
+}
+
+type ErrReceiptNotFound struct {
+	TxnHash string
+}
+
+func ReceiptNotFound(txnHash Hash) ErrReceiptNotFound {
+	return ErrReceiptNotFound{TxnHash: txnHash.String()}
+}
+
+func (r ErrReceiptNotFound) Error() string {
+	return errors.Errorf("receipt of txn(%s) not found", r.TxnHash).Error()
+}
+
+// ErrStorageIO means the storage of chain fails or is corrupt,
+// the node should stop instead of going on with it.
+type ErrStorageIO struct {
+	Op  string
+	Err string
+}
+
+func StorageIO(op string, err error) ErrStorageIO {
+	return ErrStorageIO{Op: op, Err: err.Error()}
+}
+
+func (s ErrStorageIO) Error() string {
+	return errors.Errorf("storage %s error: %s", s.Op, s.Err).Error()
+}
+
+type ErrStatePruned struct {
+	BlockHash string
+}
+
+func StatePruned(blockHash Hash) ErrStatePruned {
+	return ErrStatePruned{BlockHash: blockHash.String()}
+}
+
+func (s ErrStatePruned) Error() string {
+	return errors.Errorf("the state of block(%s) has been pruned", s.BlockHash).Error()
+}
+
+type ErrStateNotCommitted struct {
+	BlockHash string
+}
+
+func StateNotCommitted(blockHash Hash) ErrStateNotCommitted {
+	return ErrStateNotCommitted{BlockHash: blockHash.String()}
+}
+
+func (s ErrStateNotCommitted) Error() string {
+	return errors.Errorf("the state of block(%s) is not in the committed history", s.BlockHash).Error()
+}
+
+type ErrSnapshotIdIllegal struct {
+	Id int
+}
+
+func SnapshotIdIllegal(id int) ErrSnapshotIdIllegal {
+	return ErrSnapshotIdIllegal{Id: id}
+}
+
+func (s ErrSnapshotIdIllegal) Error() string {
+	return errors.Errorf("snapshot id(%d) cannot be reverted", s.Id).Error()
+}
+
+type ErrCommitSeqNotFound struct {
+	Seq uint64
+}
+
+func CommitSeqNotFound(seq uint64) ErrCommitSeqNotFound {
+	return ErrCommitSeqNotFound{Seq: seq}
+}
+
+func (c ErrCommitSeqNotFound) Error() string {
+	return errors.Errorf("commit sequence(%d) of state not found", c.Seq).Error()
+}
+
+type ErrSnapshotIllegal struct {
+	Reason string
+}
+
+func SnapshotIllegal(reason string) ErrSnapshotIllegal {
+	return ErrSnapshotIllegal{Reason: reason}
+}
+
+func (s ErrSnapshotIllegal) Error() string {
+	return errors.Errorf("state snapshot illegal: %s", s.Reason).Error()
+}
+
+type ErrStateKeyNoTripod struct {
+	Key string
+}
+
+func StateKeyNoTripod(key []byte) ErrStateKeyNoTripod {
+	return ErrStateKeyNoTripod{Key: ToHex(key)}
+}
+
+func (s ErrStateKeyNoTripod) Error() string {
+	return errors.Errorf("state key(%s) belongs to no tripod", s.Key).Error()
+}
+
 type ErrNoTxnInP2P struct {
 	TxnHash string
 }